@@ -0,0 +1,202 @@
+// Package allowance credits each user's monthly allowance into their primary
+// wallet on their payday.
+package allowance
+
+import (
+	"database/sql"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"time"
+)
+
+// Category is the income category allowance is booked under.
+const Category = "Allowance"
+
+// Description is stored on every allowance transaction.
+const Description = "Monthly allowance - auto-added"
+
+// MaxCatchUp bounds how many missed months one run credits for a user, so a
+// scheduler that was down for a long time does not flood the history.
+const MaxCatchUp = 12
+
+// Period is the first day of the month of t. An allowance transaction stores
+// its period; a unique index allows one per user and period.
+func Period(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Payday is the date allowance is due in the month of period. Paydays past
+// the end of a short month fall on its last day.
+func Payday(period time.Time, payday int) time.Time {
+	last := time.Date(period.Year(), period.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if payday > last {
+		payday = last
+	}
+	return time.Date(period.Year(), period.Month(), payday, 0, 0, 0, 0, time.UTC)
+}
+
+// Credit records the allowance of one period in a wallet and journals it.
+// The caller must hold the user's account locks. It returns false without
+// changing anything when that period was already credited.
+func Credit(tx *sql.Tx, userID, accountID int, amount models.Money, period, date time.Time) (models.Transaction, bool, error) {
+	t := models.Transaction{
+		UserID:      userID,
+		AccountID:   accountID,
+		Amount:      amount,
+		Type:        "income",
+		Category:    Category,
+		Description: Description,
+		Date:        date,
+	}
+
+	// The category is created again if the user renamed it away
+	var categoryID int
+	query := `INSERT INTO categories (user_id, name, type, created_at, updated_at)
+			  VALUES ($1, $2, 'income', NOW(), NOW())
+			  ON CONFLICT (user_id, type, name) DO UPDATE SET name = EXCLUDED.name
+			  RETURNING id`
+	if err := tx.QueryRow(query, userID, Category).Scan(&categoryID); err != nil {
+		return t, false, err
+	}
+	t.CategoryID = &categoryID
+
+	query = `INSERT INTO transactions (user_id, account_id, amount, type, category_id, category, description, date,
+			 allowance_period, created_at, updated_at)
+			 VALUES ($1, $2, $3, 'income', $4, $5, $6, $7, $8, NOW(), NOW())
+			 ON CONFLICT (user_id, allowance_period) DO NOTHING
+			 RETURNING id, created_at, updated_at`
+	err := tx.QueryRow(query, userID, accountID, amount, categoryID, Category, Description, date, period).
+		Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return t, false, nil
+	}
+	if err != nil {
+		return t, false, err
+	}
+
+	if _, err := ledger.Post(tx, ledger.ForTransaction(t)); err != nil {
+		return t, false, err
+	}
+	_, err = tx.Exec(`UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE id = $2`, amount, accountID)
+	if err != nil {
+		return t, false, err
+	}
+	return t, true, nil
+}
+
+// UserError records a user whose allowance could not be credited.
+type UserError struct {
+	UserID int    `json:"user_id"`
+	Error  string `json:"error"`
+}
+
+// Result summarizes a run of Due.
+type Result struct {
+	UsersChecked int                  `json:"users_checked"`
+	Credited     []models.Transaction `json:"credited"`
+	Errors       []UserError          `json:"errors"`
+}
+
+// Due credits every payday up to asOf that has not been paid yet. It picks
+// up after the last credited period, so paydays missed while no scheduler
+// was running are paid late but dated on the payday itself. A user who was
+// never credited starts with the current month.
+func Due(db *sql.DB, asOf time.Time) (Result, error) {
+	result := Result{Credited: []models.Transaction{}, Errors: []UserError{}}
+
+	rows, err := db.Query(`SELECT user_id FROM accounts
+						   WHERE is_primary AND closed_at IS NULL AND allowance_income > 0
+						   ORDER BY user_id`)
+	if err != nil {
+		return result, err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return result, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	for _, userID := range userIDs {
+		result.UsersChecked++
+		credited, err := creditUser(db, userID, asOf)
+		if err != nil {
+			result.Errors = append(result.Errors, UserError{UserID: userID, Error: err.Error()})
+			continue
+		}
+		result.Credited = append(result.Credited, credited...)
+	}
+	return result, nil
+}
+
+func creditUser(db *sql.DB, userID int, asOf time.Time) ([]models.Transaction, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM accounts WHERE user_id = $1 ORDER BY id FOR UPDATE`, userID); err != nil {
+		return nil, err
+	}
+
+	var accountID, payday int
+	var amount models.Money
+	err = tx.QueryRow(`SELECT id, allowance_income, allowance_payday FROM accounts
+					   WHERE user_id = $1 AND is_primary AND closed_at IS NULL`, userID).Scan(&accountID, &amount, &payday)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	current := Period(asOf)
+	next := current
+	var last sql.NullTime
+	if err := tx.QueryRow(`SELECT MAX(allowance_period) FROM transactions WHERE user_id = $1`, userID).Scan(&last); err != nil {
+		return nil, err
+	}
+	if last.Valid {
+		next = Period(last.Time).AddDate(0, 1, 0)
+		if oldest := current.AddDate(0, 1-MaxCatchUp, 0); next.Before(oldest) {
+			next = oldest
+		}
+	}
+
+	var credited []models.Transaction
+	for period := next; !period.After(current); period = period.AddDate(0, 1, 0) {
+		date := Payday(period, payday)
+		if date.After(asOf) {
+			break
+		}
+		t, ok, err := Credit(tx, userID, accountID, amount, period, date)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			credited = append(credited, t)
+		}
+	}
+	if len(credited) == 0 {
+		return nil, nil
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return credited, nil
+}
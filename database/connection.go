@@ -4,8 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"student-money-manager/models"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func getEnv(key, defaultValue string) string {
@@ -67,7 +68,7 @@ func Migrate(db *sql.DB) error {
 		id SERIAL PRIMARY KEY,
 		user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
 		amount DECIMAL(20,2) NOT NULL,
-		type VARCHAR(10) NOT NULL CHECK (type IN ('income', 'expense')),
+		type VARCHAR(10) NOT NULL CHECK (type IN ('income', 'expense', 'transfer')),
 		category VARCHAR(100) NOT NULL,
 		description TEXT,
 		date TIMESTAMP NOT NULL,
@@ -104,6 +105,337 @@ func Migrate(db *sql.DB) error {
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
 
+	// Create double-entry ledger tables
+	ledgerAccountsTable := `
+	CREATE TABLE IF NOT EXISTS ledger_accounts (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+		code VARCHAR(255) NOT NULL,
+		kind VARCHAR(10) NOT NULL CHECK (kind IN ('asset', 'income', 'expense', 'equity')),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, code)
+	);`
+
+	// transaction_id and savings_transaction_id are plain references: the
+	// journal outlives the rows it describes so deletions stay auditable.
+	journalEntriesTable := `
+	CREATE TABLE IF NOT EXISTS journal_entries (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+		transaction_id INTEGER,
+		savings_transaction_id INTEGER,
+		reverses_entry_id INTEGER REFERENCES journal_entries(id),
+		description TEXT,
+		date TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	postingsTable := `
+	CREATE TABLE IF NOT EXISTS postings (
+		id SERIAL PRIMARY KEY,
+		entry_id INTEGER NOT NULL REFERENCES journal_entries(id) ON DELETE CASCADE,
+		ledger_account_id INTEGER NOT NULL REFERENCES ledger_accounts(id) ON DELETE CASCADE,
+		amount DECIMAL(20,2) NOT NULL
+	);`
+
+	// Wallets: a user may hold several accounts, exactly one of them primary.
+	// Existing single accounts become the primary wallet, and existing
+	// transactions, savings transfers and ledger postings are moved onto it.
+	walletMigrations := []string{
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS name VARCHAR(100) NOT NULL DEFAULT 'Main';`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'bank'
+			CHECK (type IN ('cash', 'bank', 'card', 'campus_card'));`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS is_primary BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;`,
+		`UPDATE accounts SET is_primary = TRUE
+			WHERE id IN (SELECT MIN(id) FROM accounts GROUP BY user_id)
+			AND NOT EXISTS (SELECT 1 FROM accounts p WHERE p.user_id = accounts.user_id AND p.is_primary);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_primary ON accounts(user_id) WHERE is_primary;`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS account_id INTEGER REFERENCES accounts(id) ON DELETE CASCADE;`,
+		`UPDATE transactions t SET account_id = a.id FROM accounts a
+			WHERE t.account_id IS NULL AND a.user_id = t.user_id AND a.is_primary;`,
+		`ALTER TABLE transactions ALTER COLUMN account_id SET NOT NULL;`,
+		`ALTER TABLE savings_transactions ADD COLUMN IF NOT EXISTS account_id INTEGER REFERENCES accounts(id) ON DELETE CASCADE;`,
+		`UPDATE savings_transactions st SET account_id = a.id FROM accounts a
+			WHERE st.account_id IS NULL AND a.user_id = st.user_id AND a.is_primary;`,
+		`ALTER TABLE savings_transactions ALTER COLUMN account_id SET NOT NULL;`,
+		`UPDATE ledger_accounts la SET code = 'current:' || a.id FROM accounts a
+			WHERE la.code = 'current' AND a.user_id = la.user_id AND a.is_primary;`,
+	}
+
+	// Transfers between a user's own wallets are transactions of type
+	// 'transfer' with a destination wallet
+	transferMigrations := []string{
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS to_account_id INTEGER REFERENCES accounts(id) ON DELETE CASCADE;`,
+		`ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_type_check;`,
+		`ALTER TABLE transactions ADD CONSTRAINT transactions_type_check CHECK (type IN ('income', 'expense', 'transfer'));`,
+		`ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_transfer_check;`,
+		`ALTER TABLE transactions ADD CONSTRAINT transactions_transfer_check
+			CHECK ((type = 'transfer') = (to_account_id IS NOT NULL) AND to_account_id IS DISTINCT FROM account_id);`,
+	}
+
+	// Line items of a transaction split across several categories. The
+	// amounts of a transaction's splits add up to its amount.
+	transactionSplitsTable := `
+	CREATE TABLE IF NOT EXISTS transaction_splits (
+		id SERIAL PRIMARY KEY,
+		transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+		category VARCHAR(100) NOT NULL,
+		amount DECIMAL(20,2) NOT NULL CHECK (amount > 0),
+		note TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Recurring rules generate transactions; each generated transaction
+	// records its rule and occurrence date so no occurrence is created twice.
+	recurringRulesTable := `
+	CREATE TABLE IF NOT EXISTS recurring_rules (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+		type VARCHAR(10) NOT NULL CHECK (type IN ('income', 'expense')),
+		amount DECIMAL(20,2) NOT NULL CHECK (amount > 0),
+		category VARCHAR(100) NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('daily', 'weekly', 'biweekly', 'monthly', 'custom')),
+		rrule TEXT NOT NULL DEFAULT '',
+		start_date DATE NOT NULL,
+		end_date DATE,
+		last_run_date DATE,
+		is_active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	recurringMigrations := []string{
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS recurring_rule_id INTEGER REFERENCES recurring_rules(id) ON DELETE SET NULL;`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS occurrence_date DATE;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_recurring_occurrence ON transactions(recurring_rule_id, occurrence_date);`,
+	}
+
+	// Allowance is paid on a configurable day of the month. Each allowance
+	// transaction records the month it pays for, so a month can only be paid
+	// once; allowances recorded before this keep the month they were created.
+	allowanceMigrations := []string{
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS allowance_payday SMALLINT NOT NULL DEFAULT 1
+			CHECK (allowance_payday BETWEEN 1 AND 31);`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS allowance_period DATE;`,
+		`UPDATE transactions SET allowance_period = DATE_TRUNC('month', created_at)::date
+			WHERE allowance_period IS NULL AND id IN (
+				SELECT MIN(id) FROM transactions
+				WHERE type = 'income' AND category = 'Allowance' AND description = 'Monthly allowance - auto-added'
+				GROUP BY user_id, DATE_TRUNC('month', created_at))
+			AND NOT EXISTS (
+				SELECT 1 FROM transactions p
+				WHERE p.user_id = transactions.user_id
+				AND p.allowance_period = DATE_TRUNC('month', transactions.created_at)::date);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_allowance_period ON transactions(user_id, allowance_period);`,
+	}
+
+	// Last run of each background job, shared by every server instance
+	schedulerJobsTable := `
+	CREATE TABLE IF NOT EXISTS scheduler_jobs (
+		name VARCHAR(100) PRIMARY KEY,
+		last_run_at TIMESTAMP NOT NULL,
+		last_error TEXT
+	);`
+
+	// Spending limits per expense category and period
+	budgetsTable := `
+	CREATE TABLE IF NOT EXISTS budgets (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		category VARCHAR(100) NOT NULL,
+		amount DECIMAL(20,2) NOT NULL CHECK (amount > 0),
+		period VARCHAR(10) NOT NULL DEFAULT 'monthly' CHECK (period IN ('weekly', 'monthly', 'yearly')),
+		rollover BOOLEAN NOT NULL DEFAULT FALSE,
+		start_date DATE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, category, period)
+	);`
+
+	// Envelope budgeting: money is moved from the unassigned part of the
+	// wallet balances into envelopes, and expenses draw from one envelope.
+	envelopesTable := `
+	CREATE TABLE IF NOT EXISTS envelopes (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		category VARCHAR(100),
+		strict BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	envelopeMovesTable := `
+	CREATE TABLE IF NOT EXISTS envelope_moves (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		from_envelope_id INTEGER REFERENCES envelopes(id) ON DELETE CASCADE,
+		to_envelope_id INTEGER REFERENCES envelopes(id) ON DELETE CASCADE,
+		amount DECIMAL(20,2) NOT NULL CHECK (amount > 0),
+		note TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	envelopeMigrations := []string{
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS envelope_id INTEGER REFERENCES envelopes(id) ON DELETE SET NULL;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_envelopes_category ON envelopes(user_id, category) WHERE category IS NOT NULL;`,
+	}
+
+	// Per-user income and expense categories. Every user gets the default
+	// categories plus any category their existing data already uses, and
+	// transactions and splits are linked to their category by id.
+	categoriesTable := `
+	CREATE TABLE IF NOT EXISTS categories (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		type VARCHAR(10) NOT NULL CHECK (type IN ('income', 'expense')),
+		color VARCHAR(7) NOT NULL DEFAULT '',
+		icon VARCHAR(50) NOT NULL DEFAULT '',
+		archived_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, type, name)
+	);`
+
+	categoryMigrations := []string{
+		`INSERT INTO categories (user_id, name, type)
+			SELECT DISTINCT user_id, category, type FROM transactions WHERE type IN ('income', 'expense')
+			AND category NOT IN ('Transfer', 'Split')
+			ON CONFLICT (user_id, type, name) DO NOTHING;`,
+		`INSERT INTO categories (user_id, name, type)
+			SELECT DISTINCT t.user_id, s.category, t.type FROM transaction_splits s
+			JOIN transactions t ON t.id = s.transaction_id
+			WHERE t.type IN ('income', 'expense') AND s.category NOT IN ('Transfer', 'Split')
+			ON CONFLICT (user_id, type, name) DO NOTHING;`,
+		`INSERT INTO categories (user_id, name, type)
+			SELECT DISTINCT user_id, category, type FROM recurring_rules WHERE category NOT IN ('Transfer', 'Split')
+			ON CONFLICT (user_id, type, name) DO NOTHING;`,
+		`INSERT INTO categories (user_id, name, type)
+			SELECT DISTINCT user_id, category, 'expense' FROM budgets WHERE category NOT IN ('Transfer', 'Split')
+			ON CONFLICT (user_id, type, name) DO NOTHING;`,
+		`INSERT INTO categories (user_id, name, type)
+			SELECT DISTINCT user_id, category, 'expense' FROM envelopes
+			WHERE category IS NOT NULL AND category NOT IN ('Transfer', 'Split')
+			ON CONFLICT (user_id, type, name) DO NOTHING;`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES categories(id);`,
+		`UPDATE transactions t SET category_id = c.id FROM categories c
+			WHERE t.category_id IS NULL AND c.user_id = t.user_id AND c.type = t.type AND c.name = t.category;`,
+		`ALTER TABLE transaction_splits ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES categories(id);`,
+		`UPDATE transaction_splits s SET category_id = c.id FROM transactions t, categories c
+			WHERE s.category_id IS NULL AND t.id = s.transaction_id
+			AND c.user_id = t.user_id AND c.type = t.type AND c.name = s.category;`,
+	}
+
+	// Categories nest under a parent of the same type, to any depth
+	categoryTreeMigrations := []string{
+		`ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES categories(id);`,
+		`ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_parent_check;`,
+		`ALTER TABLE categories ADD CONSTRAINT categories_parent_check CHECK (parent_id IS DISTINCT FROM id);`,
+	}
+
+	// Free-form labels, attached to any number of transactions
+	tagsTable := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(50) NOT NULL,
+		color VARCHAR(7) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name)
+	);`
+
+	transactionTagsTable := `
+	CREATE TABLE IF NOT EXISTS transaction_tags (
+		transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (transaction_id, tag_id)
+	);`
+
+	// Receipts attached to transactions. The contents live in the attachment
+	// store under their SHA-256, shared by all attachments with equal bytes.
+	attachmentsTable := `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+		filename VARCHAR(255) NOT NULL,
+		content_type VARCHAR(100) NOT NULL,
+		size BIGINT NOT NULL,
+		sha256 CHAR(64) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (transaction_id, sha256)
+	);`
+
+	// Full-text search over descriptions and categories, with matches in the
+	// description ranked higher
+	searchMigrations := []string{
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', COALESCE(description, '')), 'A') ||
+			setweight(to_tsvector('english', category), 'B')) STORED;`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_search_vector ON transactions USING GIN (search_vector);`,
+	}
+
+	// Statement imports. Saved CSV mappings are kept per user, typically one
+	// per bank. An import holds its parsed rows from upload until it is
+	// committed, and every imported transaction remembers the bank's id for
+	// it, so a statement imported twice does not book a row twice.
+	importProfilesTable := `
+	CREATE TABLE IF NOT EXISTS import_profiles (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		mapping JSONB NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name)
+	);`
+
+	importsTable := `
+	CREATE TABLE IF NOT EXISTS imports (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		account_id INTEGER NOT NULL REFERENCES accounts(id),
+		format VARCHAR(10) NOT NULL,
+		filename VARCHAR(255) NOT NULL,
+		mapping JSONB,
+		rows JSONB NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'preview' CHECK (status IN ('preview', 'committed')),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		committed_at TIMESTAMP
+	);`
+
+	importedTransactionsTable := `
+	CREATE TABLE IF NOT EXISTS imported_transactions (
+		transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+		import_id INTEGER NOT NULL REFERENCES imports(id) ON DELETE CASCADE,
+		account_id INTEGER NOT NULL REFERENCES accounts(id),
+		external_id VARCHAR(255),
+		UNIQUE (account_id, external_id)
+	);`
+
+	// A transaction merged with its duplicate keeps the bank ids of both, so
+	// a transaction may have several import records
+	importMigrations := []string{
+		`ALTER TABLE imported_transactions DROP CONSTRAINT IF EXISTS imported_transactions_pkey;`,
+	}
+
+	// Pairs of transactions the user reviewed and found not to be duplicates,
+	// stored with the lower id first
+	duplicateDismissalsTable := `
+	CREATE TABLE IF NOT EXISTS duplicate_dismissals (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+		duplicate_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (transaction_id, duplicate_id),
+		CHECK (transaction_id < duplicate_id)
+	);`
+
 	// Create indexes for better performance
 	indexes := []string{
 		`CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id);`,
@@ -116,6 +448,30 @@ func Migrate(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_savings_transactions_user_id ON savings_transactions(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_savings_transactions_goal_id ON savings_transactions(goal_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_savings_transactions_date ON savings_transactions(date);`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions(account_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_to_account_id ON transactions(to_account_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_savings_transactions_account_id ON savings_transactions(account_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_journal_entries_user_id ON journal_entries(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_journal_entries_transaction_id ON journal_entries(transaction_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_journal_entries_reverses_entry_id ON journal_entries(reverses_entry_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_postings_entry_id ON postings(entry_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_postings_ledger_account_id ON postings(ledger_account_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transaction_splits_transaction_id ON transaction_splits(transaction_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transaction_splits_category ON transaction_splits(category);`,
+		`CREATE INDEX IF NOT EXISTS idx_recurring_rules_user_id ON recurring_rules(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_envelope_id ON transactions(envelope_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_envelope_moves_user_id ON envelope_moves(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_category_id ON transactions(category_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transaction_splits_category_id ON transaction_splits(category_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transaction_tags_tag_id ON transaction_tags(tag_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_sha256 ON attachments(sha256);`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_user_page ON transactions(user_id, date, created_at, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_savings_transactions_user_page ON savings_transactions(user_id, date, created_at, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_imports_user_id ON imports(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_imported_transactions_import_id ON imported_transactions(import_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_imported_transactions_transaction_id ON imported_transactions(transaction_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_duplicate_dismissals_duplicate_id ON duplicate_dismissals(duplicate_id);`,
 	}
 
 	// Add savings_balance column to existing accounts table if it doesn't exist
@@ -160,6 +516,141 @@ func Migrate(db *sql.DB) error {
 		return fmt.Errorf("failed to create savings_transactions table: %v", err)
 	}
 
+	if _, err := db.Exec(ledgerAccountsTable); err != nil {
+		return fmt.Errorf("failed to create ledger_accounts table: %v", err)
+	}
+
+	if _, err := db.Exec(journalEntriesTable); err != nil {
+		return fmt.Errorf("failed to create journal_entries table: %v", err)
+	}
+
+	if _, err := db.Exec(postingsTable); err != nil {
+		return fmt.Errorf("failed to create postings table: %v", err)
+	}
+
+	for _, migration := range walletMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate accounts to wallets: %v", err)
+		}
+	}
+
+	for _, migration := range transferMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate transactions for transfers: %v", err)
+		}
+	}
+
+	if _, err := db.Exec(transactionSplitsTable); err != nil {
+		return fmt.Errorf("failed to create transaction_splits table: %v", err)
+	}
+
+	if _, err := db.Exec(recurringRulesTable); err != nil {
+		return fmt.Errorf("failed to create recurring_rules table: %v", err)
+	}
+
+	for _, migration := range recurringMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate transactions for recurring rules: %v", err)
+		}
+	}
+
+	for _, migration := range allowanceMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate allowance schedule: %v", err)
+		}
+	}
+
+	if _, err := db.Exec(schedulerJobsTable); err != nil {
+		return fmt.Errorf("failed to create scheduler_jobs table: %v", err)
+	}
+
+	if _, err := db.Exec(budgetsTable); err != nil {
+		return fmt.Errorf("failed to create budgets table: %v", err)
+	}
+
+	if _, err := db.Exec(envelopesTable); err != nil {
+		return fmt.Errorf("failed to create envelopes table: %v", err)
+	}
+
+	if _, err := db.Exec(envelopeMovesTable); err != nil {
+		return fmt.Errorf("failed to create envelope_moves table: %v", err)
+	}
+
+	for _, migration := range envelopeMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate transactions for envelopes: %v", err)
+		}
+	}
+
+	if _, err := db.Exec(categoriesTable); err != nil {
+		return fmt.Errorf("failed to create categories table: %v", err)
+	}
+
+	// Default categories for users who predate categories. Register seeds
+	// new users, and a user's later renames, merges and deletions must
+	// survive restarts, so users with any category are left alone.
+	seedDefaults := `INSERT INTO categories (user_id, name, type)
+		SELECT u.id, d.name, d.type FROM users u
+		CROSS JOIN (SELECT UNNEST($1::text[]), 'income' UNION ALL SELECT UNNEST($2::text[]), 'expense') AS d(name, type)
+		WHERE NOT EXISTS (SELECT 1 FROM categories c WHERE c.user_id = u.id)
+		ON CONFLICT (user_id, type, name) DO NOTHING;`
+	_, err := db.Exec(seedDefaults, pq.Array(models.StudentCategories["income"]), pq.Array(models.StudentCategories["expense"]))
+	if err != nil {
+		return fmt.Errorf("failed to seed default categories: %v", err)
+	}
+
+	for _, migration := range categoryMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate transactions to categories: %v", err)
+		}
+	}
+
+	for _, migration := range categoryTreeMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate categories to a tree: %v", err)
+		}
+	}
+
+	if _, err := db.Exec(tagsTable); err != nil {
+		return fmt.Errorf("failed to create tags table: %v", err)
+	}
+
+	if _, err := db.Exec(transactionTagsTable); err != nil {
+		return fmt.Errorf("failed to create transaction_tags table: %v", err)
+	}
+
+	if _, err := db.Exec(attachmentsTable); err != nil {
+		return fmt.Errorf("failed to create attachments table: %v", err)
+	}
+
+	for _, migration := range searchMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to add transaction search: %v", err)
+		}
+	}
+
+	if _, err := db.Exec(importProfilesTable); err != nil {
+		return fmt.Errorf("failed to create import_profiles table: %v", err)
+	}
+
+	if _, err := db.Exec(importsTable); err != nil {
+		return fmt.Errorf("failed to create imports table: %v", err)
+	}
+
+	if _, err := db.Exec(importedTransactionsTable); err != nil {
+		return fmt.Errorf("failed to create imported_transactions table: %v", err)
+	}
+
+	for _, migration := range importMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate imported_transactions: %v", err)
+		}
+	}
+
+	if _, err := db.Exec(duplicateDismissalsTable); err != nil {
+		return fmt.Errorf("failed to create duplicate_dismissals table: %v", err)
+	}
+
 	// Update existing columns to support larger amounts (ignore errors for non-existent tables)
 	for _, alterCmd := range alterExistingColumns {
 		db.Exec(alterCmd) // Ignore errors as tables might not exist yet
@@ -0,0 +1,136 @@
+// Package duplicates scores how likely two transactions are the same one
+// recorded twice, as happens between manual entry, statement imports and
+// recurring rules. Only transactions with the same amount and type are
+// compared; the score weighs how similar their descriptions are, how close
+// their dates are and whether their categories agree.
+package duplicates
+
+import (
+	"math"
+	"strings"
+	"student-money-manager/models"
+	"time"
+	"unicode"
+)
+
+const (
+	// DefaultWindow is how many days apart candidates may be by default.
+	DefaultWindow = 3
+	// MaxWindow is the largest window a caller may ask for.
+	MaxWindow = 30
+	// DefaultMinConfidence is the lowest confidence reported by default.
+	DefaultMinConfidence = 0.6
+)
+
+// The weights of the parts of a score, adding up to 1.
+const (
+	descriptionWeight = 0.6
+	dateWeight        = 0.25
+	categoryWeight    = 0.15
+)
+
+// Match is the score of a pair. Confidence runs from 0 to 1; a pair
+// recorded on the same day with the same description and category scores
+// 1.
+type Match struct {
+	Confidence            float64
+	DescriptionSimilarity float64
+	DaysApart             int
+}
+
+// Score compares two transactions with the same amount and type that are
+// at most window days apart.
+func Score(a, b models.Transaction, window int) Match {
+	days := DaysApart(a, b)
+	similarity := Similarity(a.Description, b.Description)
+
+	closeness := 1 - float64(days)/float64(window+1)
+	if closeness < 0 {
+		closeness = 0
+	}
+	sameCategory := 0.0
+	if sameCategories(a, b) {
+		sameCategory = 1
+	}
+
+	confidence := descriptionWeight*similarity + dateWeight*closeness + categoryWeight*sameCategory
+	return Match{
+		Confidence:            round(confidence),
+		DescriptionSimilarity: round(similarity),
+		DaysApart:             days,
+	}
+}
+
+// DaysApart counts the calendar days between the dates of a and b.
+func DaysApart(a, b models.Transaction) int {
+	days := int(math.Round(day(a.Date).Sub(day(b.Date)).Hours() / 24))
+	if days < 0 {
+		days = -days
+	}
+	return days
+}
+
+// Similarity compares two descriptions by their words, ignoring case,
+// punctuation, single letters and numbers such as card or reference
+// numbers. It favours the share of the shorter description's words found
+// in the longer one, so a short manual note like "coffee" matches a bank's
+// "CAMPUS COFFEE 0412 CARD PURCHASE". Two empty descriptions are equal; an
+// empty one against a written one scores 0.5, as nothing is known.
+func Similarity(a, b string) float64 {
+	wordsA, wordsB := words(a), words(b)
+	switch {
+	case len(wordsA) == 0 && len(wordsB) == 0:
+		return 1
+	case len(wordsA) == 0 || len(wordsB) == 0:
+		return 0.5
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	smaller := min(len(wordsA), len(wordsB))
+	union := len(wordsA) + len(wordsB) - shared
+
+	overlap := float64(shared) / float64(smaller)
+	jaccard := float64(shared) / float64(union)
+	return 0.75*overlap + 0.25*jaccard
+}
+
+// words returns the distinct words of a description that say something
+// about it.
+func words(description string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < 2 || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+			continue
+		}
+		set[word] = true
+	}
+	return set
+}
+
+// sameCategories reports whether a and b are booked to the same category.
+// Split transactions, which have no single category, never match.
+func sameCategories(a, b models.Transaction) bool {
+	if a.CategoryID != nil && b.CategoryID != nil {
+		return *a.CategoryID == *b.CategoryID
+	}
+	if len(a.Splits) > 0 || len(b.Splits) > 0 {
+		return false
+	}
+	return a.Category != "" && strings.EqualFold(a.Category, b.Category)
+}
+
+func day(t time.Time) time.Time {
+	year, month, date := t.Date()
+	return time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,147 @@
+package duplicates
+
+import (
+	"student-money-manager/models"
+	"testing"
+	"time"
+)
+
+func transaction(date, description, category string) models.Transaction {
+	t, err := time.Parse("2006-01-02 15:04", date)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", date)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return models.Transaction{Date: t, Description: description, Category: category, Amount: 450, Type: "expense"}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"coffee", "CAMPUS COFFEE 0412 CARD PURCHASE", 0.81},
+		{"CAMPUS COFFEE 0412 CARD PURCHASE", "coffee", 0.81},
+		{"Campus Coffee", "campus coffee!", 1},
+		{"", "", 1},
+		{"", "Campus Coffee", 0.5},
+		{"Lunch", "", 0.5},
+		// Numbers and single letters say nothing about the payee
+		{"0412 #", "x 99", 1},
+		{"0412", "Campus Coffee", 0.5},
+		{"Groceries", "Rent", 0},
+		{"campus bookshop", "campus coffee", 0.46},
+	}
+	for _, test := range tests {
+		if got := round(Similarity(test.a, test.b)); got != test.want {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	food := 7
+	otherFood := 7
+	rent := 9
+	withID := func(tr models.Transaction, id *int) models.Transaction {
+		tr.CategoryID = id
+		return tr
+	}
+	split := transaction("2026-01-05", "Coffee", "")
+	split.Splits = []models.TransactionSplit{{Category: "Food & Dining", Amount: 450}}
+
+	tests := []struct {
+		name   string
+		a, b   models.Transaction
+		window int
+		want   Match
+	}{
+		{
+			name:   "identical on the same day",
+			a:      transaction("2026-01-05", "Campus Coffee", "Food & Dining"),
+			b:      transaction("2026-01-05", "Campus Coffee", "Food & Dining"),
+			window: DefaultWindow,
+			want:   Match{Confidence: 1, DescriptionSimilarity: 1},
+		},
+		{
+			name:   "same day at different times",
+			a:      transaction("2026-01-05 08:10", "Campus Coffee", "food & dining"),
+			b:      transaction("2026-01-05 23:59", "Campus Coffee", "Food & Dining"),
+			window: DefaultWindow,
+			want:   Match{Confidence: 1, DescriptionSimilarity: 1},
+		},
+		{
+			name:   "manual note against a bank description",
+			a:      transaction("2026-01-05", "coffee", "Food & Dining"),
+			b:      transaction("2026-01-06", "CAMPUS COFFEE 0412 CARD PURCHASE", ""),
+			window: DefaultWindow,
+			want:   Match{Confidence: 0.68, DescriptionSimilarity: 0.81, DaysApart: 1},
+		},
+		{
+			name:   "empty description against a written one",
+			a:      transaction("2026-01-05", "", "Food & Dining"),
+			b:      transaction("2026-01-05", "Campus Coffee", "Food & Dining"),
+			window: DefaultWindow,
+			want:   Match{Confidence: 0.7, DescriptionSimilarity: 0.5},
+		},
+		{
+			name:   "category ids win over names",
+			a:      withID(transaction("2026-01-05", "Coffee", "Food"), &food),
+			b:      withID(transaction("2026-01-05", "Coffee", "Dining"), &otherFood),
+			window: DefaultWindow,
+			want:   Match{Confidence: 1, DescriptionSimilarity: 1},
+		},
+		{
+			name:   "different category ids",
+			a:      withID(transaction("2026-01-05", "Coffee", "Food"), &food),
+			b:      withID(transaction("2026-01-05", "Coffee", "Food"), &rent),
+			window: DefaultWindow,
+			want:   Match{Confidence: 0.85, DescriptionSimilarity: 1},
+		},
+		{
+			name:   "splits never share a category",
+			a:      split,
+			b:      split,
+			window: DefaultWindow,
+			want:   Match{Confidence: 0.85, DescriptionSimilarity: 1},
+		},
+		{
+			name:   "last day of the window",
+			a:      transaction("2026-01-30", "Rent", "Housing"),
+			b:      transaction("2026-02-02", "Rent", "Housing"),
+			window: 3,
+			want:   Match{Confidence: 0.81, DescriptionSimilarity: 1, DaysApart: 3},
+		},
+		{
+			name:   "one day past the window",
+			a:      transaction("2026-01-30", "Rent", "Housing"),
+			b:      transaction("2026-02-03", "Rent", "Housing"),
+			window: 3,
+			want:   Match{Confidence: 0.75, DescriptionSimilarity: 1, DaysApart: 4},
+		},
+		{
+			name:   "window of zero days",
+			a:      transaction("2026-01-05", "Rent", "Housing"),
+			b:      transaction("2026-01-06", "Rent", "Housing"),
+			window: 0,
+			want:   Match{Confidence: 0.75, DescriptionSimilarity: 1, DaysApart: 1},
+		},
+		{
+			name:   "across a year end",
+			a:      transaction("2026-12-31 22:00", "Rent", "Housing"),
+			b:      transaction("2027-01-01 01:00", "Rent", "Housing"),
+			window: 1,
+			want:   Match{Confidence: 0.88, DescriptionSimilarity: 1, DaysApart: 1},
+		},
+	}
+	for _, test := range tests {
+		if got := Score(test.a, test.b, test.window); got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+		if got := Score(test.b, test.a, test.window); got != test.want {
+			t.Errorf("%s, reversed: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -3,38 +3,50 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"student-money-manager/allowance"
+	"student-money-manager/ledger"
 	"student-money-manager/models"
+	"student-money-manager/recurring"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const accountColumns = `id, user_id, name, type, is_primary, balance, savings_balance, allowance_income,
+			  allowance_payday, closed_at, created_at, updated_at`
+
+// scanAccount reads a row selected with accountColumns.
+func scanAccount(row rowScanner, a *models.Account) error {
+	return row.Scan(&a.ID, &a.UserID, &a.Name, &a.Type, &a.IsPrimary, &a.Balance, &a.SavingsBalance,
+		&a.AllowanceIncome, &a.AllowancePayday, &a.ClosedAt, &a.CreatedAt, &a.UpdatedAt)
+}
+
 func (h *Handler) GetAccount(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
-	var account models.Account
-	query := `SELECT id, user_id, balance, savings_balance, allowance_income, created_at, updated_at 
-			  FROM accounts WHERE user_id = $1`
-
-	err := h.db.QueryRow(query, userID).Scan(
-		&account.ID, &account.UserID, &account.Balance, &account.SavingsBalance, &account.AllowanceIncome,
-		&account.CreatedAt, &account.UpdatedAt)
+	accounts, err := h.listAccounts(userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
-			return
-		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account"})
 		return
 	}
+	if len(accounts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
 
-	c.JSON(http.StatusOK, account)
+	c.JSON(http.StatusOK, models.AccountOverview{
+		Account:      *accounts.primary(),
+		Accounts:     accounts,
+		TotalBalance: accounts.total(),
+	})
 }
 
 func (h *Handler) UpdateAccount(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
 	var req struct {
-		AllowanceIncome float64 `json:"allowance_income" binding:"required,gte=0"`
+		AllowanceIncome models.Money `json:"allowance_income" binding:"required,gte=0"`
+		AllowancePayday *int         `json:"allowance_payday,omitempty" binding:"omitempty,min=1,max=31"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -42,16 +54,19 @@ func (h *Handler) UpdateAccount(c *gin.Context) {
 		return
 	}
 
+	// Allowance settings live on the primary account
 	var account models.Account
 	query := `UPDATE accounts 
-			  SET allowance_income = $1, updated_at = NOW()
-			  WHERE user_id = $2
-			  RETURNING id, user_id, balance, allowance_income, created_at, updated_at`
+			  SET allowance_income = $1, allowance_payday = COALESCE($2, allowance_payday), updated_at = NOW()
+			  WHERE user_id = $3 AND is_primary
+			  RETURNING ` + accountColumns
 
-	err := h.db.QueryRow(query, req.AllowanceIncome, userID).Scan(
-		&account.ID, &account.UserID, &account.Balance, &account.AllowanceIncome,
-		&account.CreatedAt, &account.UpdatedAt)
+	err := scanAccount(h.db.QueryRow(query, req.AllowanceIncome, req.AllowancePayday, userID), &account)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
 		return
 	}
@@ -62,63 +77,55 @@ func (h *Handler) UpdateAccount(c *gin.Context) {
 func (h *Handler) ProcessAutoAllowance(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
-	// Get user's account info
-	var account models.Account
-	query := `SELECT id, user_id, balance, allowance_income FROM accounts WHERE user_id = $1`
-	err := h.db.QueryRow(query, userID).Scan(&account.ID, &account.UserID, &account.Balance, &account.AllowanceIncome)
+	tx, err := h.db.Begin()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Get user's account info. Holding the lock also serializes concurrent
+	// calls with each other and with the scheduler. Allowance is paid into
+	// the primary wallet.
+	accounts, err := lockAccounts(tx, userID)
+	if err != nil {
+		respondAccountError(c, err)
 		return
 	}
+	account := accounts.primary()
 
 	if account.AllowanceIncome <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No allowance amount set"})
 		return
 	}
 
-	// Check if allowance for current month already exists
-	checkQuery := `SELECT COUNT(*) FROM transactions 
-				   WHERE user_id = $1 
-				   AND type = 'income' 
-				   AND category = 'Allowance' 
-				   AND DATE_TRUNC('month', created_at) = DATE_TRUNC('month', NOW())`
+	// Pay the current month, dated on the payday unless it is still ahead.
+	// The month is recorded on the transaction, so paying it again fails no
+	// matter when either call happened.
+	now := time.Now().UTC()
+	period := allowance.Period(now)
+	date := allowance.Payday(period, account.AllowancePayday)
+	if date.After(now) {
+		date = recurring.Date(now)
+	}
 
-	var count int
-	err = h.db.QueryRow(checkQuery, userID).Scan(&count)
+	transaction, ok, err := allowance.Credit(tx, userID, account.ID, account.AllowanceIncome, period, date)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing allowance"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create allowance transaction"})
 		return
 	}
-
-	if count > 0 {
+	if !ok {
 		c.JSON(http.StatusConflict, gin.H{"error": "Allowance already processed for this month"})
 		return
 	}
 
-	// Create allowance transaction
-	transactionQuery := `INSERT INTO transactions (user_id, amount, type, category, description, date, created_at, updated_at)
-						 VALUES ($1, $2, 'income', 'Allowance', 'Monthly allowance - auto-added', CURRENT_DATE, NOW(), NOW())
-						 RETURNING id, user_id, amount, type, category, description, date, created_at, updated_at`
-
-	var transaction models.Transaction
-	err = h.db.QueryRow(transactionQuery, userID, account.AllowanceIncome).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Type,
-		&transaction.Category, &transaction.Description, &transaction.Date,
-		&transaction.CreatedAt, &transaction.UpdatedAt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create allowance transaction"})
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
 		return
 	}
 
-	// Update account balance
-	updateBalanceQuery := `UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE user_id = $2`
-	_, err = h.db.Exec(updateBalanceQuery, account.AllowanceIncome, userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update balance"})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
@@ -132,41 +139,82 @@ func (h *Handler) ProcessAutoAllowance(c *gin.Context) {
 func (h *Handler) GetSummary(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
-	var summary models.Summary
+	summary := models.Summary{Wallets: []models.WalletSummary{}}
 
-	// Get account balance and savings balance
-	err := h.db.QueryRow("SELECT balance, savings_balance FROM accounts WHERE user_id = $1", userID).Scan(&summary.CurrentBalance, &summary.SavingsBalance)
+	// Get savings balance
+	err := h.db.QueryRow("SELECT COALESCE(SUM(savings_balance), 0) FROM accounts WHERE user_id = $1", userID).Scan(&summary.SavingsBalance)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account balance"})
 		return
 	}
 
-	// Get income and expense totals
-	query := `SELECT 
-				COALESCE(SUM(CASE WHEN type = 'income' THEN amount ELSE 0 END), 0) as total_income,
-				COALESCE(SUM(CASE WHEN type = 'expense' THEN amount ELSE 0 END), 0) as total_expense,
-				COUNT(*) as transaction_count
-			  FROM transactions WHERE user_id = $1`
+	// Get balance, income and expense totals per wallet. Transfers between
+	// the user's own wallets are neither income nor expense.
+	query := `SELECT a.id, a.name, a.type, a.balance,
+				COALESCE(SUM(CASE WHEN t.type = 'income' THEN t.amount ELSE 0 END), 0) as total_income,
+				COALESCE(SUM(CASE WHEN t.type = 'expense' THEN t.amount ELSE 0 END), 0) as total_expense,
+				COUNT(t.id) as transaction_count
+			  FROM accounts a
+			  LEFT JOIN transactions t ON t.account_id = a.id AND t.type IN ('income', 'expense')
+			  WHERE a.user_id = $1
+			  GROUP BY a.id
+			  ORDER BY a.id`
 
-	err = h.db.QueryRow(query, userID).Scan(&summary.TotalIncome, &summary.TotalExpense, &summary.TransactionCount)
+	rows, err := h.db.Query(query, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch summary"})
 		return
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w models.WalletSummary
+		err := rows.Scan(&w.AccountID, &w.Name, &w.Type, &w.Balance, &w.TotalIncome, &w.TotalExpense, &w.TransactionCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan summary"})
+			return
+		}
+		summary.Wallets = append(summary.Wallets, w)
+		summary.CurrentBalance += w.Balance
+		summary.TotalIncome += w.TotalIncome
+		summary.TotalExpense += w.TotalExpense
+		summary.TransactionCount += w.TransactionCount
+	}
 
 	c.JSON(http.StatusOK, summary)
 }
 
+// GetCategoryAnalytics totals income and expenses per category, both as a
+// flat list and as a tree in which every category also carries the totals
+// of its subcategories.
 func (h *Handler) GetCategoryAnalytics(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
+	// The filters of GetTransactions select the transactions counted
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	conditions, args, err := filterTransactions("", []interface{}{userID}, filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	selected := `t.id IN (SELECT id FROM transactions WHERE user_id = $1` + conditions + `)`
+
+	// Split transactions count towards the category of each split
 	query := `SELECT category, type, SUM(amount) as total_amount, COUNT(*) as count
-			  FROM transactions 
-			  WHERE user_id = $1 
+			  FROM (
+				SELECT COALESCE(s.category, t.category) as category, t.type, COALESCE(s.amount, t.amount) as amount
+				FROM transactions t
+				LEFT JOIN transaction_splits s ON s.transaction_id = t.id
+				WHERE t.user_id = $1 AND t.type IN ('income', 'expense') AND ` + selected + `
+			  ) lines
 			  GROUP BY category, type 
 			  ORDER BY total_amount DESC`
 
-	rows, err := h.db.Query(query, userID)
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
 		return
@@ -184,8 +232,48 @@ func (h *Handler) GetCategoryAnalytics(c *gin.Context) {
 		analytics = append(analytics, ca)
 	}
 
+	// Totals per category id, rolled up the category tree
+	query = `SELECT COALESCE(s.category_id, t.category_id), SUM(COALESCE(s.amount, t.amount)), COUNT(*)
+			 FROM transactions t
+			 LEFT JOIN transaction_splits s ON s.transaction_id = t.id
+			 WHERE t.user_id = $1 AND t.type IN ('income', 'expense') AND COALESCE(s.category_id, t.category_id) IS NOT NULL
+			 AND ` + selected + `
+			 GROUP BY 1`
+	totalRows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+	defer totalRows.Close()
+
+	amounts := map[int]models.Money{}
+	counts := map[int]int{}
+	for totalRows.Next() {
+		var categoryID, count int
+		var amount models.Money
+		if err := totalRows.Scan(&categoryID, &amount, &count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan analytics"})
+			return
+		}
+		amounts[categoryID], counts[categoryID] = amount, count
+	}
+
+	categories, err := listCategories(h.db, userID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	active := []models.Category{}
+	for _, cat := range categories {
+		if cat.ArchivedAt == nil {
+			active = append(active, cat)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"analytics":  analytics,
-		"categories": models.StudentCategories,
+		"tree":       categoryTree(categories, amounts, counts),
+		"categories": active,
 	})
 }
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"student-money-manager/reconcile"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) Reconcile(c *gin.Context) {
+	var req struct {
+		UserID int   `json:"user_id" binding:"gte=0"`
+		DryRun *bool `json:"dry_run"`
+	}
+
+	// An empty body is a dry run over every user
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	repair := req.DryRun != nil && !*req.DryRun
+
+	result, err := reconcile.Run(h.db, reconcile.Options{UserID: req.UserID, Repair: repair})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile balances"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
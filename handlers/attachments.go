@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"student-money-manager/models"
+	"student-money-manager/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Attachments
+
+const (
+	// maxAttachmentSize limits each uploaded file.
+	maxAttachmentSize = 10 << 20
+	// maxAttachmentsPerUpload limits the files of one upload request.
+	maxAttachmentsPerUpload = 5
+)
+
+// attachmentTypes are the accepted content types, as sniffed from the
+// uploaded bytes rather than taken from the client.
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+const attachmentColumns = `id, user_id, transaction_id, filename, content_type, size, sha256, created_at`
+
+// scanAttachment reads a row selected with attachmentColumns.
+func scanAttachment(row rowScanner, a *models.Attachment) error {
+	return row.Scan(&a.ID, &a.UserID, &a.TransactionID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.CreatedAt)
+}
+
+func (h *Handler) GetAttachments(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	transactionID, ok := h.findTransactionID(c, userID)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT `+attachmentColumns+` FROM attachments
+							  WHERE transaction_id = $1 AND user_id = $2 ORDER BY id`, transactionID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments"})
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		if err := scanAttachment(rows, &a); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan attachment"})
+			return
+		}
+		attachments = append(attachments, a)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+// UploadAttachments attaches the files sent in the multipart field "file",
+// which may be repeated. Uploading a file the transaction already has
+// returns the existing attachment.
+func (h *Handler) UploadAttachments(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	transactionID, ok := h.findTransactionID(c, userID)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the files
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentsPerUpload*maxAttachmentSize+1<<20)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form"})
+		return
+	}
+	defer form.RemoveAll()
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if len(files) > maxAttachmentsPerUpload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxAttachmentsPerUpload) + " files can be uploaded at once"})
+		return
+	}
+	for _, file := range files {
+		if file.Size > maxAttachmentSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "'" + file.Filename + "' is larger than 10 MB"})
+			return
+		}
+	}
+
+	attachments := []models.Attachment{}
+	for _, file := range files {
+		attachment, err := h.saveAttachment(userID, transactionID, file)
+		if err != nil {
+			if reqErr, ok := err.(requestError); ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": string(reqErr)})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"attachments": attachments})
+}
+
+// DownloadAttachment sends the contents of an attachment.
+func (h *Handler) DownloadAttachment(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var attachment models.Attachment
+	if !h.findAttachment(c, userID, &attachment) {
+		return
+	}
+
+	blob, err := h.store.Open(attachment.SHA256)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment contents are missing"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment"})
+		return
+	}
+	defer blob.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, blob, map[string]string{
+		"Content-Disposition": disposition,
+	})
+}
+
+func (h *Handler) DeleteAttachment(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var attachment models.Attachment
+	if !h.findAttachment(c, userID, &attachment) {
+		return
+	}
+
+	if _, err := h.db.Exec("DELETE FROM attachments WHERE id = $1", attachment.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	h.removeUnusedBlobs([]string{attachment.SHA256})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// findTransactionID checks that the transaction named by the :id parameter
+// belongs to the user and writes the error response when it does not.
+func (h *Handler) findTransactionID(c *gin.Context, userID int) (int, bool) {
+	transactionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return 0, false
+	}
+
+	var exists bool
+	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM transactions WHERE id = $1 AND user_id = $2)", transactionID, userID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction"})
+		return 0, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return 0, false
+	}
+	return transactionID, true
+}
+
+// findAttachment loads the attachment named by the :attachmentId parameter
+// of the transaction named by :id and writes the error response when it
+// cannot.
+func (h *Handler) findAttachment(c *gin.Context, userID int, attachment *models.Attachment) bool {
+	attachmentID, err := strconv.Atoi(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return false
+	}
+
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = $1 AND transaction_id = $2 AND user_id = $3`
+	if err := scanAttachment(h.db.QueryRow(query, attachmentID, c.Param("id"), userID), attachment); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachment"})
+		return false
+	}
+	return true
+}
+
+// saveAttachment checks the type of an uploaded file, stores its contents
+// under their hash and records the attachment. The advisory lock on the
+// hash keeps removeUnusedBlobs from deleting the contents in between.
+func (h *Handler) saveAttachment(userID, transactionID int, file *multipart.FileHeader) (models.Attachment, error) {
+	var attachment models.Attachment
+
+	f, err := file.Open()
+	if err != nil {
+		return attachment, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxAttachmentSize+1))
+	f.Close()
+	if err != nil {
+		return attachment, err
+	}
+	if len(data) > maxAttachmentSize {
+		return attachment, requestError("'" + file.Filename + "' is larger than 10 MB")
+	}
+
+	contentType := http.DetectContentType(data)
+	if !attachmentTypes[contentType] {
+		return attachment, requestError("'" + file.Filename + "' is not a JPEG, PNG, GIF, WebP or PDF file")
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return attachment, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, hash); err != nil {
+		return attachment, err
+	}
+
+	query := `INSERT INTO attachments (user_id, transaction_id, filename, content_type, size, sha256, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, NOW())
+			  ON CONFLICT (transaction_id, sha256) DO UPDATE SET sha256 = EXCLUDED.sha256
+			  RETURNING ` + attachmentColumns
+	err = scanAttachment(tx.QueryRow(query, userID, transactionID, filepath.Base(file.Filename), contentType, len(data), hash), &attachment)
+	if err != nil {
+		return attachment, err
+	}
+
+	if err := h.store.Put(hash, bytes.NewReader(data)); err != nil {
+		return attachment, err
+	}
+	return attachment, tx.Commit()
+}
+
+// removeUnusedBlobs deletes the stored contents of each hash no attachment
+// refers to any more. Failures are only logged: the attachment rows are
+// already gone, so a leftover file wastes space but is harmless.
+func (h *Handler) removeUnusedBlobs(hashes []string) {
+	for _, hash := range hashes {
+		if err := h.removeUnusedBlob(hash); err != nil {
+			log.Printf("attachments: failed to remove blob %s: %v", hash, err)
+		}
+	}
+}
+
+func (h *Handler) removeUnusedBlob(hash string) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, hash); err != nil {
+		return err
+	}
+	var used bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM attachments WHERE sha256 = $1)`, hash).Scan(&used); err != nil {
+		return err
+	}
+	if !used {
+		if err := h.store.Delete(hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// attachmentHashes lists the content hashes of a transaction's attachments,
+// so their blobs can be cleaned up once it is deleted.
+func attachmentHashes(tx *sql.Tx, transactionID int) ([]string, error) {
+	rows, err := tx.Query(`SELECT sha256 FROM attachments WHERE transaction_id = $1`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
@@ -52,13 +52,18 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
-	// Create account for user
-	_, err = h.db.Exec("INSERT INTO accounts (user_id, balance, allowance_income, created_at, updated_at) VALUES ($1, 0, 0, NOW(), NOW())", user.ID)
+	// Create the primary account for user
+	_, err = h.db.Exec("INSERT INTO accounts (user_id, name, type, is_primary, balance, allowance_income, created_at, updated_at) VALUES ($1, 'Main', 'bank', true, 0, 0, NOW(), NOW())", user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
 		return
 	}
 
+	if err := seedCategories(h.db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create categories"})
+		return
+	}
+
 	// Generate JWT token
 	token, err := h.generateToken(user.ID, user.Email)
 	if err != nil {
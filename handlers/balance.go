@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"student-money-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every handler that changes a balance follows the same sequence inside one
+// database transaction: lock the user's accounts with lockAccounts, read or
+// write the ledger rows, then apply the change with adjustBalance. Locking
+// all of a user's wallets in id order keeps the lock order identical across
+// handlers, so concurrent requests for the same user queue up instead of
+// deadlocking or overwriting each other's balance.
+
+var (
+	errAccountNotFound = errors.New("account not found")
+	errAccountClosed   = errors.New("account is closed")
+)
+
+// requestError is a validation failure found after the accounts were locked.
+// respondAccountError reports it to the client as a 400.
+type requestError string
+
+func (e requestError) Error() string {
+	return string(e)
+}
+
+// transferCategory is stored as the category of transfers, which do not
+// belong to any income or expense category.
+const transferCategory = "Transfer"
+
+// userAccounts holds a user's wallets as read under lock, ordered by id.
+type userAccounts []models.Account
+
+// lockAccounts selects every account of the user FOR UPDATE. The locks are
+// held until tx commits or rolls back. It returns sql.ErrNoRows when the user
+// has no account at all.
+func lockAccounts(tx *sql.Tx, userID int) (userAccounts, error) {
+	query := `SELECT ` + accountColumns + `
+			  FROM accounts WHERE user_id = $1 ORDER BY id FOR UPDATE`
+	rows, err := tx.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts userAccounts
+	for rows.Next() {
+		var account models.Account
+		if err := scanAccount(rows, &account); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return accounts, nil
+}
+
+// primary returns the user's primary wallet.
+func (a userAccounts) primary() *models.Account {
+	for i := range a {
+		if a[i].IsPrimary {
+			return &a[i]
+		}
+	}
+	return &a[0]
+}
+
+// find returns the wallet with the given id, or nil.
+func (a userAccounts) find(id int) *models.Account {
+	for i := range a {
+		if a[i].ID == id {
+			return &a[i]
+		}
+	}
+	return nil
+}
+
+// open resolves the wallet a request refers to, defaulting to the primary
+// one, and makes sure money can still move through it.
+func (a userAccounts) open(id *int) (*models.Account, error) {
+	account := a.primary()
+	if id != nil {
+		account = a.find(*id)
+	}
+	if account == nil {
+		return nil, errAccountNotFound
+	}
+	if account.ClosedAt != nil {
+		return nil, errAccountClosed
+	}
+	return account, nil
+}
+
+// total is the sum of all wallet balances.
+func (a userAccounts) total() models.Money {
+	var total models.Money
+	for _, account := range a {
+		total += account.Balance
+	}
+	return total
+}
+
+// respondAccountError writes the response for an error from lockAccounts,
+// userAccounts.open or a requestError from validation.
+func respondAccountError(c *gin.Context, err error) {
+	if reqErr, ok := err.(requestError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": string(reqErr)})
+		return
+	}
+
+	switch err {
+	case sql.ErrNoRows, errAccountNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	case errAccountClosed:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is closed"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock account"})
+	}
+}
+
+// checkTransaction validates a new or edited transaction against the locked
+// accounts and normalizes its transfer and split fields. old is the version
+// being replaced, or nil for a new transaction; its effect is undone before
+// checking whether the source wallet can cover a transfer.
+func checkTransaction(accounts userAccounts, old, t *models.Transaction) error {
+	if _, err := accounts.open(&t.AccountID); err != nil {
+		return err
+	}
+
+	if t.Type != "transfer" {
+		t.ToAccountID = nil
+		if len(t.Splits) > 0 {
+			return checkSplits(t)
+		}
+		if t.CategoryID == nil && (t.Category == "" || t.Category == transferCategory || t.Category == splitCategory) {
+			return requestError("category is required for income and expense transactions")
+		}
+		return nil
+	}
+
+	if len(t.Splits) > 0 {
+		return requestError("Transfers cannot be split")
+	}
+	if t.ToAccountID == nil {
+		return requestError("to_account_id is required for transfers")
+	}
+	if *t.ToAccountID == t.AccountID {
+		return requestError("Cannot transfer to the same account")
+	}
+	if _, err := accounts.open(t.ToAccountID); err != nil {
+		return err
+	}
+	t.Category = transferCategory
+
+	available := accounts.find(t.AccountID).Balance
+	if old != nil {
+		available -= balanceEffects(*old)[t.AccountID]
+	}
+	if available < t.Amount {
+		return requestError("Insufficient balance: only " + available.String() + " available in the source account")
+	}
+	return nil
+}
+
+// adjustBalance moves a wallet's balance by delta. Callers must hold the
+// account lock.
+func adjustBalance(tx *sql.Tx, accountID int, delta models.Money) error {
+	if delta == 0 {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE id = $2",
+		delta, accountID)
+	return err
+}
+
+// balanceEffects returns how a transaction moves each wallet it touches:
+// income adds its amount, expense subtracts it, a transfer moves it from
+// AccountID to ToAccountID.
+func balanceEffects(t models.Transaction) map[int]models.Money {
+	effects := map[int]models.Money{}
+	switch t.Type {
+	case "income":
+		effects[t.AccountID] = t.Amount
+	case "transfer":
+		effects[t.AccountID] = -t.Amount
+		effects[*t.ToAccountID] += t.Amount
+	default:
+		effects[t.AccountID] = -t.Amount
+	}
+	return effects
+}
+
+// applyBalanceChanges undoes the effects of removed and applies those of
+// added, either of which may be nil. Each wallet whose balance changes gets
+// a single UPDATE, in id order.
+func applyBalanceChanges(tx *sql.Tx, removed, added *models.Transaction) error {
+	deltas := balanceDeltas{}
+	deltas.add(removed, added)
+	return deltas.apply(tx)
+}
+
+// balanceDeltas accumulates the net change of each wallet over any number
+// of transaction changes.
+type balanceDeltas map[int]models.Money
+
+// add undoes the effects of removed and adds those of added, either of
+// which may be nil.
+func (d balanceDeltas) add(removed, added *models.Transaction) {
+	if removed != nil {
+		for accountID, effect := range balanceEffects(*removed) {
+			d[accountID] -= effect
+		}
+	}
+	if added != nil {
+		for accountID, effect := range balanceEffects(*added) {
+			d[accountID] += effect
+		}
+	}
+}
+
+// apply updates each wallet with a net change once, in id order.
+func (d balanceDeltas) apply(tx *sql.Tx) error {
+	accountIDs := make([]int, 0, len(d))
+	for accountID := range d {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Ints(accountIDs)
+
+	for _, accountID := range accountIDs {
+		if err := adjustBalance(tx, accountID, d[accountID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
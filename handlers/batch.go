@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Batch operations
+
+// errTransactionNotFound is reported for a batch operation on a transaction
+// the user does not have.
+var errTransactionNotFound = errors.New("transaction not found")
+
+// batchOperation is an operation whose request passed validation.
+type batchOperation struct {
+	op     string
+	id     int
+	create models.TransactionRequest
+	date   time.Time
+	tags   []string
+	patch  models.TransactionPatchRequest
+}
+
+// BatchTransactions applies a list of create, patch and delete operations in
+// one database transaction. Every operation is validated first; if any of
+// them is rejected nothing is applied and the errors are returned keyed by
+// the index of the operation. The balance of each wallet is adjusted once
+// by the net change of the whole batch.
+func (h *Handler) BatchTransactions(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.TransactionBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	operations := make([]batchOperation, len(req.Operations))
+	var failed []models.TransactionOperationError
+	for i, op := range req.Operations {
+		operation, err := parseOperation(op)
+		if err != nil {
+			failed = append(failed, models.TransactionOperationError{Index: i, Error: err.Error()})
+		}
+		operations[i] = operation
+	}
+	if len(failed) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No operation was applied", "errors": failed})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	accounts, err := lockAccounts(tx, userID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	outcome, err := applyOperations(tx, userID, accounts, operations)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply operations"})
+		return
+	}
+	if len(outcome.failed) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No operation was applied", "errors": outcome.failed})
+		return
+	}
+
+	if err := outcome.deltas.apply(tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
+		return
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	h.removeUnusedBlobs(outcome.hashes)
+
+	c.JSON(http.StatusOK, gin.H{"results": outcome.results})
+}
+
+// batchOutcome is the result of applyOperations. results has an entry for
+// every operation, but only those not listed in failed were applied.
+type batchOutcome struct {
+	results []models.TransactionOperationResult
+	failed  []models.TransactionOperationError
+	deltas  balanceDeltas
+	hashes  []string
+}
+
+// applyOperations applies operations in order. Each is checked against the
+// state left by the ones before it; an operation that fails a check writes
+// nothing, is listed in failed, and the remaining ones are still applied.
+// The net balance changes are collected in deltas for the caller to apply,
+// and the attachment hashes of deleted transactions in hashes. The error
+// result is for any other failure, after which tx must be rolled back.
+func applyOperations(tx *sql.Tx, userID int, accounts userAccounts, operations []batchOperation) (batchOutcome, error) {
+	outcome := batchOutcome{
+		results: make([]models.TransactionOperationResult, len(operations)),
+		deltas:  balanceDeltas{},
+	}
+	for i, operation := range operations {
+		result := models.TransactionOperationResult{Index: i, Op: operation.op, ID: operation.id}
+
+		var removed, added *models.Transaction
+		var err error
+		switch operation.op {
+		case "create":
+			var t models.Transaction
+			t, err = createOperation(tx, userID, accounts, operation)
+			added = &t
+		case "patch":
+			var old, t models.Transaction
+			old, t, err = patchOperation(tx, userID, accounts, operation)
+			removed, added = &old, &t
+		case "delete":
+			var old models.Transaction
+			var hashes []string
+			old, hashes, err = deleteOperation(tx, userID, accounts, operation.id)
+			removed = &old
+			outcome.hashes = append(outcome.hashes, hashes...)
+		}
+		if err != nil {
+			message, ok := operationError(err)
+			if !ok {
+				return outcome, err
+			}
+			outcome.failed = append(outcome.failed, models.TransactionOperationError{Index: i, Error: message})
+			outcome.results[i] = result
+			continue
+		}
+
+		outcome.deltas.add(removed, added)
+		accounts.apply(removed, added)
+		if added != nil {
+			result.ID = added.ID
+			result.Transaction = added
+		}
+		outcome.results[i] = result
+	}
+	return outcome, nil
+}
+
+// parseOperation decodes and validates the request of an operation without
+// looking at the database.
+func parseOperation(op models.TransactionOperation) (batchOperation, error) {
+	operation := batchOperation{op: op.Op, id: op.ID}
+
+	switch op.Op {
+	case "create":
+		if len(op.Transaction) == 0 {
+			return operation, requestError("transaction is required for create")
+		}
+		if err := json.Unmarshal(op.Transaction, &operation.create); err != nil {
+			return operation, requestError("Invalid transaction: " + err.Error())
+		}
+		if err := binding.Validator.ValidateStruct(&operation.create); err != nil {
+			return operation, requestError(err.Error())
+		}
+		date, err := time.Parse("2006-01-02", operation.create.Date)
+		if err != nil {
+			return operation, requestError("Invalid date format. Use YYYY-MM-DD")
+		}
+		operation.date = date
+		tags, err := checkTags(operation.create.Tags)
+		if err != nil {
+			return operation, err
+		}
+		operation.tags = tags
+
+	case "patch":
+		if op.ID <= 0 {
+			return operation, requestError("id is required for patch")
+		}
+		if len(op.Transaction) == 0 {
+			return operation, requestError("transaction is required for patch")
+		}
+		if err := json.Unmarshal(op.Transaction, &operation.patch); err != nil {
+			return operation, requestError("Invalid transaction: " + err.Error())
+		}
+		if err := binding.Validator.ValidateStruct(&operation.patch); err != nil {
+			return operation, requestError(err.Error())
+		}
+		// Catches a bad date or tag before the transaction is loaded
+		if err := applyPatch(&models.Transaction{}, operation.patch); err != nil {
+			return operation, err
+		}
+
+	case "delete":
+		if op.ID <= 0 {
+			return operation, requestError("id is required for delete")
+		}
+
+	default:
+		return operation, requestError("op must be create, patch or delete")
+	}
+	return operation, nil
+}
+
+// createOperation inserts a transaction with its splits, tags and journal
+// entry. Balances are left to the caller.
+func createOperation(tx *sql.Tx, userID int, accounts userAccounts, operation batchOperation) (models.Transaction, error) {
+	req := operation.create
+	account, err := accounts.open(req.AccountID)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	transaction := models.Transaction{
+		AccountID:   account.ID,
+		ToAccountID: req.ToAccountID,
+		Amount:      req.Amount,
+		Type:        req.Type,
+		CategoryID:  req.CategoryID,
+		Category:    req.Category,
+		Description: req.Description,
+		Date:        operation.date,
+		Splits:      newSplits(req.Splits),
+		EnvelopeID:  req.EnvelopeID,
+		Tags:        operation.tags,
+	}
+	if err := checkTransaction(accounts, nil, &transaction); err != nil {
+		return transaction, err
+	}
+	if err := resolveTransactionCategories(tx, userID, nil, &transaction); err != nil {
+		return transaction, err
+	}
+	if err := checkEnvelope(tx, userID, nil, &transaction, req.EnvelopeID == nil); err != nil {
+		return transaction, err
+	}
+
+	err = scanTransaction(tx.QueryRow(insertTransactionQuery, userID, transaction.AccountID, transaction.ToAccountID, transaction.Amount,
+		transaction.Type, transaction.CategoryID, transaction.Category, transaction.Description, transaction.Date, transaction.EnvelopeID), &transaction)
+	if err != nil {
+		return transaction, err
+	}
+	if err := saveSplits(tx, &transaction); err != nil {
+		return transaction, err
+	}
+	if err := saveTags(tx, &transaction); err != nil {
+		return transaction, err
+	}
+	_, err = ledger.Post(tx, ledger.ForTransaction(transaction))
+	return transaction, err
+}
+
+// patchOperation updates a transaction like PatchTransaction and returns
+// the old and the new version. Balances are left to the caller.
+func patchOperation(tx *sql.Tx, userID int, accounts userAccounts, operation batchOperation) (models.Transaction, models.Transaction, error) {
+	req := operation.patch
+
+	var oldTransaction models.Transaction
+	if err := lockTransaction(tx, operation.id, userID, &oldTransaction); err != nil {
+		if err == sql.ErrNoRows {
+			err = errTransactionNotFound
+		}
+		return oldTransaction, oldTransaction, err
+	}
+	if err := checkOpen(accounts, oldTransaction); err != nil {
+		return oldTransaction, oldTransaction, err
+	}
+
+	loaded := []models.Transaction{oldTransaction}
+	if err := loadSplits(tx, loaded); err != nil {
+		return oldTransaction, oldTransaction, err
+	}
+	if err := loadTags(tx, loaded); err != nil {
+		return oldTransaction, oldTransaction, err
+	}
+	oldTransaction = loaded[0]
+
+	transaction := oldTransaction
+	if err := applyPatch(&transaction, req); err != nil {
+		return oldTransaction, transaction, err
+	}
+	if err := checkTransaction(accounts, &oldTransaction, &transaction); err != nil {
+		return oldTransaction, transaction, err
+	}
+	if err := resolveTransactionCategories(tx, userID, &oldTransaction, &transaction); err != nil {
+		return oldTransaction, transaction, err
+	}
+	autoEnvelope := req.EnvelopeID == nil && (req.CategoryID != nil || req.Category != nil || req.Splits != nil || req.Type != nil)
+	if err := checkEnvelope(tx, userID, &oldTransaction, &transaction, autoEnvelope); err != nil {
+		return oldTransaction, transaction, err
+	}
+
+	err := scanTransaction(tx.QueryRow(updateTransactionQuery, transaction.AccountID, transaction.ToAccountID, transaction.Amount,
+		transaction.Type, transaction.CategoryID, transaction.Category, transaction.Description, transaction.Date, transaction.EnvelopeID,
+		operation.id, userID), &transaction)
+	if err != nil {
+		return oldTransaction, transaction, err
+	}
+	if err := ledger.ReverseTransaction(tx, userID, oldTransaction.ID); err != nil {
+		return oldTransaction, transaction, err
+	}
+	if err := saveSplits(tx, &transaction); err != nil {
+		return oldTransaction, transaction, err
+	}
+	if req.Tags != nil {
+		if err := saveTags(tx, &transaction); err != nil {
+			return oldTransaction, transaction, err
+		}
+	}
+	_, err = ledger.Post(tx, ledger.ForTransaction(transaction))
+	return oldTransaction, transaction, err
+}
+
+// deleteOperation deletes a transaction and reverses its journal entry. It
+// returns the deleted transaction and the hashes of its attachments, whose
+// contents the caller removes after committing.
+func deleteOperation(tx *sql.Tx, userID int, accounts userAccounts, transactionID int) (models.Transaction, []string, error) {
+	var transaction models.Transaction
+	if err := lockTransaction(tx, transactionID, userID, &transaction); err != nil {
+		if err == sql.ErrNoRows {
+			err = errTransactionNotFound
+		}
+		return transaction, nil, err
+	}
+	if err := checkOpen(accounts, transaction); err != nil {
+		return transaction, nil, err
+	}
+
+	hashes, err := attachmentHashes(tx, transaction.ID)
+	if err != nil {
+		return transaction, nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM transactions WHERE id = $1 AND user_id = $2", transactionID, userID); err != nil {
+		return transaction, nil, err
+	}
+	return transaction, hashes, ledger.ReverseTransaction(tx, userID, transaction.ID)
+}
+
+// apply moves the balances read under lock by a change, so the checks of
+// later operations in the same batch see it.
+func (a userAccounts) apply(removed, added *models.Transaction) {
+	deltas := balanceDeltas{}
+	deltas.add(removed, added)
+	for accountID, delta := range deltas {
+		if account := a.find(accountID); account != nil {
+			account.Balance += delta
+		}
+	}
+}
+
+// operationError is the message reported for an operation that failed a
+// check. It returns false for any other error, which aborts the batch.
+func operationError(err error) (string, bool) {
+	if reqErr, ok := err.(requestError); ok {
+		return string(reqErr), true
+	}
+	switch err {
+	case errAccountNotFound:
+		return "Account not found", true
+	case errAccountClosed:
+		return "Account is closed", true
+	case errEnvelopeNotFound:
+		return "Envelope not found", true
+	case errTransactionNotFound:
+		return "Transaction not found", true
+	}
+	return "", false
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"testing"
+	"time"
+)
+
+type batchResponse struct {
+	Results []models.TransactionOperationResult `json:"results"`
+	Errors  []models.TransactionOperationError  `json:"errors"`
+}
+
+// batchFixture creates a user with 100.00 of income and expenses of 10.00
+// and 3.00, returning the ids of the expenses.
+func batchFixture(t *testing.T, h *Handler) (userID, first, second int) {
+	t.Helper()
+	userID = newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "100.00", "type": "income", "category": "Allowance", "date": today}), http.StatusCreated, nil)
+	var a, b models.Transaction
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "10.00", "type": "expense", "category": "Food & Dining", "date": today}), http.StatusCreated, &a)
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "3.00", "type": "expense", "category": "Transportation", "date": today}), http.StatusCreated, &b)
+	return userID, a.ID, b.ID
+}
+
+// batchState returns the user's total balance and number of transactions.
+func batchState(t *testing.T, h *Handler, userID int) (models.Money, int) {
+	t.Helper()
+	var balance models.Money
+	var count int
+	err := h.db.QueryRow(`SELECT (SELECT SUM(balance) FROM accounts WHERE user_id = $1),
+		(SELECT COUNT(*) FROM transactions WHERE user_id = $1)`, userID).Scan(&balance, &count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance, count
+}
+
+func TestBatchTransactions(t *testing.T) {
+	h := newTestHandler(t)
+	userID, first, second := batchFixture(t, h)
+	today := time.Now().Format("2006-01-02")
+
+	var response batchResponse
+	decode(t, serve(h.BatchTransactions, userID, http.MethodPost, map[string]interface{}{"operations": []map[string]interface{}{
+		{"op": "create", "transaction": map[string]string{"amount": "2.50", "type": "expense", "category": "Food & Dining", "date": today}},
+		{"op": "patch", "id": first, "transaction": map[string]string{"amount": "15.00"}},
+		{"op": "delete", "id": second},
+	}}), http.StatusOK, &response)
+
+	if len(response.Results) != 3 {
+		t.Fatalf("got %d results, want 3", len(response.Results))
+	}
+	for i, op := range []string{"create", "patch", "delete"} {
+		if result := response.Results[i]; result.Index != i || result.Op != op {
+			t.Errorf("result %d is %d %s, want %d %s", i, result.Index, result.Op, i, op)
+		}
+	}
+	if created := response.Results[0]; created.ID == 0 || created.Transaction == nil || created.Transaction.Amount != 250 {
+		t.Errorf("create result %+v", created)
+	}
+	if patched := response.Results[1].Transaction; patched == nil || patched.ID != first || patched.Amount != 1500 {
+		t.Errorf("patch result %+v", patched)
+	}
+
+	// 100.00 - 2.50 - 15.00
+	if balance, count := batchState(t, h, userID); balance != 8250 || count != 3 {
+		t.Errorf("balance %s with %d transactions, want 82.50 with 3", balance, count)
+	}
+	if err := ledger.Verify(h.db, userID); err != nil {
+		t.Errorf("ledger: %v", err)
+	}
+}
+
+func TestBatchTransactionsAppliesNothingOnError(t *testing.T) {
+	h := newTestHandler(t)
+	userID, first, second := batchFixture(t, h)
+	today := time.Now().Format("2006-01-02")
+	balance, count := batchState(t, h, userID)
+
+	tests := []struct {
+		name       string
+		operations []map[string]interface{}
+		want       []models.TransactionOperationError
+	}{
+		{
+			name: "patch of a missing transaction",
+			operations: []map[string]interface{}{
+				{"op": "create", "transaction": map[string]string{"amount": "1.00", "type": "expense", "category": "Food & Dining", "date": today}},
+				{"op": "delete", "id": first},
+				{"op": "patch", "id": 999999999, "transaction": map[string]string{"amount": "1.00"}},
+			},
+			want: []models.TransactionOperationError{{Index: 2, Error: "Transaction not found"}},
+		},
+		{
+			name: "patch after delete",
+			operations: []map[string]interface{}{
+				{"op": "delete", "id": second},
+				{"op": "patch", "id": second, "transaction": map[string]string{"amount": "1.00"}},
+				{"op": "patch", "id": first, "transaction": map[string]string{"description": "lunch"}},
+			},
+			want: []models.TransactionOperationError{{Index: 1, Error: "Transaction not found"}},
+		},
+		{
+			name: "invalid operations",
+			operations: []map[string]interface{}{
+				{"op": "delete", "id": first},
+				{"op": "create", "transaction": map[string]string{"amount": "1.00", "type": "expense", "date": "yesterday"}},
+				{"op": "patch", "transaction": map[string]string{"amount": "1.00"}},
+			},
+			want: []models.TransactionOperationError{
+				{Index: 1, Error: "Invalid date format. Use YYYY-MM-DD"},
+				{Index: 2, Error: "id is required for patch"},
+			},
+		},
+	}
+	for _, test := range tests {
+		var response batchResponse
+		decode(t, serve(h.BatchTransactions, userID, http.MethodPost, map[string]interface{}{"operations": test.operations}),
+			http.StatusBadRequest, &response)
+		if !reflect.DeepEqual(response.Errors, test.want) {
+			t.Errorf("%s: errors %+v, want %+v", test.name, response.Errors, test.want)
+		}
+		if gotBalance, gotCount := batchState(t, h, userID); gotBalance != balance || gotCount != count {
+			t.Errorf("%s: balance %s with %d transactions, want %s with %d", test.name, gotBalance, gotCount, balance, count)
+		}
+	}
+
+	var description string
+	if err := h.db.QueryRow(`SELECT COALESCE(description, '') FROM transactions WHERE id = $1`, first).Scan(&description); err != nil {
+		t.Fatal(err)
+	}
+	if description != "" {
+		t.Errorf("a rejected batch patched the description to %q", description)
+	}
+	if err := ledger.Verify(h.db, userID); err != nil {
+		t.Errorf("ledger: %v", err)
+	}
+}
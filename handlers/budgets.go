@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"student-money-manager/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Budgets
+
+const budgetColumns = `id, user_id, category, amount, period, rollover, start_date, created_at, updated_at`
+
+// scanBudget reads a row selected with budgetColumns.
+func scanBudget(row rowScanner, b *models.Budget) error {
+	return row.Scan(&b.ID, &b.UserID, &b.Category, &b.Amount, &b.Period, &b.Rollover, &b.StartDate,
+		&b.CreatedAt, &b.UpdatedAt)
+}
+
+func (h *Handler) GetBudgets(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	budgets, err := h.listBudgets(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets})
+}
+
+func (h *Handler) CreateBudget(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := budgetFromRequest(req)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if _, err := resolveCategory(h.db, userID, "expense", nil, budget.Category, nil); err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	query := `INSERT INTO budgets (user_id, category, amount, period, rollover, start_date, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+			  ON CONFLICT (user_id, category, period) DO NOTHING
+			  RETURNING ` + budgetColumns
+
+	err = scanBudget(h.db.QueryRow(query, userID, budget.Category, budget.Amount, budget.Period, budget.Rollover, budget.StartDate), &budget)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "A " + budget.Period + " budget for this category already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create budget"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, budget)
+}
+
+func (h *Handler) UpdateBudget(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	budgetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget ID"})
+		return
+	}
+
+	var req models.BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := budgetFromRequest(req)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if _, err := resolveCategory(h.db, userID, "expense", nil, budget.Category, nil); err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	query := `UPDATE budgets
+			  SET category = $1, amount = $2, period = $3, rollover = $4, start_date = $5, updated_at = NOW()
+			  WHERE id = $6 AND user_id = $7
+			  RETURNING ` + budgetColumns
+
+	err = scanBudget(h.db.QueryRow(query, budget.Category, budget.Amount, budget.Period, budget.Rollover, budget.StartDate,
+		budgetID, userID), &budget)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+			return
+		}
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A " + budget.Period + " budget for this category already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+func (h *Handler) DeleteBudget(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	result, err := h.db.Exec("DELETE FROM budgets WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete budget"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Budget deleted successfully"})
+}
+
+// GetBudgetStatus reports every budget for the period containing ?date=,
+// which defaults to today.
+func (h *Handler) GetBudgetStatus(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	date := time.Now().UTC()
+	if value := c.Query("date"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+			return
+		}
+		date = parsed
+	}
+
+	budgets, err := h.listBudgets(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch budgets"})
+		return
+	}
+
+	statuses := []models.BudgetStatus{}
+	for _, budget := range budgets {
+		status, err := h.budgetStatus(budget, date)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute budget status"})
+			return
+		}
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":     date.Format("2006-01-02"),
+		"statuses": statuses,
+	})
+}
+
+func (h *Handler) listBudgets(userID int) ([]models.Budget, error) {
+	rows, err := h.db.Query(`SELECT `+budgetColumns+` FROM budgets WHERE user_id = $1 ORDER BY category, period`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []models.Budget{}
+	for rows.Next() {
+		var budget models.Budget
+		if err := scanBudget(rows, &budget); err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, rows.Err()
+}
+
+// budgetStatus computes the status of a budget in the period containing
+// date. With rollover the periods since the budget started are walked in
+// order, each carrying its unspent amount into the next.
+func (h *Handler) budgetStatus(budget models.Budget, date time.Time) (models.BudgetStatus, error) {
+	start := budgetPeriodStart(budget.Period, date)
+	end := nextBudgetPeriod(budget.Period, start)
+
+	status := models.BudgetStatus{
+		BudgetID:    budget.ID,
+		Category:    budget.Category,
+		Period:      budget.Period,
+		PeriodStart: start,
+		PeriodEnd:   end.AddDate(0, 0, -1),
+		Limit:       budget.Amount,
+	}
+
+	from := start
+	if budget.Rollover {
+		if first := budgetPeriodStart(budget.Period, budget.StartDate); first.Before(start) {
+			from = first
+		}
+	}
+	spent, err := h.spentByPeriod(budget, from, end)
+	if err != nil {
+		return status, err
+	}
+
+	var carry models.Money
+	for period := from; period.Before(start); period = nextBudgetPeriod(budget.Period, period) {
+		left := budget.Amount + carry - spent[period.Format("2006-01-02")]
+		carry = 0
+		if left > 0 {
+			carry = left
+		}
+	}
+
+	status.RolloverAmount = carry
+	status.Available = budget.Amount + carry
+	status.Spent = spent[start.Format("2006-01-02")]
+	status.Remaining = status.Available - status.Spent
+	if status.Available > 0 {
+		status.PercentUsed = math.Round(float64(status.Spent)*1000/float64(status.Available)) / 10
+	}
+
+	// Extrapolate from the days elapsed so far; past periods are complete
+	status.Projected = status.Spent
+	today := time.Now().UTC()
+	if !today.Before(start) && today.Before(end) {
+		elapsed := int64(today.Sub(start).Hours()/24) + 1
+		total := int64(end.Sub(start).Hours() / 24)
+		status.Projected = models.Money(int64(status.Spent) * total / elapsed)
+	}
+
+	status.OverBudget = status.Spent > status.Available
+	status.ProjectedOverBudget = status.Projected > status.Available
+	return status, nil
+}
+
+// spentByPeriod sums the expenses of the budget's category and its
+// subcategories in [from, to), keyed by the start date of each period.
+// Splits count towards their own category.
+func (h *Handler) spentByPeriod(budget models.Budget, from, to time.Time) (map[string]models.Money, error) {
+	query := `SELECT TO_CHAR(DATE_TRUNC($2, t.date), 'YYYY-MM-DD'), SUM(COALESCE(s.amount, t.amount))
+			  FROM transactions t
+			  LEFT JOIN transaction_splits s ON s.transaction_id = t.id
+			  WHERE t.user_id = $1 AND t.type = 'expense'
+			  AND (COALESCE(s.category, t.category) = $3
+			       OR COALESCE(s.category_id, t.category_id) IN ` + categorySubtree("type = 'expense' AND name = $3") + `)
+			  AND t.date >= $4 AND t.date < $5
+			  GROUP BY 1`
+	rows, err := h.db.Query(query, budget.UserID, budgetTrunc[budget.Period], budget.Category, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spent := map[string]models.Money{}
+	for rows.Next() {
+		var period string
+		var amount models.Money
+		if err := rows.Scan(&period, &amount); err != nil {
+			return nil, err
+		}
+		spent[period] = amount
+	}
+	return spent, rows.Err()
+}
+
+// budgetTrunc maps a budget period to its DATE_TRUNC field.
+var budgetTrunc = map[string]string{
+	"weekly":  "week",
+	"monthly": "month",
+	"yearly":  "year",
+}
+
+// budgetPeriodStart returns the first day of the period containing date.
+// Weeks start on Monday, as they do for DATE_TRUNC('week').
+func budgetPeriodStart(period string, date time.Time) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "weekly":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "yearly":
+		return time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// nextBudgetPeriod returns the start of the period after the one starting on
+// start.
+func nextBudgetPeriod(period string, start time.Time) time.Time {
+	switch period {
+	case "weekly":
+		return start.AddDate(0, 0, 7)
+	case "yearly":
+		return start.AddDate(1, 0, 0)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// budgetFromRequest validates a budget request.
+func budgetFromRequest(req models.BudgetRequest) (models.Budget, error) {
+	budget := models.Budget{
+		Category:  req.Category,
+		Amount:    req.Amount,
+		Period:    req.Period,
+		Rollover:  req.Rollover,
+		StartDate: time.Now().UTC(),
+	}
+	if budget.Period == "" {
+		budget.Period = "monthly"
+	}
+	if budget.Category == transferCategory || budget.Category == splitCategory {
+		return budget, requestError("'" + budget.Category + "' cannot be budgeted")
+	}
+	if req.StartDate != nil && *req.StartDate != "" {
+		start, err := time.Parse("2006-01-02", *req.StartDate)
+		if err != nil {
+			return budget, requestError("Invalid start_date format. Use YYYY-MM-DD")
+		}
+		budget.StartDate = start
+	}
+	budget.StartDate = budgetPeriodStart(budget.Period, budget.StartDate)
+	return budget, nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"student-money-manager/models"
+	"testing"
+	"time"
+)
+
+// TestBudgetCountsSubcategories checks that a budget's spending includes the
+// expenses booked on subcategories of its category.
+func TestBudgetCountsSubcategories(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+
+	food := categoryID(t, h, userID, "expense", "Food & Dining")
+	decode(t, serve(h.CreateCategory, userID, http.MethodPost, map[string]interface{}{"name": "Groceries", "type": "expense", "parent_id": food}),
+		http.StatusCreated, nil)
+	decode(t, serve(h.CreateBudget, userID, http.MethodPost, map[string]string{"category": "Food & Dining", "amount": "50.00"}),
+		http.StatusCreated, nil)
+
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost, map[string]string{"amount": "100.00", "type": "income", "category": "Allowance", "date": today}),
+		http.StatusCreated, nil)
+	for _, expense := range []struct{ amount, category string }{
+		{"15.00", "Groceries"},
+		{"5.00", "Food & Dining"},
+		{"7.00", "Technology"},
+	} {
+		decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+			map[string]string{"amount": expense.amount, "type": "expense", "category": expense.category, "date": today}),
+			http.StatusCreated, nil)
+	}
+
+	var response struct {
+		Statuses []models.BudgetStatus `json:"statuses"`
+	}
+	decode(t, serve(h.GetBudgetStatus, userID, http.MethodGet, nil), http.StatusOK, &response)
+	if len(response.Statuses) != 1 {
+		t.Fatalf("got %d budget statuses, want 1", len(response.Statuses))
+	}
+	if spent := response.Statuses[0].Spent; spent != 2000 {
+		t.Errorf("spent %d, want 2000", spent)
+	}
+}
@@ -0,0 +1,718 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Categories
+
+const categoryColumns = `id, user_id, parent_id, name, type, color, icon, archived_at, created_at, updated_at`
+
+// scanCategory reads a row selected with categoryColumns.
+func scanCategory(row rowScanner, cat *models.Category) error {
+	return row.Scan(&cat.ID, &cat.UserID, &cat.ParentID, &cat.Name, &cat.Type, &cat.Color, &cat.Icon, &cat.ArchivedAt,
+		&cat.CreatedAt, &cat.UpdatedAt)
+}
+
+// seedCategories gives a new user the default categories.
+func seedCategories(q ledger.Querier, userID int) error {
+	query := `INSERT INTO categories (user_id, name, type, created_at, updated_at)
+			  VALUES ($1, $2, $3, NOW(), NOW())
+			  ON CONFLICT (user_id, type, name) DO NOTHING`
+	for _, categoryType := range []string{"income", "expense"} {
+		for _, name := range models.StudentCategories[categoryType] {
+			if _, err := q.Exec(query, userID, name, categoryType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// listCategories reads the user's categories, archived ones only when asked.
+func listCategories(q ledger.Querier, userID int, includeArchived bool) ([]models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM categories
+			  WHERE user_id = $1 AND ($2 OR archived_at IS NULL)
+			  ORDER BY type, name`
+	rows, err := q.Query(query, userID, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var cat models.Category
+		if err := scanCategory(rows, &cat); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// GetCategories lists the user's categories. ?type= filters by type and
+// ?include_archived=true adds archived ones.
+func (h *Handler) GetCategories(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	categoryType := c.Query("type")
+	if categoryType != "" && categoryType != "income" && categoryType != "expense" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be income or expense"})
+		return
+	}
+
+	categories, err := listCategories(h.db, userID, c.Query("include_archived") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	filtered := []models.Category{}
+	for _, cat := range categories {
+		if categoryType == "" || cat.Type == categoryType {
+			filtered = append(filtered, cat)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": filtered})
+}
+
+func (h *Handler) CreateCategory(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if isReservedCategory(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'" + req.Name + "' is reserved"})
+		return
+	}
+
+	if req.ParentID != nil {
+		if err := checkCategoryParent(h.db, userID, 0, req.Type, *req.ParentID); err != nil {
+			respondCategoryError(c, err)
+			return
+		}
+	}
+
+	var cat models.Category
+	query := `INSERT INTO categories (user_id, parent_id, name, type, color, icon, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+			  RETURNING ` + categoryColumns
+
+	err := scanCategory(h.db.QueryRow(query, userID, req.ParentID, req.Name, req.Type, req.Color, req.Icon), &cat)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A " + req.Type + " category with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, cat)
+}
+
+// PatchCategory changes the color, icon, parent or archived state of a
+// category, or renames it. A rename is applied in one database transaction to the
+// transactions, splits, recurring rules, budgets and envelopes using the
+// category and to its ledger account, so history reads as if it had always
+// had the new name.
+func (h *Handler) PatchCategory(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var req models.CategoryPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != nil && isReservedCategory(*req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'" + *req.Name + "' is reserved"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The account locks keep transaction writes out while history is renamed
+	if _, err := lockAccounts(tx, userID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	var old models.Category
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	if err := scanCategory(tx.QueryRow(query, categoryID, userID), &old); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		return
+	}
+
+	if req.ParentID != nil && *req.ParentID != 0 {
+		if err := checkCategoryParent(tx, userID, old.ID, old.Type, *req.ParentID); err != nil {
+			respondCategoryError(c, err)
+			return
+		}
+	}
+
+	var cat models.Category
+	query = `UPDATE categories
+			 SET name = COALESCE($1, name), color = COALESCE($2, color), icon = COALESCE($3, icon),
+			 archived_at = CASE WHEN $4::boolean IS NULL THEN archived_at
+								WHEN $4 THEN COALESCE(archived_at, NOW()) ELSE NULL END,
+			 parent_id = CASE WHEN $5::integer IS NULL THEN parent_id ELSE NULLIF($5, 0) END,
+			 updated_at = NOW()
+			 WHERE id = $6 AND user_id = $7
+			 RETURNING ` + categoryColumns
+	err = scanCategory(tx.QueryRow(query, req.Name, req.Color, req.Icon, req.Archived, req.ParentID, categoryID, userID), &cat)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A " + old.Type + " category with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+
+	if cat.Name != old.Name {
+		if err := renameCategoryHistory(tx, userID, old, cat.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename category history"})
+			return
+		}
+		if err := ledger.Verify(tx, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cat)
+}
+
+// MergeCategory moves every transaction, split, recurring rule, budget,
+// envelope and subcategory of a category into another category of the same
+// type, folds its ledger account into the other one and deletes it. A budget
+// or envelope the target already has for the same purpose wins; the
+// category's own one is dropped. With preview set the counts are reported
+// and nothing is changed.
+func (h *Handler) MergeCategory(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var req models.CategoryMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.IntoID == categoryID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot merge a category into itself"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The account locks keep transaction writes out while history moves
+	if _, err := lockAccounts(tx, userID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	var source models.Category
+	query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	if err := scanCategory(tx.QueryRow(query, categoryID, userID), &source); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		return
+	}
+
+	into, err := resolveCategory(tx, userID, source.Type, &req.IntoID, "", nil)
+	if err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	result, err := mergeCategory(tx, userID, source, into)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge category"})
+		return
+	}
+	if req.Preview {
+		result.Preview = true
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// mergeCategory moves everything that uses source over to into and deletes
+// source. It is run for previews too, whose transaction is rolled back.
+func mergeCategory(tx *sql.Tx, userID int, source, into models.Category) (models.CategoryMergeResult, error) {
+	var result models.CategoryMergeResult
+	var err error
+
+	result.Transactions, err = execCount(tx, `UPDATE transactions SET category_id = $1, category = $2, updated_at = NOW()
+		WHERE user_id = $3 AND category_id = $4`, into.ID, into.Name, userID, source.ID)
+	if err != nil {
+		return result, err
+	}
+	result.Splits, err = execCount(tx, `UPDATE transaction_splits SET category_id = $1, category = $2 WHERE category_id = $3`,
+		into.ID, into.Name, source.ID)
+	if err != nil {
+		return result, err
+	}
+	result.RecurringRules, err = execCount(tx, `UPDATE recurring_rules SET category = $1, updated_at = NOW()
+		WHERE user_id = $2 AND type = $3 AND category = $4`, into.Name, userID, source.Type, source.Name)
+	if err != nil {
+		return result, err
+	}
+
+	if source.Type == "expense" {
+		result.Budgets, err = execCount(tx, `UPDATE budgets SET category = $1, updated_at = NOW()
+			WHERE user_id = $2 AND category = $3
+			AND period NOT IN (SELECT period FROM budgets WHERE user_id = $2 AND category = $1)`, into.Name, userID, source.Name)
+		if err != nil {
+			return result, err
+		}
+		if _, err := tx.Exec(`DELETE FROM budgets WHERE user_id = $1 AND category = $2`, userID, source.Name); err != nil {
+			return result, err
+		}
+
+		result.Envelopes, err = execCount(tx, `UPDATE envelopes SET category = $1, updated_at = NOW()
+			WHERE user_id = $2 AND category = $3
+			AND NOT EXISTS (SELECT 1 FROM envelopes e WHERE e.user_id = $2 AND e.category = $1)`, into.Name, userID, source.Name)
+		if err != nil {
+			return result, err
+		}
+		_, err = tx.Exec(`UPDATE envelopes SET category = NULL, updated_at = NOW() WHERE user_id = $1 AND category = $2`,
+			userID, source.Name)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// A target inside the source's subtree first takes the source's place,
+	// so moving the subcategories under it cannot create a cycle
+	inside, err := isAncestor(tx, source.ID, into.ID)
+	if err != nil {
+		return result, err
+	}
+	if inside {
+		_, err := tx.Exec(`UPDATE categories SET parent_id = $1, updated_at = NOW() WHERE id = $2`, source.ParentID, into.ID)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Subcategories, err = execCount(tx, `UPDATE categories SET parent_id = $1, updated_at = NOW() WHERE parent_id = $2`,
+		into.ID, source.ID)
+	if err != nil {
+		return result, err
+	}
+
+	if err := ledger.RenameAccount(tx, userID, categoryAccount(source), categoryAccount(into)); err != nil {
+		return result, err
+	}
+	_, err = tx.Exec(`DELETE FROM categories WHERE id = $1`, source.ID)
+	return result, err
+}
+
+// RecategorizeTransactions moves every income or expense matching a filter
+// into one category, re-posting each to the ledger account of its new
+// category. Expenses move to the envelope of their new category, or out of
+// any envelope when it has none, as if the category were patched.
+// Transfers, split transactions and transactions of the other type are left
+// alone. With preview set the matches are reported and nothing is changed.
+func (h *Handler) RecategorizeTransactions(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.RecategorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if isEmptyFilter(req.Filter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filter must not be empty"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := lockAccounts(tx, userID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	target, err := resolveCategory(tx, userID, "", &req.CategoryID, "", nil)
+	if err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	query, args, err := filterTransactions(`SELECT `+transactionColumns+` FROM transactions
+		WHERE user_id = $1 AND type = $2 AND category <> $3 AND category_id IS DISTINCT FROM $4`,
+		[]interface{}{userID, target.Type, splitCategory, target.ID}, req.Filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	rows, err := tx.Query(query+" ORDER BY id FOR UPDATE", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
+	var transactions []models.Transaction
+	for rows.Next() {
+		var t models.Transaction
+		if err := scanTransaction(rows, &t); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan transaction"})
+			return
+		}
+		transactions = append(transactions, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
+		return
+	}
+
+	result := models.RecategorizeResult{
+		Preview:        req.Preview,
+		Affected:       len(transactions),
+		TransactionIDs: []int{},
+	}
+	for _, t := range transactions {
+		result.TransactionIDs = append(result.TransactionIDs, t.ID)
+	}
+	if req.Preview {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	for _, t := range transactions {
+		old := t
+		t.CategoryID, t.Category = &target.ID, target.Name
+		if err := checkEnvelope(tx, userID, &old, &t, true); err != nil {
+			if reqErr, ok := err.(requestError); ok {
+				err = requestError("Transaction " + strconv.Itoa(t.ID) + ": " + string(reqErr))
+			}
+			respondEnvelopeError(c, err)
+			return
+		}
+		_, err := tx.Exec(`UPDATE transactions SET category_id = $1, category = $2, envelope_id = $3, updated_at = NOW() WHERE id = $4`,
+			t.CategoryID, t.Category, t.EnvelopeID, t.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
+			return
+		}
+		if err := ledger.ReverseTransaction(tx, userID, t.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse journal entry"})
+			return
+		}
+		if _, err := ledger.Post(tx, ledger.ForTransaction(t)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record journal entry"})
+			return
+		}
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// execCount runs a statement and returns the number of rows it changed.
+func execCount(tx *sql.Tx, query string, args ...interface{}) (int, error) {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// renameCategoryHistory writes the new name of a category everywhere the
+// old one is stored.
+func renameCategoryHistory(tx *sql.Tx, userID int, old models.Category, name string) error {
+	_, err := tx.Exec(`UPDATE transactions SET category = $1 WHERE user_id = $2 AND category_id = $3`,
+		name, userID, old.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE transaction_splits SET category = $1 WHERE category_id = $2`, name, old.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE recurring_rules SET category = $1 WHERE user_id = $2 AND type = $3 AND category = $4`,
+		name, userID, old.Type, old.Name)
+	if err != nil {
+		return err
+	}
+	if old.Type == "expense" {
+		for _, table := range []string{"budgets", "envelopes"} {
+			_, err := tx.Exec(`UPDATE `+table+` SET category = $1 WHERE user_id = $2 AND category = $3`,
+				name, userID, old.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	renamed := old
+	renamed.Name = name
+	return ledger.RenameAccount(tx, userID, categoryAccount(old), categoryAccount(renamed))
+}
+
+// categoryAccount is the ledger account transactions in a category are
+// posted to.
+func categoryAccount(cat models.Category) string {
+	if cat.Type == "expense" {
+		return ledger.ExpenseAccount(cat.Name)
+	}
+	return ledger.IncomeAccount(cat.Name)
+}
+
+// checkCategoryParent makes sure parentID is one of the user's categories of
+// the given type and that categoryID, which is 0 for a new category, is not
+// the parent itself or one of its ancestors.
+func checkCategoryParent(q ledger.Querier, userID, categoryID int, categoryType string, parentID int) error {
+	if _, err := resolveCategory(q, userID, categoryType, &parentID, "", nil); err != nil {
+		return err
+	}
+	if categoryID == 0 {
+		return nil
+	}
+
+	cycle, err := isAncestor(q, categoryID, parentID)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return requestError("A category cannot be moved under itself or one of its subcategories")
+	}
+	return nil
+}
+
+// isAncestor reports whether ancestorID is categoryID itself or one of its
+// ancestors.
+func isAncestor(q ledger.Querier, ancestorID, categoryID int) (bool, error) {
+	var found bool
+	query := `WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+			  )
+			  SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+	err := q.QueryRow(query, categoryID, ancestorID).Scan(&found)
+	return found, err
+}
+
+// categorySubtree is a subquery selecting the ids of the categories of the
+// user in $1 that match where, together with all of their descendants.
+func categorySubtree(where string) string {
+	return `(WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE user_id = $1 AND ` + where + `
+				UNION ALL
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			 ) SELECT id FROM subtree)`
+}
+
+// categoryTree arranges categories under their parents and rolls the totals
+// of each category up into all of its ancestors. Archived categories are
+// left out unless something was booked on them or below them.
+func categoryTree(categories []models.Category, amounts map[int]models.Money, counts map[int]int) []*models.CategoryNode {
+	nodes := make(map[int]*models.CategoryNode, len(categories))
+	archived := map[int]bool{}
+	for _, cat := range categories {
+		nodes[cat.ID] = &models.CategoryNode{
+			ID:       cat.ID,
+			Name:     cat.Name,
+			Type:     cat.Type,
+			ParentID: cat.ParentID,
+			Amount:   amounts[cat.ID],
+			Count:    counts[cat.ID],
+			Children: []*models.CategoryNode{},
+		}
+		archived[cat.ID] = cat.ArchivedAt != nil
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, cat := range categories {
+		node := nodes[cat.ID]
+		if cat.ParentID != nil && nodes[*cat.ParentID] != nil {
+			parent := nodes[*cat.ParentID]
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	var rollUp func(nodes []*models.CategoryNode) []*models.CategoryNode
+	rollUp = func(nodes []*models.CategoryNode) []*models.CategoryNode {
+		kept := []*models.CategoryNode{}
+		for _, node := range nodes {
+			node.Children = rollUp(node.Children)
+			node.Total, node.TotalCount = node.Amount, node.Count
+			for _, child := range node.Children {
+				node.Total += child.Total
+				node.TotalCount += child.TotalCount
+			}
+			if archived[node.ID] && node.TotalCount == 0 {
+				continue
+			}
+			kept = append(kept, node)
+		}
+		return kept
+	}
+	return rollUp(roots)
+}
+
+// resolveCategory finds the user's category of the given type, by id when
+// one is given and by name otherwise. An empty categoryType accepts either
+// type when looking up by id. Archived categories are only accepted when
+// allowArchived says so, which keeps old transactions editable.
+func resolveCategory(q ledger.Querier, userID int, categoryType string, id *int, name string, allowArchived map[int]bool) (models.Category, error) {
+	var cat models.Category
+	var err error
+	if id != nil {
+		query := `SELECT ` + categoryColumns + ` FROM categories WHERE id = $1 AND user_id = $2`
+		err = scanCategory(q.QueryRow(query, *id, userID), &cat)
+	} else {
+		query := `SELECT ` + categoryColumns + ` FROM categories WHERE user_id = $1 AND type = $2 AND name = $3`
+		err = scanCategory(q.QueryRow(query, userID, categoryType, name), &cat)
+	}
+	if err == sql.ErrNoRows {
+		if id != nil {
+			return cat, requestError("Unknown category ID " + strconv.Itoa(*id))
+		}
+		return cat, requestError("Unknown " + categoryType + " category '" + name + "'")
+	}
+	if err != nil {
+		return cat, err
+	}
+
+	if categoryType != "" && cat.Type != categoryType {
+		return cat, requestError("'" + cat.Name + "' is not an " + categoryType + " category")
+	}
+	if cat.ArchivedAt != nil && !allowArchived[cat.ID] {
+		return cat, requestError("Category '" + cat.Name + "' is archived")
+	}
+	return cat, nil
+}
+
+// resolveTransactionCategories validates the categories of an income or
+// expense and of its splits, filling in both ids and names. old is the
+// version being replaced, or nil; categories it already used may be
+// archived.
+func resolveTransactionCategories(q ledger.Querier, userID int, old, t *models.Transaction) error {
+	if t.Type == "transfer" || len(t.Splits) > 0 {
+		t.CategoryID = nil
+	}
+	if t.Type == "transfer" {
+		return nil
+	}
+
+	allowArchived := map[int]bool{}
+	if old != nil {
+		if old.CategoryID != nil {
+			allowArchived[*old.CategoryID] = true
+		}
+		for _, split := range old.Splits {
+			if split.CategoryID != nil {
+				allowArchived[*split.CategoryID] = true
+			}
+		}
+	}
+
+	if len(t.Splits) == 0 {
+		cat, err := resolveCategory(q, userID, t.Type, t.CategoryID, t.Category, allowArchived)
+		if err != nil {
+			return err
+		}
+		t.CategoryID, t.Category = &cat.ID, cat.Name
+		return nil
+	}
+
+	for i := range t.Splits {
+		split := &t.Splits[i]
+		cat, err := resolveCategory(q, userID, t.Type, split.CategoryID, split.Category, allowArchived)
+		if err != nil {
+			return err
+		}
+		split.CategoryID, split.Category = &cat.ID, cat.Name
+	}
+	return nil
+}
+
+func isReservedCategory(name string) bool {
+	return name == transferCategory || name == splitCategory
+}
+
+// respondCategoryError writes the response for an error from category
+// resolution.
+func respondCategoryError(c *gin.Context, err error) {
+	if reqErr, ok := err.(requestError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": string(reqErr)})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check category"})
+}
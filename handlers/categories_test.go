@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"student-money-manager/database"
+	"student-money-manager/models"
+	"testing"
+	"time"
+)
+
+// TestRecategorizeMovesEnvelope checks that recategorized expenses draw
+// from the envelope of their new category.
+func TestRecategorizeMovesEnvelope(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+
+	var food, books models.Envelope
+	decode(t, serve(h.CreateEnvelope, userID, http.MethodPost, map[string]interface{}{"name": "Food", "category": "Food & Dining"}),
+		http.StatusCreated, &food)
+	decode(t, serve(h.CreateEnvelope, userID, http.MethodPost, map[string]interface{}{"name": "Books", "category": "Books & Supplies", "strict": true}),
+		http.StatusCreated, &books)
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost, map[string]string{"amount": "100.00", "type": "income", "category": "Allowance", "date": today}),
+		http.StatusCreated, nil)
+	decode(t, serve(h.MoveEnvelopeMoney, userID, http.MethodPost, map[string]interface{}{"to_envelope_id": books.ID, "amount": "20.00"}),
+		http.StatusCreated, nil)
+
+	var expense models.Transaction
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "15.00", "type": "expense", "category": "Food & Dining", "description": "textbook", "date": today}),
+		http.StatusCreated, &expense)
+	if expense.EnvelopeID == nil || *expense.EnvelopeID != food.ID {
+		t.Fatalf("expense envelope = %v, want %d", expense.EnvelopeID, food.ID)
+	}
+
+	booksID := categoryID(t, h, userID, "expense", "Books & Supplies")
+	recategorize := map[string]interface{}{"filter": map[string]string{"description": "textbook"}, "category_id": booksID}
+	decode(t, serve(h.RecategorizeTransactions, userID, http.MethodPost, recategorize), http.StatusOK, nil)
+
+	var envelopeID *int
+	if err := h.db.QueryRow(`SELECT envelope_id FROM transactions WHERE id = $1`, expense.ID).Scan(&envelopeID); err != nil {
+		t.Fatal(err)
+	}
+	if envelopeID == nil || *envelopeID != books.ID {
+		t.Errorf("envelope after recategorizing = %v, want %d", envelopeID, books.ID)
+	}
+
+	// Books has 5.00 left, too little for a second expense
+	var second models.Transaction
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "10.00", "type": "expense", "category": "Food & Dining", "description": "textbook", "date": today}),
+		http.StatusCreated, &second)
+	decode(t, serve(h.RecategorizeTransactions, userID, http.MethodPost, recategorize), http.StatusBadRequest, nil)
+	var category string
+	if err := h.db.QueryRow(`SELECT category, envelope_id FROM transactions WHERE id = $1`, second.ID).Scan(&category, &envelopeID); err != nil {
+		t.Fatal(err)
+	}
+	if category != "Food & Dining" || envelopeID == nil || *envelopeID != food.ID {
+		t.Errorf("rejected recategorization changed the expense to %s in envelope %v", category, envelopeID)
+	}
+}
+
+// categoryID returns the id of a category, or 0 if the user has none of
+// that name.
+func categoryID(t *testing.T, h *Handler, userID int, kind, name string) int {
+	t.Helper()
+	var id int
+	err := h.db.QueryRow(`SELECT id FROM categories WHERE user_id = $1 AND type = $2 AND name = $3`,
+		userID, kind, name).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// TestRenamedDefaultCategoryStaysRenamed checks that migrating again does
+// not bring back the old name of a renamed default category.
+func TestRenamedDefaultCategoryStaysRenamed(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+
+	id := categoryID(t, h, userID, "expense", "Food & Dining")
+	decode(t, serve(h.PatchCategory, userID, http.MethodPatch, map[string]string{"name": "Food"}, "id", strconv.Itoa(id)),
+		http.StatusOK, nil)
+	if err := database.Migrate(h.db); err != nil {
+		t.Fatal(err)
+	}
+
+	if categoryID(t, h, userID, "expense", "Food & Dining") != 0 {
+		t.Error("Food & Dining came back after migrating")
+	}
+	if categoryID(t, h, userID, "expense", "Food") != id {
+		t.Error("the renamed category is gone")
+	}
+}
+
+// TestMergedDefaultCategoryStaysMerged checks that migrating again does not
+// re-create a default category merged into another.
+func TestMergedDefaultCategoryStaysMerged(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "20.00", "type": "income", "category": "Allowance", "date": today}), http.StatusCreated, nil)
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "4.00", "type": "expense", "category": "Technology", "date": today}), http.StatusCreated, nil)
+
+	source := categoryID(t, h, userID, "expense", "Technology")
+	into := categoryID(t, h, userID, "expense", "Books & Supplies")
+	decode(t, serve(h.MergeCategory, userID, http.MethodPost, map[string]int{"into_id": into}, "id", strconv.Itoa(source)),
+		http.StatusOK, nil)
+	if err := database.Migrate(h.db); err != nil {
+		t.Fatal(err)
+	}
+
+	if categoryID(t, h, userID, "expense", "Technology") != 0 {
+		t.Error("Technology came back after migrating")
+	}
+	var category string
+	if err := h.db.QueryRow(`SELECT category FROM transactions WHERE user_id = $1 AND type = 'expense'`, userID).Scan(&category); err != nil {
+		t.Fatal(err)
+	}
+	if category != "Books & Supplies" {
+		t.Errorf("merged expense is in %s, want Books & Supplies", category)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentBalanceUpdates runs creates, deletes and savings transfers
+// in parallel and checks that no balance update was lost.
+func TestConcurrentBalanceUpdates(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+	const n = 25
+
+	transaction := func(amount, kind, category string) map[string]string {
+		return map[string]string{"amount": amount, "type": kind, "category": category, "date": today}
+	}
+	if w := serve(h.CreateTransaction, userID, http.MethodPost, transaction("1000.00", "income", "Allowance")); w.Code != http.StatusCreated {
+		t.Fatalf("seed income: %d %s", w.Code, w.Body)
+	}
+	// Expenses deleted below, in parallel with everything else
+	var doomed []int
+	for i := 0; i < n; i++ {
+		w := serve(h.CreateTransaction, userID, http.MethodPost, transaction("0.50", "expense", "Food & Dining"))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create expense: %d %s", w.Code, w.Body)
+		}
+		var created models.Transaction
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Fatal(err)
+		}
+		doomed = append(doomed, created.ID)
+	}
+
+	type call struct {
+		name string
+		run  func() int
+	}
+	var calls []call
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(doomed[i])
+		calls = append(calls,
+			call{"income", func() int {
+				return serve(h.CreateTransaction, userID, http.MethodPost, transaction("1.01", "income", "Part-time Job")).Code
+			}},
+			call{"expense", func() int {
+				return serve(h.CreateTransaction, userID, http.MethodPost, transaction("0.37", "expense", "Food & Dining")).Code
+			}},
+			call{"delete", func() int {
+				return serve(h.DeleteTransaction, userID, http.MethodDelete, nil, "id", id).Code
+			}},
+			call{"transfer", func() int {
+				return serve(h.TransferToSavings, userID, http.MethodPost, map[string]string{"amount": "2.00", "type": "to_savings"}).Code
+			}},
+		)
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(calls))
+	for i := range calls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = calls[i].run()
+		}(i)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		if code >= 300 {
+			t.Errorf("%s: status %d", calls[i].name, code)
+		}
+	}
+
+	var balance, savings models.Money
+	err := h.db.QueryRow("SELECT COALESCE(SUM(balance), 0), COALESCE(SUM(savings_balance), 0) FROM accounts WHERE user_id = $1",
+		userID).Scan(&balance, &savings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := models.Money(100000 + n*101 - n*37 - n*200); balance != want {
+		t.Errorf("balance = %s, want %s", balance, want)
+	}
+	if want := models.Money(n * 200); savings != want {
+		t.Errorf("savings balance = %s, want %s", savings, want)
+	}
+	if err := ledger.Verify(h.db, userID); err != nil {
+		t.Errorf("ledger: %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"student-money-manager/duplicates"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Duplicate transactions
+
+// GetDuplicates lists pairs of transactions that are likely recorded twice:
+// the same amount, type and transfer destination, at most ?days= apart
+// (default 3, at most 30), scored at least ?min_confidence= (default 0.6).
+// Pairs the user dismissed, two rows imported from the bank under different
+// ids for the same wallet, and two occurrences of one recurring rule are
+// never reported. The filters of GetTransactions narrow the transactions
+// compared, and limit and offset page through the pairs, most likely first.
+func (h *Handler) GetDuplicates(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	window, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(duplicates.DefaultWindow)))
+	if err != nil || window < 0 || window > duplicates.MaxWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 0 and " + strconv.Itoa(duplicates.MaxWindow)})
+		return
+	}
+	minConfidence, err := strconv.ParseFloat(c.DefaultQuery("min_confidence", strconv.FormatFloat(duplicates.DefaultMinConfidence, 'f', -1, 64)), 64)
+	if err != nil || minConfidence < 0 || minConfidence > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_confidence must be between 0 and 1"})
+		return
+	}
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	limit, offset, err := parseLimit(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	conditions, args, err := filterTransactions("", []interface{}{userID}, filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	args = append(args, window)
+	query := `WITH candidates AS (SELECT ` + transactionColumns + ` FROM transactions WHERE user_id = $1` + conditions + `)
+			  SELECT a.*, b.* FROM candidates a
+			  JOIN candidates b ON b.id > a.id AND b.amount = a.amount AND b.type = a.type
+			  AND b.to_account_id IS NOT DISTINCT FROM a.to_account_id
+			  AND ABS(b.date::date - a.date::date) <= $` + strconv.Itoa(len(args)) + `
+			  WHERE (a.recurring_rule_id IS NULL OR a.recurring_rule_id IS DISTINCT FROM b.recurring_rule_id)
+			  AND NOT EXISTS (SELECT 1 FROM duplicate_dismissals d WHERE d.transaction_id = a.id AND d.duplicate_id = b.id)
+			  AND NOT EXISTS (SELECT 1 FROM imported_transactions ia
+			                  JOIN imported_transactions ib ON ib.account_id = ia.account_id
+			                  WHERE ia.transaction_id = a.id AND ib.transaction_id = b.id)
+			  ORDER BY a.id, b.id`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find duplicates"})
+		return
+	}
+	defer rows.Close()
+
+	var pairs [][2]int
+	byID := map[int]int{}
+	var transactions []models.Transaction
+	for rows.Next() {
+		var a, b models.Transaction
+		if err := rows.Scan(append(transactionFields(&a), transactionFields(&b)...)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan transaction"})
+			return
+		}
+		var pair [2]int
+		for i, t := range []models.Transaction{a, b} {
+			index, ok := byID[t.ID]
+			if !ok {
+				index = len(transactions)
+				byID[t.ID] = index
+				transactions = append(transactions, t)
+			}
+			pair[i] = index
+		}
+		pairs = append(pairs, pair)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find duplicates"})
+		return
+	}
+
+	// Splits decide whether the categories agree, and tags help the review
+	if err := loadSplits(h.db, transactions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch splits"})
+		return
+	}
+	if err := loadTags(h.db, transactions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	candidates := []models.DuplicateCandidate{}
+	for _, pair := range pairs {
+		a, b := transactions[pair[0]], transactions[pair[1]]
+		match := duplicates.Score(a, b, window)
+		if match.Confidence < minConfidence {
+			continue
+		}
+		candidates = append(candidates, models.DuplicateCandidate{
+			Transaction:           a,
+			Duplicate:             b,
+			Confidence:            match.Confidence,
+			DescriptionSimilarity: match.DescriptionSimilarity,
+			DaysApart:             match.DaysApart,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].Duplicate.Date.After(candidates[j].Duplicate.Date)
+	})
+
+	total := len(candidates)
+	candidates = candidates[min(offset, total):min(offset+limit, total)]
+	c.JSON(http.StatusOK, gin.H{
+		"duplicates": candidates,
+		"count":      len(candidates),
+		"total":      total,
+	})
+}
+
+// MergeDuplicates keeps transaction_id and deletes duplicate_id, which must
+// have the same amount and type. The kept transaction gains the duplicate's
+// tags, attachments and import records, and its recurring rule where it has
+// none of its own, so the bank row or occurrence is not booked again. The wallet
+// balances lose the duplicate in the same database transaction.
+func (h *Handler) MergeDuplicates(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.DuplicatePairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TransactionID == req.DuplicateID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot merge a transaction with itself"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	accounts, err := lockAccounts(tx, userID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	// Lock the pair in id order, as concurrent merges may name it either way
+	locked := map[int]*models.Transaction{}
+	for _, id := range []int{min(req.TransactionID, req.DuplicateID), max(req.TransactionID, req.DuplicateID)} {
+		var t models.Transaction
+		if err := lockTransaction(tx, id, userID, &t); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction"})
+			return
+		}
+		locked[id] = &t
+	}
+	kept, duplicate := *locked[req.TransactionID], *locked[req.DuplicateID]
+	if kept.Amount != duplicate.Amount || kept.Type != duplicate.Type {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only transactions with the same amount and type can be merged"})
+		return
+	}
+	if err := checkOpen(accounts, kept); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	if err := moveDuplicate(tx, kept.ID, duplicate.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge transactions"})
+		return
+	}
+	var occurrence *time.Time
+	if err := tx.QueryRow(`SELECT occurrence_date FROM transactions WHERE id = $1`, duplicate.ID).Scan(&occurrence); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge transactions"})
+		return
+	}
+
+	deleted, hashes, err := deleteOperation(tx, userID, accounts, duplicate.ID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if err := applyBalanceChanges(tx, &deleted, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
+		return
+	}
+
+	// The occurrence moves once the duplicate no longer holds it
+	query := `UPDATE transactions
+			  SET occurrence_date = CASE WHEN recurring_rule_id IS NULL THEN $1 ELSE occurrence_date END,
+			  recurring_rule_id = COALESCE(recurring_rule_id, $2), updated_at = NOW()
+			  WHERE id = $3 AND user_id = $4
+			  RETURNING ` + transactionColumns
+	if err := scanTransaction(tx.QueryRow(query, occurrence, duplicate.RecurringRuleID, kept.ID, userID), &kept); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge transactions"})
+		return
+	}
+
+	merged := []models.Transaction{kept}
+	if err := loadSplits(tx, merged); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch splits"})
+		return
+	}
+	if err := loadTags(tx, merged); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	h.removeUnusedBlobs(hashes)
+
+	c.JSON(http.StatusOK, merged[0])
+}
+
+// moveDuplicate gives the kept transaction the tags, attachments and import
+// records of the duplicate. The import records keep the duplicate's bank id,
+// so importing its statement again still skips it. An attachment the kept
+// transaction already has stays behind and is deleted with the duplicate.
+func moveDuplicate(tx *sql.Tx, keptID, duplicateID int) error {
+	statements := []string{
+		`INSERT INTO transaction_tags (transaction_id, tag_id)
+		 SELECT $1, tag_id FROM transaction_tags WHERE transaction_id = $2
+		 ON CONFLICT DO NOTHING`,
+		`UPDATE attachments SET transaction_id = $1
+		 WHERE transaction_id = $2 AND sha256 NOT IN (SELECT sha256 FROM attachments WHERE transaction_id = $1)`,
+		`UPDATE imported_transactions SET transaction_id = $1 WHERE transaction_id = $2`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, keptID, duplicateID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DismissDuplicates records that a pair of transactions are not duplicates,
+// so GetDuplicates stops reporting it.
+func (h *Handler) DismissDuplicates(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.DuplicatePairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TransactionID == req.DuplicateID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A transaction cannot be a duplicate of itself"})
+		return
+	}
+
+	result, err := h.db.Exec(`INSERT INTO duplicate_dismissals (user_id, transaction_id, duplicate_id, created_at)
+			  SELECT $1, MIN(id), MAX(id), NOW() FROM transactions
+			  WHERE user_id = $1 AND id IN ($2, $3)
+			  HAVING COUNT(*) = 2
+			  ON CONFLICT DO NOTHING`, userID, req.TransactionID, req.DuplicateID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dismiss duplicate"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var count int
+		if err := h.db.QueryRow(`SELECT COUNT(*) FROM transactions WHERE user_id = $1 AND id IN ($2, $3)`,
+			userID, req.TransactionID, req.DuplicateID).Scan(&count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dismiss duplicate"})
+			return
+		}
+		if count < 2 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Duplicate dismissed"})
+}
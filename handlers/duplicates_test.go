@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"testing"
+	"time"
+)
+
+// TestMergeDuplicates checks that a merge takes the duplicate out of the
+// wallet balance and keeps the bank ids of both transactions.
+func TestMergeDuplicates(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "100.00", "type": "income", "category": "Allowance", "date": today}), http.StatusCreated, nil)
+	var kept, duplicate models.Transaction
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "4.50", "type": "expense", "category": "Food & Dining", "description": "coffee", "date": today}),
+		http.StatusCreated, &kept)
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost,
+		map[string]string{"amount": "4.50", "type": "expense", "category": "Food & Dining", "description": "CAMPUS COFFEE", "date": today}),
+		http.StatusCreated, &duplicate)
+
+	// Both came from statements, under different bank ids
+	var importID int
+	err := h.db.QueryRow(`INSERT INTO imports (user_id, account_id, format, filename, rows, status)
+		VALUES ($1, $2, 'ofx', 'statement.ofx', '[]', 'committed') RETURNING id`, userID, kept.AccountID).Scan(&importID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for externalID, transactionID := range map[string]int{"FIT-1": kept.ID, "FIT-2": duplicate.ID} {
+		_, err := h.db.Exec(`INSERT INTO imported_transactions (transaction_id, import_id, account_id, external_id)
+			VALUES ($1, $2, $3, $4)`, transactionID, importID, kept.AccountID, externalID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decode(t, serve(h.MergeDuplicates, userID, http.MethodPost,
+		map[string]int{"transaction_id": kept.ID, "duplicate_id": duplicate.ID}), http.StatusOK, nil)
+
+	var balance models.Money
+	if err := h.db.QueryRow(`SELECT balance FROM accounts WHERE id = $1`, kept.AccountID).Scan(&balance); err != nil {
+		t.Fatal(err)
+	}
+	if balance != 9550 {
+		t.Errorf("balance = %s, want 95.50", balance)
+	}
+	if err := ledger.Verify(h.db, userID); err != nil {
+		t.Errorf("ledger: %v", err)
+	}
+	var exists bool
+	if err := h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM transactions WHERE id = $1)`, duplicate.ID).Scan(&exists); err != nil || exists {
+		t.Errorf("duplicate still exists (%v)", err)
+	}
+	var externalIDs int
+	err = h.db.QueryRow(`SELECT COUNT(*) FROM imported_transactions WHERE transaction_id = $1 AND external_id IN ('FIT-1', 'FIT-2')`,
+		kept.ID).Scan(&externalIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if externalIDs != 2 {
+		t.Errorf("kept transaction has %d of the 2 bank ids", externalIDs)
+	}
+}
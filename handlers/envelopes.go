@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Envelopes
+
+var errEnvelopeNotFound = errors.New("envelope not found")
+
+// envelopeQuery selects envelopes with their assigned, spent and available
+// amounts, which are derived from envelope_moves and the expenses drawn from
+// each envelope.
+const envelopeQuery = `SELECT e.id, e.user_id, e.name, e.category, e.strict, e.created_at, e.updated_at,
+	COALESCE((SELECT SUM(m.amount) FROM envelope_moves m WHERE m.to_envelope_id = e.id), 0)
+	- COALESCE((SELECT SUM(m.amount) FROM envelope_moves m WHERE m.from_envelope_id = e.id), 0),
+	COALESCE((SELECT SUM(t.amount) FROM transactions t WHERE t.envelope_id = e.id AND t.type = 'expense'), 0)
+	FROM envelopes e`
+
+// scanEnvelope reads a row selected with envelopeQuery.
+func scanEnvelope(row rowScanner, e *models.Envelope) error {
+	err := row.Scan(&e.ID, &e.UserID, &e.Name, &e.Category, &e.Strict, &e.CreatedAt, &e.UpdatedAt, &e.Assigned, &e.Spent)
+	e.Available = e.Assigned - e.Spent
+	return err
+}
+
+// loadEnvelope reads one of the user's envelopes.
+func loadEnvelope(q ledger.Querier, userID, envelopeID int) (models.Envelope, error) {
+	var envelope models.Envelope
+	err := scanEnvelope(q.QueryRow(envelopeQuery+` WHERE e.id = $1 AND e.user_id = $2`, envelopeID, userID), &envelope)
+	if err == sql.ErrNoRows {
+		return envelope, errEnvelopeNotFound
+	}
+	return envelope, err
+}
+
+// toBeAssigned is the part of the user's wallet balances that is not in any
+// envelope yet.
+func toBeAssigned(q ledger.Querier, userID int) (models.Money, error) {
+	var amount models.Money
+	query := `SELECT COALESCE((SELECT SUM(balance) FROM accounts WHERE user_id = $1), 0)
+			  - COALESCE((SELECT SUM(m.amount) FROM envelope_moves m WHERE m.user_id = $1 AND m.to_envelope_id IS NOT NULL), 0)
+			  + COALESCE((SELECT SUM(m.amount) FROM envelope_moves m WHERE m.user_id = $1 AND m.from_envelope_id IS NOT NULL), 0)
+			  + COALESCE((SELECT SUM(t.amount) FROM transactions t WHERE t.user_id = $1 AND t.envelope_id IS NOT NULL AND t.type = 'expense'), 0)`
+	err := q.QueryRow(query, userID).Scan(&amount)
+	return amount, err
+}
+
+// GetEnvelopes lists the envelopes with the "to be assigned" amount and the
+// envelopes that are overspent.
+func (h *Handler) GetEnvelopes(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	rows, err := h.db.Query(envelopeQuery+` WHERE e.user_id = $1 ORDER BY e.name, e.id`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch envelopes"})
+		return
+	}
+	defer rows.Close()
+
+	envelopes := []models.Envelope{}
+	overspent := []int{}
+	for rows.Next() {
+		var envelope models.Envelope
+		if err := scanEnvelope(rows, &envelope); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan envelope"})
+			return
+		}
+		envelopes = append(envelopes, envelope)
+		if envelope.Available < 0 {
+			overspent = append(overspent, envelope.ID)
+		}
+	}
+
+	unassigned, err := toBeAssigned(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute amount to be assigned"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"envelopes":      envelopes,
+		"to_be_assigned": unassigned,
+		"overspent":      overspent,
+	})
+}
+
+func (h *Handler) CreateEnvelope(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.EnvelopeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Category != nil {
+		if _, err := resolveCategory(h.db, userID, "expense", nil, *req.Category, nil); err != nil {
+			respondCategoryError(c, err)
+			return
+		}
+	}
+
+	var envelopeID int
+	query := `INSERT INTO envelopes (user_id, name, category, strict, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, NOW(), NOW())
+			  RETURNING id`
+	if err := h.db.QueryRow(query, userID, req.Name, req.Category, req.Strict).Scan(&envelopeID); err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another envelope already covers this category"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create envelope"})
+		return
+	}
+
+	envelope, err := loadEnvelope(h.db, userID, envelopeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch envelope"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, envelope)
+}
+
+// PatchEnvelope changes the provided fields. An empty category unlinks the
+// envelope from its category.
+func (h *Handler) PatchEnvelope(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	envelopeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid envelope ID"})
+		return
+	}
+
+	var req models.EnvelopePatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Category != nil && *req.Category != "" {
+		if _, err := resolveCategory(h.db, userID, "expense", nil, *req.Category, nil); err != nil {
+			respondCategoryError(c, err)
+			return
+		}
+	}
+
+	query := `UPDATE envelopes
+			  SET name = COALESCE($1, name), category = CASE WHEN $2::text IS NULL THEN category ELSE NULLIF($2, '') END,
+			  strict = COALESCE($3, strict), updated_at = NOW()
+			  WHERE id = $4 AND user_id = $5`
+	result, err := h.db.Exec(query, req.Name, req.Category, req.Strict, envelopeID, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another envelope already covers this category"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update envelope"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Envelope not found"})
+		return
+	}
+
+	envelope, err := loadEnvelope(h.db, userID, envelopeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch envelope"})
+		return
+	}
+
+	c.JSON(http.StatusOK, envelope)
+}
+
+// DeleteEnvelope removes an envelope. Whatever it still held goes back to be
+// assigned and its expenses no longer draw from any envelope. Moves between
+// it and other envelopes are kept with the unassigned pool in its place, so
+// the other envelopes keep what they hold; its other moves are deleted with
+// it.
+func (h *Handler) DeleteEnvelope(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	envelopeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid envelope ID"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The account locks serialize the delete with moves and expenses
+	if _, err := lockAccounts(tx, userID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	for _, query := range []string{
+		`UPDATE envelope_moves SET from_envelope_id = NULL
+		 WHERE user_id = $1 AND from_envelope_id = $2 AND to_envelope_id IS NOT NULL`,
+		`UPDATE envelope_moves SET to_envelope_id = NULL
+		 WHERE user_id = $1 AND to_envelope_id = $2 AND from_envelope_id IS NOT NULL`,
+	} {
+		if _, err := tx.Exec(query, userID, envelopeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete envelope"})
+			return
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM envelopes WHERE id = $1 AND user_id = $2", envelopeID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete envelope"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Envelope not found"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Envelope deleted successfully"})
+}
+
+func (h *Handler) GetEnvelopeMoves(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	query := `SELECT id, user_id, from_envelope_id, to_envelope_id, amount, COALESCE(note, ''), created_at
+			  FROM envelope_moves WHERE user_id = $1 ORDER BY created_at DESC, id DESC`
+	rows, err := h.db.Query(query, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch envelope moves"})
+		return
+	}
+	defer rows.Close()
+
+	moves := []models.EnvelopeMove{}
+	for rows.Next() {
+		var m models.EnvelopeMove
+		if err := rows.Scan(&m.ID, &m.UserID, &m.FromEnvelopeID, &m.ToEnvelopeID, &m.Amount, &m.Note, &m.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan envelope move"})
+			return
+		}
+		moves = append(moves, m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"moves": moves})
+}
+
+// MoveEnvelopeMoney assigns money from "to be assigned" to an envelope,
+// moves it between envelopes or returns it. The source must hold enough.
+func (h *Handler) MoveEnvelopeMoney(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.EnvelopeMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.FromEnvelopeID == nil && req.ToEnvelopeID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_envelope_id or to_envelope_id is required"})
+		return
+	}
+	if req.FromEnvelopeID != nil && req.ToEnvelopeID != nil && *req.FromEnvelopeID == *req.ToEnvelopeID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot move money to the same envelope"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The account locks serialize moves with expenses and other moves
+	if _, err := lockAccounts(tx, userID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	available, err := toBeAssigned(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute amount to be assigned"})
+		return
+	}
+	if req.FromEnvelopeID != nil {
+		from, err := loadEnvelope(tx, userID, *req.FromEnvelopeID)
+		if err != nil {
+			respondEnvelopeError(c, err)
+			return
+		}
+		available = from.Available
+	}
+	if req.ToEnvelopeID != nil {
+		if _, err := loadEnvelope(tx, userID, *req.ToEnvelopeID); err != nil {
+			respondEnvelopeError(c, err)
+			return
+		}
+	}
+	if available < req.Amount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient funds: only " + available.String() + " available to move"})
+		return
+	}
+
+	move := models.EnvelopeMove{
+		UserID:         userID,
+		FromEnvelopeID: req.FromEnvelopeID,
+		ToEnvelopeID:   req.ToEnvelopeID,
+		Amount:         req.Amount,
+		Note:           req.Note,
+	}
+	query := `INSERT INTO envelope_moves (user_id, from_envelope_id, to_envelope_id, amount, note, created_at)
+			  VALUES ($1, $2, $3, $4, $5, NOW())
+			  RETURNING id, created_at`
+	err = tx.QueryRow(query, userID, move.FromEnvelopeID, move.ToEnvelopeID, move.Amount, move.Note).Scan(&move.ID, &move.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move money"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, move)
+}
+
+// checkEnvelope resolves the envelope an expense draws from and checks it
+// can cover the expense. With auto set the envelope is the one linked to the
+// expense's category, if any. A strict envelope rejects overspending; any
+// other records it in t.EnvelopeOverspent. old is the version being
+// replaced, whose draw is given back first. The caller holds the account
+// locks.
+func checkEnvelope(tx *sql.Tx, userID int, old, t *models.Transaction, auto bool) error {
+	if t.Type != "expense" {
+		t.EnvelopeID = nil
+		return nil
+	}
+
+	if auto {
+		t.EnvelopeID = nil
+		var envelopeID int
+		err := tx.QueryRow(`SELECT id FROM envelopes WHERE user_id = $1 AND category = $2`, userID, t.Category).Scan(&envelopeID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			t.EnvelopeID = &envelopeID
+		}
+	}
+	if t.EnvelopeID == nil {
+		return nil
+	}
+
+	envelope, err := loadEnvelope(tx, userID, *t.EnvelopeID)
+	if err != nil {
+		return err
+	}
+
+	available := envelope.Available
+	if old != nil && old.Type == "expense" && old.EnvelopeID != nil && *old.EnvelopeID == envelope.ID {
+		available += old.Amount
+	}
+	if t.Amount <= available {
+		return nil
+	}
+	if envelope.Strict {
+		return requestError("Envelope '" + envelope.Name + "' has only " + available.String() + " available")
+	}
+
+	t.EnvelopeOverspent = t.Amount
+	if available > 0 {
+		t.EnvelopeOverspent -= available
+	}
+	return nil
+}
+
+// respondEnvelopeError writes the response for an error from loadEnvelope or
+// checkEnvelope.
+func respondEnvelopeError(c *gin.Context, err error) {
+	if reqErr, ok := err.(requestError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": string(reqErr)})
+		return
+	}
+	if err == errEnvelopeNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Envelope not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check envelope"})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"student-money-manager/models"
+	"testing"
+	"time"
+)
+
+// TestDeleteEnvelopeKeepsOtherEnvelopes checks that deleting an envelope
+// returns what it held to the pool without touching the envelopes it
+// exchanged money with.
+func TestDeleteEnvelopeKeepsOtherEnvelopes(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+
+	var food, books models.Envelope
+	decode(t, serve(h.CreateEnvelope, userID, http.MethodPost, map[string]interface{}{"name": "Food", "category": "Food & Dining"}),
+		http.StatusCreated, &food)
+	decode(t, serve(h.CreateEnvelope, userID, http.MethodPost, map[string]interface{}{"name": "Books"}),
+		http.StatusCreated, &books)
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost, map[string]string{"amount": "100.00", "type": "income", "category": "Allowance", "date": today}),
+		http.StatusCreated, nil)
+	for _, move := range []map[string]interface{}{
+		{"to_envelope_id": food.ID, "amount": "50.00"},
+		{"from_envelope_id": food.ID, "to_envelope_id": books.ID, "amount": "20.00"},
+		{"from_envelope_id": books.ID, "to_envelope_id": food.ID, "amount": "5.00"},
+	} {
+		decode(t, serve(h.MoveEnvelopeMoney, userID, http.MethodPost, move), http.StatusCreated, nil)
+	}
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost, map[string]string{"amount": "10.00", "type": "expense", "category": "Food & Dining", "date": today}),
+		http.StatusCreated, nil)
+
+	decode(t, serve(h.DeleteEnvelope, userID, http.MethodDelete, nil, "id", strconv.Itoa(food.ID)), http.StatusOK, nil)
+
+	remaining, err := loadEnvelope(h.db, userID, books.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining.Available != 1500 {
+		t.Errorf("Books holds %s, want 15.00", remaining.Available)
+	}
+	pool, err := toBeAssigned(h.db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool != 7500 {
+		t.Errorf("to be assigned = %s, want 75.00", pool)
+	}
+
+	w := serve(h.DeleteEnvelope, userID, http.MethodDelete, nil, "id", strconv.Itoa(food.ID))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Export
+
+// exportFlushRows is how many rows are written between flushes, so clients
+// receive a large export as it is read.
+const exportFlushRows = 500
+
+// The columns of each export, in the order they are written. The order is
+// part of the API: new columns are only ever added at the end.
+var (
+	transactionExportColumns = []string{"id", "date", "type", "amount", "account_id", "account", "to_account_id",
+		"to_account", "category_id", "category", "description", "tags", "splits", "envelope_id", "recurring_rule_id",
+		"created_at", "updated_at"}
+	savingsTransactionExportColumns = []string{"id", "date", "type", "amount", "account_id", "account", "goal_id", "goal",
+		"description", "created_at", "updated_at"}
+	savingsGoalExportColumns = []string{"id", "name", "target_amount", "current_amount", "deadline", "description",
+		"is_active", "created_at", "updated_at"}
+)
+
+// exportFormats maps ?format= to the content type and file extension.
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+}
+
+// ExportTransactions streams the user's transactions, oldest first, as CSV
+// or NDJSON (?format=, default csv). It takes the filters of
+// GetTransactions. The columns, listed in the X-Export-Columns header and
+// in the CSV header row, are transactionExportColumns: dates are
+// YYYY-MM-DD, timestamps RFC 3339, tags are comma-separated in CSV, and
+// splits are a JSON array of category_id, category, amount and note in
+// both formats. Missing values are empty in CSV and null in NDJSON, and
+// CSV text that a spreadsheet would read as a formula starts with an
+// apostrophe. The X-Export-Rows trailer marks a complete export; see
+// streamExport.
+func (h *Handler) ExportTransactions(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	format, ok := parseExportFormat(c)
+	if !ok {
+		return
+	}
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	conditions, args, err := filterTransactions("", []interface{}{userID}, filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	query := `SELECT t.id, t.date, t.type, t.amount, t.account_id, a.name, t.to_account_id, ta.name, t.category_id,
+			  t.category, COALESCE(t.description, ''),
+			  ARRAY(SELECT tg.name FROM transaction_tags tt JOIN tags tg ON tg.id = tt.tag_id
+			        WHERE tt.transaction_id = t.id ORDER BY tg.name),
+			  COALESCE((SELECT json_agg(json_build_object('category_id', s.category_id, 'category', s.category,
+			        'amount', s.amount, 'note', COALESCE(s.note, '')) ORDER BY s.id)
+			        FROM transaction_splits s WHERE s.transaction_id = t.id), '[]'),
+			  t.envelope_id, t.recurring_rule_id, t.created_at, t.updated_at
+			  FROM transactions t
+			  JOIN accounts a ON a.id = t.account_id
+			  LEFT JOIN accounts ta ON ta.id = t.to_account_id
+			  WHERE t.user_id = $1 AND t.id IN (SELECT id FROM transactions WHERE user_id = $1` + conditions + `)
+			  ORDER BY t.date, t.created_at, t.id`
+
+	h.streamExport(c, "transactions", format, transactionExportColumns, query, args, func(rows *sql.Rows) ([]interface{}, error) {
+		var t models.Transaction
+		var account string
+		var toAccount *string
+		var tags []string
+		var splits []byte
+		err := rows.Scan(&t.ID, &t.Date, &t.Type, &t.Amount, &t.AccountID, &account, &t.ToAccountID, &toAccount, &t.CategoryID,
+			&t.Category, &t.Description, pq.Array(&tags), &splits, &t.EnvelopeID, &t.RecurringRuleID, &t.CreatedAt, &t.UpdatedAt)
+		if tags == nil {
+			tags = []string{}
+		}
+		return []interface{}{t.ID, exportDate(t.Date), t.Type, t.Amount, t.AccountID, account, t.ToAccountID,
+			toAccount, t.CategoryID, t.Category, t.Description, tags, json.RawMessage(splits), t.EnvelopeID, t.RecurringRuleID,
+			exportTimestamp(t.CreatedAt), exportTimestamp(t.UpdatedAt)}, err
+	})
+}
+
+// ExportSavingsTransactions streams the user's savings transfers, oldest
+// first, like ExportTransactions. Of its filters, from, to, min_amount,
+// max_amount, description and account_id apply, with type (deposit or
+// withdrawal) and goal_id in addition; the rest are rejected. The columns
+// are savingsTransactionExportColumns.
+func (h *Handler) ExportSavingsTransactions(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	format, ok := parseExportFormat(c)
+	if !ok {
+		return
+	}
+	conditions, args, err := filterSavingsTransactions(c, userID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	query := `SELECT st.id, st.date, st.type, st.amount, st.account_id, a.name, st.goal_id, g.name,
+			  COALESCE(st.description, ''), st.created_at, st.updated_at
+			  FROM savings_transactions st
+			  JOIN accounts a ON a.id = st.account_id
+			  LEFT JOIN savings_goals g ON g.id = st.goal_id
+			  WHERE st.user_id = $1 AND st.id IN (SELECT id FROM savings_transactions WHERE user_id = $1` + conditions + `)
+			  ORDER BY st.date, st.created_at, st.id`
+
+	h.streamExport(c, "savings-transactions", format, savingsTransactionExportColumns, query, args, func(rows *sql.Rows) ([]interface{}, error) {
+		var t models.SavingsTransaction
+		var account string
+		var goal *string
+		err := rows.Scan(&t.ID, &t.Date, &t.Type, &t.Amount, &t.AccountID, &account, &t.GoalID, &goal,
+			&t.Description, &t.CreatedAt, &t.UpdatedAt)
+		return []interface{}{t.ID, exportDate(t.Date), t.Type, t.Amount, t.AccountID, account, t.GoalID, goal,
+			t.Description, exportTimestamp(t.CreatedAt), exportTimestamp(t.UpdatedAt)}, err
+	})
+}
+
+// ExportSavingsGoals streams the user's savings goals, including inactive
+// ones unless ?active= says otherwise, oldest first, like
+// ExportTransactions. current_amount is computed from the goal's transfers
+// as in GetSavingsGoals. The columns are savingsGoalExportColumns.
+func (h *Handler) ExportSavingsGoals(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	format, ok := parseExportFormat(c)
+	if !ok {
+		return
+	}
+
+	query := `SELECT g.id, g.name, g.target_amount,
+			  COALESCE(SUM(CASE WHEN st.type = 'deposit' THEN st.amount WHEN st.type = 'withdrawal' THEN -st.amount ELSE 0 END), 0),
+			  g.deadline, COALESCE(g.description, ''), g.is_active, g.created_at, g.updated_at
+			  FROM savings_goals g
+			  LEFT JOIN savings_transactions st ON st.goal_id = g.id
+			  WHERE g.user_id = $1`
+	args := []interface{}{userID}
+	if value := c.Query("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active must be true or false"})
+			return
+		}
+		args = append(args, active)
+		query += " AND g.is_active = $2"
+	}
+	query += ` GROUP BY g.id ORDER BY g.created_at, g.id`
+
+	h.streamExport(c, "savings-goals", format, savingsGoalExportColumns, query, args, func(rows *sql.Rows) ([]interface{}, error) {
+		var goal models.SavingsGoal
+		err := rows.Scan(&goal.ID, &goal.Name, &goal.TargetAmount, &goal.CurrentAmount, &goal.Deadline,
+			&goal.Description, &goal.IsActive, &goal.CreatedAt, &goal.UpdatedAt)
+		var deadline *string
+		if goal.Deadline != nil {
+			date := exportDate(*goal.Deadline)
+			deadline = &date
+		}
+		return []interface{}{goal.ID, goal.Name, goal.TargetAmount, goal.CurrentAmount, deadline, goal.Description,
+			goal.IsActive, exportTimestamp(goal.CreatedAt), exportTimestamp(goal.UpdatedAt)}, err
+	})
+}
+
+// parseExportFormat reads ?format=, responding with an error if it is not
+// known.
+func parseExportFormat(c *gin.Context) (string, bool) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if _, ok := exportFormats[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return "", false
+	}
+	return format, true
+}
+
+// filterSavingsTransactions builds the conditions of a savings transaction
+// export. Dates, amounts and descriptions are filtered by
+// filterTransactions, whose conditions hold for savings_transactions too.
+func filterSavingsTransactions(c *gin.Context, userID int) (string, []interface{}, error) {
+	for _, name := range []string{"category", "category_id", "tag", "tags_any", "tags_all", "q"} {
+		if c.Query(name) != "" {
+			return "", nil, requestError(name + " does not apply to savings transactions")
+		}
+	}
+
+	f := models.TransactionFilter{From: c.Query("from"), To: c.Query("to"), Description: c.Query("description")}
+	if err := parseAmountBounds(c, &f); err != nil {
+		return "", nil, err
+	}
+	conditions, args, err := filterTransactions("", []interface{}{userID}, f)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if value := c.Query("type"); value != "" {
+		if value != "deposit" && value != "withdrawal" {
+			return "", nil, requestError("type must be deposit or withdrawal")
+		}
+		args = append(args, value)
+		conditions += " AND type = $" + strconv.Itoa(len(args))
+	}
+	for _, column := range []string{"account_id", "goal_id"} {
+		value := c.Query(column)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, requestError(column + " must be an integer, got '" + value + "'")
+		}
+		args = append(args, id)
+		conditions += " AND " + column + " = $" + strconv.Itoa(len(args))
+	}
+	return conditions, args, nil
+}
+
+// streamExport runs query and writes each row, as scan returns its values
+// in the order of columns, without holding more than one row in memory.
+// Once the first byte is sent the status can no longer change, so the
+// outcome is reported after the rows: the X-Export-Rows trailer carries
+// the row count of a complete export, and a failure part way through sets
+// the X-Export-Error trailer instead and, in NDJSON, ends the body with an
+// {"error": ...} line.
+func (h *Handler) streamExport(c *gin.Context, name, format string, columns []string, query string, args []interface{},
+	scan func(*sql.Rows) ([]interface{}, error)) {
+	message := "Failed to export " + strings.ReplaceAll(name, "-", " ")
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+		return
+	}
+	defer rows.Close()
+
+	spec := exportFormats[format]
+	filename := name + "-" + time.Now().Format("2006-01-02") + "." + spec.extension
+	c.Header("Content-Type", spec.contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("X-Export-Columns", strings.Join(columns, ","))
+	c.Header("Trailer", "X-Export-Rows, X-Export-Error")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+
+	var csvWriter *csv.Writer
+	if format == "csv" {
+		csvWriter = csv.NewWriter(c.Writer)
+		csvWriter.Write(columns)
+	}
+	var line bytes.Buffer
+	record := make([]string, len(columns))
+
+	// fail ends an export cut short, after the rows already written
+	fail := func(err error) {
+		log.Printf("export: failed to export %s: %v", name, err)
+		if csvWriter != nil {
+			csvWriter.Flush()
+		} else {
+			trailer, _ := json.Marshal(gin.H{"error": message})
+			c.Writer.Write(append(trailer, '\n'))
+		}
+		c.Writer.Header().Set("X-Export-Error", message)
+	}
+
+	count := 0
+	for rows.Next() {
+		values, err := scan(rows)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		if csvWriter != nil {
+			for i, value := range values {
+				record[i] = exportText(value)
+			}
+			err = csvWriter.Write(record)
+		} else {
+			line.Reset()
+			line.WriteByte('{')
+			for i, value := range values {
+				if i > 0 {
+					line.WriteByte(',')
+				}
+				key, _ := json.Marshal(columns[i])
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					fail(err)
+					return
+				}
+				line.Write(key)
+				line.WriteByte(':')
+				line.Write(encoded)
+			}
+			line.WriteString("}\n")
+			_, err = c.Writer.Write(line.Bytes())
+		}
+		if err != nil {
+			// The client went away
+			return
+		}
+
+		count++
+		if count%exportFlushRows == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		fail(err)
+		return
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	c.Writer.Header().Set("X-Export-Rows", strconv.Itoa(count))
+}
+
+// exportText formats a value for a CSV cell.
+func exportText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return exportCell(v)
+	case *string:
+		if v == nil {
+			return ""
+		}
+		return exportCell(*v)
+	case int:
+		return strconv.Itoa(v)
+	case *int:
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	case bool:
+		return strconv.FormatBool(v)
+	case models.Money:
+		return v.String()
+	case []string:
+		return exportCell(strings.Join(v, ","))
+	case json.RawMessage:
+		return string(v)
+	}
+	return ""
+}
+
+// exportCell quotes text that a spreadsheet would run as a formula, such
+// as a description starting with =, by prefixing it with an apostrophe.
+// Tab and carriage return are included as some spreadsheets skip them
+// before a formula.
+func exportCell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func exportDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func exportTimestamp(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"student-money-manager/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportText(t *testing.T) {
+	name := "@home"
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"Coffee", "Coffee"},
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1 gift", "'+1 gift"},
+		{"-5 refund", "'-5 refund"},
+		{&name, "'@home"},
+		{"\tindented", "'\tindented"},
+		{"a=b", "a=b"},
+		{"", ""},
+		{(*string)(nil), ""},
+		{[]string{"=x", "y"}, "'=x,y"},
+		{[]string{"x", "=y"}, "x,=y"},
+		{models.Money(-1230), "-12.30"},
+		{-3, "-3"},
+		{"2026-01-05", "2026-01-05"},
+	}
+	for _, test := range tests {
+		if got := exportText(test.value); got != test.want {
+			t.Errorf("exportText(%#v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestStreamExport(t *testing.T) {
+	h := newTestHandler(t)
+	columns := []string{"id", "description"}
+	query := `SELECT n, '=' || n FROM generate_series(1, 3) n`
+	scanFailingAt := func(bad int) func(*sql.Rows) ([]interface{}, error) {
+		return func(rows *sql.Rows) ([]interface{}, error) {
+			var id int
+			var description string
+			if err := rows.Scan(&id, &description); err != nil {
+				return nil, err
+			}
+			if id == bad {
+				return nil, errors.New("scan failed")
+			}
+			return []interface{}{id, description}, nil
+		}
+	}
+
+	tests := []struct {
+		format    string
+		bad       int
+		body      string
+		rows, err string
+	}{
+		{"csv", 0, "id,description\n1,'=1\n2,'=2\n3,'=3\n", "3", ""},
+		{"ndjson", 0, "{\"id\":1,\"description\":\"=1\"}\n{\"id\":2,\"description\":\"=2\"}\n{\"id\":3,\"description\":\"=3\"}\n", "3", ""},
+		{"csv", 2, "id,description\n1,'=1\n", "", "Failed to export test"},
+		{"ndjson", 2, "{\"id\":1,\"description\":\"=1\"}\n{\"error\":\"Failed to export test\"}\n", "", "Failed to export test"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		h.streamExport(c, "test", test.format, columns, query, nil, scanFailingAt(test.bad))
+
+		result := w.Result()
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("%s failing at %d: body %q, want %q", test.format, test.bad, body, test.body)
+		}
+		if got := result.Trailer.Get("X-Export-Rows"); got != test.rows {
+			t.Errorf("%s failing at %d: X-Export-Rows %q, want %q", test.format, test.bad, got, test.rows)
+		}
+		if got := result.Trailer.Get("X-Export-Error"); got != test.err {
+			t.Errorf("%s failing at %d: X-Export-Error %q, want %q", test.format, test.bad, got, test.err)
+		}
+	}
+}
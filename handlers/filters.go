@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+	"student-money-manager/querylang"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// parseTransactionFilter reads a TransactionFilter from the query string.
+// category and category_id may be repeated.
+func parseTransactionFilter(c *gin.Context) (models.TransactionFilter, error) {
+	f := models.TransactionFilter{
+		Type:        c.Query("type"),
+		From:        c.Query("from"),
+		To:          c.Query("to"),
+		Description: c.Query("description"),
+		Tag:         c.Query("tag"),
+		TagsAny:     c.Query("tags_any"),
+		TagsAll:     c.Query("tags_all"),
+		Query:       c.Query("q"),
+	}
+
+	for _, name := range c.QueryArray("category") {
+		if name != "" {
+			f.Categories = append(f.Categories, name)
+		}
+	}
+	for _, value := range c.QueryArray("category_id") {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return f, requestError("category_id must be an integer, got '" + value + "'")
+		}
+		f.CategoryIDs = append(f.CategoryIDs, id)
+	}
+
+	if value := c.Query("account_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return f, requestError("account_id must be an integer, got '" + value + "'")
+		}
+		f.AccountID = &id
+	}
+
+	if f.Type != "" && f.Type != "income" && f.Type != "expense" && f.Type != "transfer" {
+		return f, requestError("type must be income, expense or transfer")
+	}
+
+	return f, parseAmountBounds(c, &f)
+}
+
+// parseAmountBounds reads min_amount and max_amount into f.
+func parseAmountBounds(c *gin.Context, f *models.TransactionFilter) error {
+	for _, bound := range []struct {
+		name   string
+		amount **models.Money
+	}{{"min_amount", &f.MinAmount}, {"max_amount", &f.MaxAmount}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		amount, err := models.ParseMoney(value)
+		if err != nil {
+			return requestError(bound.name + " must be an amount such as 12.50, got '" + value + "'")
+		}
+		*bound.amount = &amount
+	}
+	return nil
+}
+
+// filterTransactions appends the conditions of f to a query on transactions
+// whose argument $1 is the user id, and returns the query with its
+// arguments.
+func filterTransactions(query string, args []interface{}, f models.TransactionFilter) (string, []interface{}, error) {
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	// A category filter also matches the subcategories of the categories
+	if len(f.Categories) > 0 {
+		names := arg(pq.Array(f.Categories))
+		subtree := categorySubtree("name = ANY(" + names + ")")
+		query += " AND (category = ANY(" + names + ") OR category_id IN " + subtree +
+			" OR EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = transactions.id AND s.category_id IN " + subtree + "))"
+	}
+
+	if len(f.CategoryIDs) > 0 {
+		ids := make([]int64, 0, len(f.CategoryIDs))
+		for _, id := range f.CategoryIDs {
+			ids = append(ids, int64(id))
+		}
+		subtree := categorySubtree("id = ANY(" + arg(pq.Array(ids)) + ")")
+		query += " AND (category_id IN " + subtree +
+			" OR EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = transactions.id AND s.category_id IN " + subtree + "))"
+	}
+
+	if f.Type != "" {
+		query += " AND type = " + arg(f.Type)
+	}
+
+	if f.AccountID != nil {
+		// Transfers show up in both the source and the destination wallet
+		id := arg(*f.AccountID)
+		query += " AND (account_id = " + id + " OR to_account_id = " + id + ")"
+	}
+
+	var from, to time.Time
+	if f.From != "" {
+		parsed, err := time.Parse("2006-01-02", f.From)
+		if err != nil {
+			return "", nil, requestError("Invalid from date format. Use YYYY-MM-DD")
+		}
+		from = parsed
+		query += " AND date >= " + arg(from)
+	}
+
+	if f.To != "" {
+		parsed, err := time.Parse("2006-01-02", f.To)
+		if err != nil {
+			return "", nil, requestError("Invalid to date format. Use YYYY-MM-DD")
+		}
+		to = parsed
+		query += " AND date < " + arg(to.AddDate(0, 0, 1))
+	}
+
+	if f.From != "" && f.To != "" && from.After(to) {
+		return "", nil, requestError("from must not be after to")
+	}
+
+	if f.MinAmount != nil {
+		query += " AND amount >= " + arg(*f.MinAmount)
+	}
+
+	if f.MaxAmount != nil {
+		query += " AND amount <= " + arg(*f.MaxAmount)
+	}
+
+	if f.MinAmount != nil && f.MaxAmount != nil && *f.MinAmount > *f.MaxAmount {
+		return "", nil, requestError("min_amount must not be greater than max_amount")
+	}
+
+	if f.Description != "" {
+		query += " AND description ILIKE " + arg("%"+escapeLike(f.Description)+"%")
+	}
+
+	if f.Tag != "" {
+		query += tagCondition(arg(pq.Array([]string{normalizeTag(f.Tag)})), "1")
+	}
+
+	if tags := splitTags(f.TagsAny); len(tags) > 0 {
+		query += tagCondition(arg(pq.Array(tags)), "1")
+	}
+
+	if tags := splitTags(f.TagsAll); len(tags) > 0 {
+		query += tagCondition(arg(pq.Array(tags)), arg(len(tags)))
+	}
+
+	if f.Query != "" {
+		node, err := querylang.Parse(f.Query)
+		if err != nil {
+			return "", nil, requestError("Invalid q: " + err.Error())
+		}
+		if node != nil {
+			query += " AND " + compileQuery(node, arg)
+		}
+	}
+
+	return query, args, nil
+}
+
+// isEmptyFilter reports whether f matches every transaction.
+func isEmptyFilter(f models.TransactionFilter) bool {
+	return len(f.CategoryIDs) == 0 && len(f.Categories) == 0 && f.Type == "" && f.AccountID == nil &&
+		f.From == "" && f.To == "" && f.MinAmount == nil && f.MaxAmount == nil && f.Description == "" &&
+		len(splitTags(f.Tag)) == 0 && len(splitTags(f.TagsAny)) == 0 && len(splitTags(f.TagsAll)) == 0 &&
+		strings.TrimSpace(f.Query) == ""
+}
+
+// compileQuery turns a parsed query into a condition on transactions, adding
+// its values as arguments with arg.
+func compileQuery(node querylang.Node, arg func(interface{}) string) string {
+	switch node := node.(type) {
+	case querylang.And:
+		conditions := make([]string, len(node))
+		for i, n := range node {
+			conditions[i] = compileQuery(n, arg)
+		}
+		return "(" + strings.Join(conditions, " AND ") + ")"
+	case querylang.Or:
+		conditions := make([]string, len(node))
+		for i, n := range node {
+			conditions[i] = compileQuery(n, arg)
+		}
+		return "(" + strings.Join(conditions, " OR ") + ")"
+	case querylang.Not:
+		// A comparison with NULL, such as a missing description, is false
+		// rather than unknown, so its negation is true
+		return "NOT COALESCE(" + compileQuery(node.Node, arg) + ", FALSE)"
+	case querylang.Cond:
+		return compileCond(node, arg)
+	}
+	panic("querylang: unknown node")
+}
+
+func compileCond(cond querylang.Cond, arg func(interface{}) string) string {
+	switch cond.Field {
+	case "category":
+		var subtree string
+		if cond.Op == "~" {
+			subtree = categorySubtree("name ILIKE " + arg("%"+escapeLike(cond.Text)+"%"))
+		} else {
+			subtree = categorySubtree("lower(name) = lower(" + arg(cond.Text) + ")")
+		}
+		return "(category_id IN " + subtree +
+			" OR EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = transactions.id AND s.category_id IN " + subtree + "))"
+
+	case "type":
+		return "type = " + arg(cond.Text)
+
+	case "amount":
+		return "amount " + cond.Op + " " + arg(cond.Amount)
+
+	case "date":
+		// Dates are whole days, so compare with the start of the day or of
+		// the next one
+		day, next := cond.Date, cond.Date.AddDate(0, 0, 1)
+		switch cond.Op {
+		case "<":
+			return "date < " + arg(day)
+		case "<=":
+			return "date < " + arg(next)
+		case ">":
+			return "date >= " + arg(next)
+		case ">=":
+			return "date >= " + arg(day)
+		}
+		return "(date >= " + arg(day) + " AND date < " + arg(next) + ")"
+
+	case "description":
+		if cond.Op == "~" {
+			return "description ILIKE " + arg("%"+escapeLike(cond.Text)+"%")
+		}
+		return "lower(description) = lower(" + arg(cond.Text) + ")"
+
+	case "tag":
+		name := "g.name = " + arg(normalizeTag(cond.Text))
+		if cond.Op == "~" {
+			name = "g.name LIKE " + arg("%"+escapeLike(normalizeTag(cond.Text))+"%")
+		}
+		return "EXISTS (SELECT 1 FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id WHERE tt.transaction_id = transactions.id AND " + name + ")"
+
+	case "account":
+		id := arg(cond.ID)
+		return "(account_id = " + id + " OR to_account_id = " + id + ")"
+	}
+	panic("querylang: unknown field " + cond.Field)
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
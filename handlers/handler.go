@@ -2,14 +2,28 @@ package handlers
 
 import (
 	"database/sql"
+	"student-money-manager/storage"
+
+	"github.com/lib/pq"
 )
 
 type Handler struct {
-	db *sql.DB
+	db    *sql.DB
+	store storage.Store
 }
 
-func NewHandler(db *sql.DB) *Handler {
+// NewHandler returns the API handlers. store keeps the contents of
+// transaction attachments.
+func NewHandler(db *sql.DB, store storage.Store) *Handler {
 	return &Handler{
-		db: db,
+		db:    db,
+		store: store,
 	}
 }
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// key.
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"student-money-manager/database"
+	"student-money-manager/storage"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestHandler connects to the database named by TEST_DATABASE_URL and
+// migrates it. Tests that need a database are skipped when it is unset.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	return NewHandler(db, store)
+}
+
+var testUsers int64
+
+// newTestUser creates a user with a primary account and the default
+// categories, as Register does.
+func newTestUser(t *testing.T, h *Handler) int {
+	t.Helper()
+	email := fmt.Sprintf("test-%d-%d@example.com", time.Now().UnixNano(), atomic.AddInt64(&testUsers, 1))
+	var userID int
+	err := h.db.QueryRow(`INSERT INTO users (email, password, name, created_at, updated_at)
+		VALUES ($1, 'x', 'Test', NOW(), NOW()) RETURNING id`, email).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = h.db.Exec("INSERT INTO accounts (user_id, name, type, is_primary, balance, allowance_income, created_at, updated_at) VALUES ($1, 'Main', 'bank', true, 0, 0, NOW(), NOW())", userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := seedCategories(h.db, userID); err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+// serve calls handler as userID with body encoded as JSON and returns the
+// recorded response. params are the route parameters as name, value pairs.
+func serve(handler gin.HandlerFunc, userID int, method string, body interface{}, params ...string) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", bytes.NewReader(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(params); i += 2 {
+		c.Params = append(c.Params, gin.Param{Key: params[i], Value: params[i+1]})
+	}
+	c.Set("user_id", userID)
+	handler(c)
+	return w
+}
+
+// decode reads a JSON response into v, failing the test unless the status
+// is want.
+func decode(t *testing.T, w *httptest.ResponseRecorder, want int, v interface{}) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status %d, want %d: %s", w.Code, want, w.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
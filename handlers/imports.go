@@ -0,0 +1,580 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"student-money-manager/importer"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Statement imports
+
+// maxImportSize limits an uploaded statement.
+const maxImportSize = 5 << 20
+
+// The categories of imported rows whose statement has none, unless the
+// upload names others.
+const (
+	defaultImportExpenseCategory = "Miscellaneous"
+	defaultImportIncomeCategory  = "Other Income"
+)
+
+const importColumns = `id, user_id, account_id, format, filename, mapping, rows, status, created_at, committed_at`
+
+// scanImport reads a row selected with importColumns and counts its rows.
+func scanImport(row rowScanner, imp *models.Import) error {
+	var mapping, rows []byte
+	err := row.Scan(&imp.ID, &imp.UserID, &imp.AccountID, &imp.Format, &imp.Filename, &mapping, &rows, &imp.Status,
+		&imp.CreatedAt, &imp.CommittedAt)
+	if err != nil {
+		return err
+	}
+
+	imp.Mapping = nil
+	if mapping != nil {
+		imp.Mapping = &models.CSVMapping{}
+		if err := json.Unmarshal(mapping, imp.Mapping); err != nil {
+			return err
+		}
+	}
+	if err := json.Unmarshal(rows, &imp.Rows); err != nil {
+		return err
+	}
+	countImportRows(imp)
+	return nil
+}
+
+// countImportRows sets the row counts of an import.
+func countImportRows(imp *models.Import) {
+	imp.Valid, imp.Invalid, imp.Duplicates = 0, 0, 0
+	for _, row := range imp.Rows {
+		switch {
+		case row.Error != "":
+			imp.Invalid++
+		case row.Duplicate:
+			imp.Duplicates++
+		default:
+			imp.Valid++
+		}
+	}
+}
+
+// CreateImport uploads a CSV, OFX, QFX or QIF statement in the multipart
+// field "file" and returns a preview of the transactions it would create.
+// The rows are checked exactly as committing them would, without saving
+// anything. The optional form fields are format (default detected from the
+// file), account_id (default the primary wallet), profile_id or mapping (a
+// CSVMapping as JSON; QIF uses only its date_format and OFX none of it),
+// save_profile (a name to save the CSV mapping used under), and
+// expense_category and income_category for rows without a category.
+func (h *Handler) CreateImport(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	// Leave room for the multipart framing and the other fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+1<<20)
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Statement is larger than 5 MB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if file.Size > maxImportSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Statement is larger than 5 MB"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read statement"})
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read statement"})
+		return
+	}
+
+	var accountID *int
+	if value := c.PostForm("account_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "account_id must be an integer"})
+			return
+		}
+		accountID = &id
+	}
+
+	var mapping models.CSVMapping
+	if value := c.PostForm("profile_id"); value != "" {
+		var profile models.ImportProfile
+		err := scanImportProfile(h.db.QueryRow(`SELECT `+importProfileColumns+` FROM import_profiles WHERE id = $1 AND user_id = $2`,
+			value, userID), &profile)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import profile"})
+			return
+		}
+		mapping = profile.Mapping
+	}
+	if value := c.PostForm("mapping"); value != "" {
+		mapping = models.CSVMapping{}
+		if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping: " + err.Error()})
+			return
+		}
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	switch format {
+	case "":
+		format = importer.DetectFormat(file.Filename, data)
+	case "qfx":
+		format = "ofx"
+	case "csv", "ofx", "qif":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, ofx, qfx or qif"})
+		return
+	}
+	saveProfile := c.PostForm("save_profile")
+	if saveProfile != "" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "save_profile is only for CSV statements"})
+		return
+	}
+
+	// Only CSV reads the whole mapping; QIF takes its date_format
+	var rows []models.ImportRow
+	var usedMapping *models.CSVMapping
+	switch format {
+	case "csv":
+		mapping, rows, err = importer.ParseCSV(data, mapping)
+		usedMapping = &mapping
+	case "ofx":
+		rows, err = importer.ParseOFX(data)
+	case "qif":
+		var dateFormat string
+		dateFormat, rows, err = importer.ParseQIF(data, mapping.DateFormat)
+		usedMapping = &models.CSVMapping{DateFormat: dateFormat}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	expenseCategory := c.DefaultPostForm("expense_category", defaultImportExpenseCategory)
+	incomeCategory := c.DefaultPostForm("income_category", defaultImportIncomeCategory)
+	for i := range rows {
+		if rows[i].Category == "" && rows[i].Type == "expense" {
+			rows[i].Category = expenseCategory
+		}
+		if rows[i].Category == "" && rows[i].Type == "income" {
+			rows[i].Category = incomeCategory
+		}
+	}
+
+	imp := models.Import{
+		UserID:   userID,
+		Format:   format,
+		Filename: filepath.Base(file.Filename),
+		Mapping:  usedMapping,
+		Status:   "preview",
+		Rows:     rows,
+	}
+	if len(imp.Filename) > 255 {
+		imp.Filename = imp.Filename[:255]
+	}
+
+	// Check the rows by applying them and rolling back
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	accounts, err := lockAccounts(tx, userID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	account, err := accounts.open(accountID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	imp.AccountID = account.ID
+
+	if _, _, err := applyImportRows(tx, userID, accounts, imp.AccountID, imp.Rows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check statement"})
+		return
+	}
+	if err := tx.Rollback(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check statement"})
+		return
+	}
+
+	if saveProfile != "" {
+		if len(saveProfile) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "save_profile must be at most 100 characters"})
+			return
+		}
+		if _, err := saveImportProfile(h.db, userID, saveProfile, mapping); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save import profile"})
+			return
+		}
+	}
+
+	var mappingJSON interface{}
+	if imp.Mapping != nil {
+		encoded, _ := json.Marshal(imp.Mapping)
+		mappingJSON = string(encoded)
+	}
+	rowsJSON, _ := json.Marshal(imp.Rows)
+	query := `INSERT INTO imports (user_id, account_id, format, filename, mapping, rows, status, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, 'preview', NOW())
+			  RETURNING ` + importColumns
+	err = scanImport(h.db.QueryRow(query, userID, imp.AccountID, imp.Format, imp.Filename, mappingJSON, string(rowsJSON)), &imp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save import"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, imp)
+}
+
+func (h *Handler) GetImport(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var imp models.Import
+	err := scanImport(h.db.QueryRow(`SELECT `+importColumns+` FROM imports WHERE id = $1 AND user_id = $2`, c.Param("id"), userID), &imp)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import"})
+		return
+	}
+
+	c.JSON(http.StatusOK, imp)
+}
+
+// CommitImport creates the transactions of a previewed import in one
+// database transaction. Rows that failed the preview, or fail now, reject
+// the whole import unless skip_invalid is set, in which case only the
+// valid rows are imported. Duplicates are always skipped.
+func (h *Handler) CommitImport(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.ImportCommitRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	accounts, err := lockAccounts(tx, userID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	var imp models.Import
+	query := `SELECT ` + importColumns + ` FROM imports WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	if err := scanImport(tx.QueryRow(query, c.Param("id"), userID), &imp); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import"})
+		return
+	}
+	if imp.Status == "committed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Import was already committed"})
+		return
+	}
+	if _, err := accounts.open(&imp.AccountID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	invalid := imp.Invalid > 0
+	outcome, indexes, err := applyImportRows(tx, userID, accounts, imp.AccountID, imp.Rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import transactions"})
+		return
+	}
+	countImportRows(&imp)
+	if (invalid || len(outcome.failed) > 0) && !req.SkipInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Some rows cannot be imported; fix them or set skip_invalid",
+			"import": imp,
+		})
+		return
+	}
+
+	// Link the new transactions to the import and the bank's ids
+	for i, result := range outcome.results {
+		if result.Transaction == nil {
+			continue
+		}
+		row := &imp.Rows[indexes[i]]
+		row.TransactionID = &result.Transaction.ID
+		_, err := tx.Exec(`INSERT INTO imported_transactions (transaction_id, import_id, account_id, external_id)
+						   VALUES ($1, $2, $3, NULLIF($4, ''))`, result.Transaction.ID, imp.ID, imp.AccountID, row.ExternalID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record imported transaction"})
+			return
+		}
+	}
+
+	if err := outcome.deltas.apply(tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
+		return
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	rowsJSON, _ := json.Marshal(imp.Rows)
+	query = `UPDATE imports SET status = 'committed', rows = $1, committed_at = NOW() WHERE id = $2 RETURNING ` + importColumns
+	if err := scanImport(tx.QueryRow(query, string(rowsJSON), imp.ID), &imp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update import"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, imp)
+}
+
+// applyImportRows marks the rows whose external id was already imported
+// into the wallet, or appears earlier in the same statement, as duplicates,
+// and creates a transaction for each remaining row without an error. Rows
+// that fail a check get its message as their error. indexes maps each
+// operation of the outcome to its row.
+func applyImportRows(tx *sql.Tx, userID int, accounts userAccounts, accountID int, rows []models.ImportRow) (batchOutcome, []int, error) {
+	var externalIDs []string
+	for _, row := range rows {
+		if row.ExternalID != "" {
+			externalIDs = append(externalIDs, row.ExternalID)
+		}
+	}
+
+	imported := map[string]bool{}
+	if len(externalIDs) > 0 {
+		result, err := tx.Query(`SELECT external_id FROM imported_transactions WHERE account_id = $1 AND external_id = ANY($2)`,
+			accountID, pq.Array(externalIDs))
+		if err != nil {
+			return batchOutcome{}, nil, err
+		}
+		defer result.Close()
+		for result.Next() {
+			var externalID string
+			if err := result.Scan(&externalID); err != nil {
+				return batchOutcome{}, nil, err
+			}
+			imported[externalID] = true
+		}
+		if err := result.Err(); err != nil {
+			return batchOutcome{}, nil, err
+		}
+	}
+
+	var operations []batchOperation
+	var indexes []int
+	for i := range rows {
+		row := &rows[i]
+		row.Duplicate = row.ExternalID != "" && imported[row.ExternalID]
+		if row.ExternalID != "" {
+			imported[row.ExternalID] = true
+		}
+		if row.Error == "" && len(row.ExternalID) > 255 {
+			row.Error = "external id is longer than 255 characters"
+		}
+		if row.Error != "" || row.Duplicate {
+			continue
+		}
+
+		date, err := time.Parse("2006-01-02", row.Date)
+		if err != nil {
+			row.Error = "invalid date '" + row.Date + "'"
+			continue
+		}
+		operations = append(operations, batchOperation{
+			op: "create",
+			create: models.TransactionRequest{
+				AccountID:   &accountID,
+				Amount:      row.Amount,
+				Type:        row.Type,
+				Category:    row.Category,
+				Description: row.Description,
+				Date:        row.Date,
+			},
+			date: date,
+		})
+		indexes = append(indexes, i)
+	}
+
+	outcome, err := applyOperations(tx, userID, accounts, operations)
+	if err != nil {
+		return outcome, nil, err
+	}
+	for _, failed := range outcome.failed {
+		rows[indexes[failed.Index]].Error = failed.Error
+	}
+	return outcome, indexes, nil
+}
+
+// Import profiles
+
+const importProfileColumns = `id, user_id, name, mapping, created_at, updated_at`
+
+// scanImportProfile reads a row selected with importProfileColumns.
+func scanImportProfile(row rowScanner, profile *models.ImportProfile) error {
+	var mapping []byte
+	if err := row.Scan(&profile.ID, &profile.UserID, &profile.Name, &mapping, &profile.CreatedAt, &profile.UpdatedAt); err != nil {
+		return err
+	}
+	profile.Mapping = models.CSVMapping{}
+	return json.Unmarshal(mapping, &profile.Mapping)
+}
+
+// saveImportProfile creates the named profile or replaces its mapping.
+func saveImportProfile(q ledger.Querier, userID int, name string, mapping models.CSVMapping) (models.ImportProfile, error) {
+	var profile models.ImportProfile
+	mappingJSON, err := json.Marshal(mapping)
+	if err != nil {
+		return profile, err
+	}
+	query := `INSERT INTO import_profiles (user_id, name, mapping, created_at, updated_at)
+			  VALUES ($1, $2, $3, NOW(), NOW())
+			  ON CONFLICT (user_id, name) DO UPDATE SET mapping = EXCLUDED.mapping, updated_at = NOW()
+			  RETURNING ` + importProfileColumns
+	err = scanImportProfile(q.QueryRow(query, userID, name, string(mappingJSON)), &profile)
+	return profile, err
+}
+
+func (h *Handler) GetImportProfiles(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	rows, err := h.db.Query(`SELECT `+importProfileColumns+` FROM import_profiles WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import profiles"})
+		return
+	}
+	defer rows.Close()
+
+	profiles := []models.ImportProfile{}
+	for rows.Next() {
+		var profile models.ImportProfile
+		if err := scanImportProfile(rows, &profile); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan import profile"})
+			return
+		}
+		profiles = append(profiles, profile)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles})
+}
+
+// CreateImportProfile saves a mapping under a name, replacing the mapping
+// of a profile with the same name.
+func (h *Handler) CreateImportProfile(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.ImportProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := saveImportProfile(h.db, userID, req.Name, req.Mapping)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save import profile"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, profile)
+}
+
+func (h *Handler) UpdateImportProfile(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.ImportProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mappingJSON, err := json.Marshal(req.Mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping"})
+		return
+	}
+
+	var profile models.ImportProfile
+	query := `UPDATE import_profiles SET name = $1, mapping = $2, updated_at = NOW()
+			  WHERE id = $3 AND user_id = $4
+			  RETURNING ` + importProfileColumns
+	if err := scanImportProfile(h.db.QueryRow(query, req.Name, string(mappingJSON), c.Param("id"), userID), &profile); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+			return
+		}
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "An import profile with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update import profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func (h *Handler) DeleteImportProfile(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	result, err := h.db.Exec("DELETE FROM import_profiles WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete import profile"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Import profile deleted successfully"})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadStatement calls CreateImport as userID with statement as the file
+// and returns the preview.
+func uploadStatement(t *testing.T, h *Handler, userID int, filename, statement string) models.Import {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(statement))
+	form.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	c.Set("user_id", userID)
+	h.CreateImport(c)
+
+	var imp models.Import
+	decode(t, w, http.StatusCreated, &imp)
+	return imp
+}
+
+// importState returns the balance of the user's primary wallet and the
+// number of their transactions.
+func importState(t *testing.T, h *Handler, userID int) (models.Money, int) {
+	t.Helper()
+	var balance models.Money
+	var count int
+	err := h.db.QueryRow(`SELECT balance, (SELECT COUNT(*) FROM transactions WHERE user_id = $1)
+		FROM accounts WHERE user_id = $1 AND is_primary`, userID).Scan(&balance, &count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance, count
+}
+
+func TestCommitImport(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+
+	imp := uploadStatement(t, h, userID, "statement.csv", "Date,Description,Amount,Reference\n"+
+		"2026-01-05,Coffee,-4.50,A1\n"+
+		"2026-01-06,Payroll,1200.00,A2\n"+
+		"2026-01-07,Unreadable,abc,A3\n")
+	if imp.Valid != 2 || imp.Invalid != 1 || imp.Duplicates != 0 {
+		t.Fatalf("preview counts %d valid, %d invalid, %d duplicates, want 2, 1, 0", imp.Valid, imp.Invalid, imp.Duplicates)
+	}
+	id := strconv.Itoa(imp.ID)
+
+	// An invalid row rejects the whole import
+	decode(t, serve(h.CommitImport, userID, http.MethodPost, nil, "id", id), http.StatusBadRequest, nil)
+	if balance, count := importState(t, h, userID); balance != 0 || count != 0 {
+		t.Fatalf("rejected import left balance %d and %d transactions", balance, count)
+	}
+
+	var committed models.Import
+	w := serve(h.CommitImport, userID, http.MethodPost, models.ImportCommitRequest{SkipInvalid: true}, "id", id)
+	decode(t, w, http.StatusOK, &committed)
+	if committed.Status != "committed" {
+		t.Fatalf("status %q, want committed", committed.Status)
+	}
+	for i, row := range committed.Rows {
+		if (row.TransactionID != nil) != (row.Error == "") {
+			t.Errorf("row %d: transaction %v with error %q", i, row.TransactionID, row.Error)
+		}
+	}
+	if balance, count := importState(t, h, userID); balance != 119550 || count != 2 {
+		t.Fatalf("balance %d with %d transactions, want 119550 with 2", balance, count)
+	}
+	if err := ledger.Verify(h.db, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	decode(t, serve(h.CommitImport, userID, http.MethodPost, nil, "id", id), http.StatusConflict, nil)
+
+	// A second statement overlapping the first skips what was imported
+	imp = uploadStatement(t, h, userID, "statement.csv", "Date,Description,Amount,Reference\n"+
+		"2026-01-06,Payroll,1200.00,A2\n"+
+		"2026-01-08,Lunch,-10.00,A4\n")
+	if imp.Valid != 1 || imp.Duplicates != 1 || !imp.Rows[0].Duplicate {
+		t.Fatalf("preview counts %d valid, %d duplicates, want 1, 1", imp.Valid, imp.Duplicates)
+	}
+	decode(t, serve(h.CommitImport, userID, http.MethodPost, nil, "id", strconv.Itoa(imp.ID)), http.StatusOK, nil)
+	if balance, count := importState(t, h, userID); balance != 118550 || count != 3 {
+		t.Fatalf("balance %d with %d transactions, want 118550 with 3", balance, count)
+	}
+	if err := ledger.Verify(h.db, userID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"student-money-manager/ledger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetLedgerAccounts(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	accounts, err := ledger.Accounts(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+func (h *Handler) GetJournalEntries(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	entries, err := ledger.Entries(h.db, userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch journal entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+func (h *Handler) VerifyLedger(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	report, err := ledger.Check(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":     report.OK(),
+		"report": report,
+	})
+}
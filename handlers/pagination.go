@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination
+
+// transactionSorts are the values of the sort parameter of transaction
+// lists.
+var transactionSorts = map[string]bool{
+	"date":        true,
+	"amount":      true,
+	"created_at":  true,
+	"category":    true,
+	"description": true,
+}
+
+// pageSort orders a list by column, then by created_at and id in the same
+// direction, so every row has a unique position a cursor can point after.
+type pageSort struct {
+	column string
+	desc   bool
+}
+
+// pageCursor is the position of the last row of a page. Value is that row's
+// sort column as text and is empty when sorting by created_at.
+type pageCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	Value     string    `json:"v,omitempty"`
+	CreatedAt time.Time `json:"c"`
+	ID        int       `json:"i"`
+}
+
+// parseTransactionSort reads the sort and order parameters. The default is
+// newest first.
+func parseTransactionSort(c *gin.Context) (pageSort, error) {
+	column := c.DefaultQuery("sort", "date")
+	if !transactionSorts[column] {
+		names := make([]string, 0, len(transactionSorts))
+		for name := range transactionSorts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return pageSort{}, requestError("sort must be one of " + strings.Join(names, ", "))
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		return pageSort{column: column}, nil
+	case "desc":
+		return pageSort{column: column, desc: true}, nil
+	}
+	return pageSort{}, requestError("order must be asc or desc")
+}
+
+// keys lists the columns rows are ordered by.
+func (s pageSort) keys() []string {
+	if s.column == "created_at" {
+		return []string{"created_at", "id"}
+	}
+	return []string{s.column, "created_at", "id"}
+}
+
+func (s pageSort) orderBy() string {
+	direction := " ASC"
+	if s.desc {
+		direction = " DESC"
+	}
+	return " ORDER BY " + strings.Join(s.keys(), direction+", ") + direction
+}
+
+// after appends the condition for rows following cursor to a query and
+// returns the query with its arguments.
+func (s pageSort) after(query string, args []interface{}, cursor pageCursor) (string, []interface{}) {
+	values := []interface{}{cursor.CreatedAt, cursor.ID}
+	if s.column != "created_at" {
+		values = append([]interface{}{cursor.Value}, values...)
+	}
+
+	params := make([]string, len(values))
+	for i, value := range values {
+		args = append(args, value)
+		params[i] = "$" + strconv.Itoa(len(args))
+	}
+
+	operator := " > "
+	if s.desc {
+		operator = " < "
+	}
+	return query + " AND (" + strings.Join(s.keys(), ", ") + ")" + operator + "(" + strings.Join(params, ", ") + ")", args
+}
+
+// cursor is the position of a row whose sort column holds value.
+func (s pageSort) cursor(value string, createdAt time.Time, id int) pageCursor {
+	return pageCursor{Sort: s.column, Desc: s.desc, Value: value, CreatedAt: createdAt, ID: id}
+}
+
+// transactionSortValue is the sort column of t as text for a cursor.
+func transactionSortValue(column string, t models.Transaction) string {
+	switch column {
+	case "date":
+		return formatTimestamp(t.Date)
+	case "amount":
+		return t.Amount.String()
+	case "category":
+		return t.Category
+	case "description":
+		return t.Description
+	}
+	return ""
+}
+
+// formatTimestamp writes t the way Postgres reads a TIMESTAMP, without the
+// zone it was scanned with.
+func formatTimestamp(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05.999999")
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// parseCursor reads the cursor parameter, which must have been returned for
+// the same sort and order.
+func parseCursor(c *gin.Context, s pageSort) (*pageCursor, error) {
+	value := c.Query("cursor")
+	if value == "" {
+		return nil, nil
+	}
+
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(data, &cursor) != nil || cursor.ID == 0 {
+		return nil, requestError("Invalid cursor")
+	}
+	if cursor.Sort != s.column || cursor.Desc != s.desc {
+		return nil, requestError("cursor was returned for a different sort or order")
+	}
+	return &cursor, nil
+}
+
+// parseLimit reads the limit and offset parameters. limit defaults to 20
+// and may be at most 100.
+func parseLimit(c *gin.Context) (int, int, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		return 0, 0, requestError("limit must be between 1 and 100")
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		return 0, 0, requestError("offset must be a non-negative integer")
+	}
+	return limit, offset, nil
+}
+
+// parsePage reads the limit, offset and cursor parameters. offset cannot be
+// combined with a cursor.
+func parsePage(c *gin.Context, s pageSort) (int, int, *pageCursor, error) {
+	limit, offset, err := parseLimit(c)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	cursor, err := parseCursor(c, s)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if cursor != nil && offset > 0 {
+		return 0, 0, nil, requestError("offset cannot be combined with cursor")
+	}
+	return limit, offset, cursor, nil
+}
+
+// paginate appends the cursor condition, order and limit to a query. One row
+// more than limit is fetched to tell whether there is a next page.
+func paginate(query string, args []interface{}, s pageSort, limit, offset int, cursor *pageCursor) (string, []interface{}) {
+	if cursor != nil {
+		query, args = s.after(query, args, *cursor)
+	}
+	query += s.orderBy()
+
+	args = append(args, limit+1)
+	query += " LIMIT $" + strconv.Itoa(len(args))
+
+	if offset > 0 {
+		args = append(args, offset)
+		query += " OFFSET $" + strconv.Itoa(len(args))
+	}
+	return query, args
+}
+
+// wantTotal reports whether the client asked for the total number of rows
+// with ?include_total=true.
+func wantTotal(c *gin.Context) (bool, error) {
+	value := c.Query("include_total")
+	if value == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, requestError("include_total must be true or false")
+	}
+	return include, nil
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"student-money-manager/recurring"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recurring rules
+
+func (h *Handler) GetRecurringRules(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	query := `SELECT ` + recurring.RuleColumns + `
+			  FROM recurring_rules WHERE user_id = $1 ORDER BY is_active DESC, start_date, id`
+	rows, err := h.db.Query(query, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurring rules"})
+		return
+	}
+	defer rows.Close()
+
+	rules := []models.RecurringRule{}
+	for rows.Next() {
+		var rule models.RecurringRule
+		if err := recurring.ScanRule(rows, &rule); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan recurring rule"})
+			return
+		}
+		rules = append(rules, rule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (h *Handler) CreateRecurringRule(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.RecurringRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accounts, err := h.listAccounts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+		return
+	}
+	account, err := accounts.open(req.AccountID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	rule := models.RecurringRule{
+		AccountID:   account.ID,
+		Type:        req.Type,
+		Amount:      req.Amount,
+		Category:    req.Category,
+		Description: req.Description,
+		Frequency:   req.Frequency,
+		RRule:       req.RRule,
+	}
+	if err := setRuleDates(&rule, &req.StartDate, req.EndDate); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if err := checkRule(&rule); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if err := checkRuleCategory(h.db, userID, &rule); err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	query := `INSERT INTO recurring_rules (user_id, account_id, type, amount, category, description, frequency, rrule,
+			  start_date, end_date, is_active, created_at, updated_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, true, NOW(), NOW())
+			  RETURNING ` + recurring.RuleColumns
+
+	err = recurring.ScanRule(h.db.QueryRow(query, userID, rule.AccountID, rule.Type, rule.Amount, rule.Category,
+		rule.Description, rule.Frequency, rule.RRule, rule.StartDate, rule.EndDate), &rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recurring rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *Handler) GetRecurringRule(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var rule models.RecurringRule
+	if !h.findRule(c, userID, &rule) {
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) PatchRecurringRule(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.RecurringRulePatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rule models.RecurringRule
+	if !h.findRule(c, userID, &rule) {
+		return
+	}
+
+	if req.AccountID != nil {
+		accounts, err := h.listAccounts(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+			return
+		}
+		if _, err := accounts.open(req.AccountID); err != nil {
+			respondAccountError(c, err)
+			return
+		}
+		rule.AccountID = *req.AccountID
+	}
+	if req.Type != nil {
+		rule.Type = *req.Type
+	}
+	if req.Amount != nil {
+		rule.Amount = *req.Amount
+	}
+	if req.Category != nil {
+		rule.Category = *req.Category
+	}
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	if req.Frequency != nil {
+		rule.Frequency = *req.Frequency
+	}
+	if req.RRule != nil {
+		rule.RRule = *req.RRule
+	}
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+	if req.StartDate != nil || req.EndDate != nil {
+		endDate := req.EndDate
+		if endDate == nil && rule.EndDate != nil {
+			current := rule.EndDate.Format("2006-01-02")
+			endDate = &current
+		}
+		if err := setRuleDates(&rule, req.StartDate, endDate); err != nil {
+			respondAccountError(c, err)
+			return
+		}
+	}
+	if err := checkRule(&rule); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	// An archived category stays usable by rules that already had it
+	if req.Category != nil || req.Type != nil {
+		if err := checkRuleCategory(h.db, userID, &rule); err != nil {
+			respondCategoryError(c, err)
+			return
+		}
+	}
+
+	query := `UPDATE recurring_rules
+			  SET account_id = $1, type = $2, amount = $3, category = $4, description = $5, frequency = $6, rrule = $7,
+			  start_date = $8, end_date = $9, is_active = $10, updated_at = NOW()
+			  WHERE id = $11 AND user_id = $12
+			  RETURNING ` + recurring.RuleColumns
+
+	err := recurring.ScanRule(h.db.QueryRow(query, rule.AccountID, rule.Type, rule.Amount, rule.Category, rule.Description,
+		rule.Frequency, rule.RRule, rule.StartDate, rule.EndDate, rule.IsActive, rule.ID, userID), &rule)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recurring rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recurring rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRecurringRule removes a rule. Transactions it already created are
+// kept and lose their link to the rule.
+func (h *Handler) DeleteRecurringRule(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	result, err := h.db.Exec("DELETE FROM recurring_rules WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring rule"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recurring rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring rule deleted successfully"})
+}
+
+// PreviewRecurringRule lists the next occurrences of a saved rule that have
+// not been materialized yet. ?count= defaults to 10, at most 100.
+func (h *Handler) PreviewRecurringRule(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	count, ok := previewCount(c)
+	if !ok {
+		return
+	}
+
+	var rule models.RecurringRule
+	if !h.findRule(c, userID, &rule) {
+		return
+	}
+
+	respondPreview(c, rule, count)
+}
+
+// PreviewRecurringDraft lists the occurrences a rule would have, without
+// saving it.
+func (h *Handler) PreviewRecurringDraft(c *gin.Context) {
+	count, ok := previewCount(c)
+	if !ok {
+		return
+	}
+
+	var req models.RecurringRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.RecurringRule{
+		Type:        req.Type,
+		Amount:      req.Amount,
+		Category:    req.Category,
+		Description: req.Description,
+		Frequency:   req.Frequency,
+		RRule:       req.RRule,
+		IsActive:    true,
+	}
+	if err := setRuleDates(&rule, &req.StartDate, req.EndDate); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if err := checkRule(&rule); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if err := checkRuleCategory(h.db, c.GetInt("user_id"), &rule); err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+
+	respondPreview(c, rule, count)
+}
+
+// RunRecurringRules materializes the user's due occurrences now.
+func (h *Handler) RunRecurringRules(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	result, err := recurring.Due(h.db, userID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run recurring rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// findRule loads the rule named by the :id parameter and writes the error
+// response when it cannot.
+func (h *Handler) findRule(c *gin.Context, userID int, rule *models.RecurringRule) bool {
+	ruleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurring rule ID"})
+		return false
+	}
+
+	query := `SELECT ` + recurring.RuleColumns + ` FROM recurring_rules WHERE id = $1 AND user_id = $2`
+	if err := recurring.ScanRule(h.db.QueryRow(query, ruleID, userID), rule); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recurring rule not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurring rule"})
+		return false
+	}
+	return true
+}
+
+// setRuleDates parses the start and end dates of a rule. A nil startDate
+// keeps the current one; a nil or empty endDate removes the end date.
+func setRuleDates(rule *models.RecurringRule, startDate, endDate *string) error {
+	if startDate != nil {
+		start, err := time.Parse("2006-01-02", *startDate)
+		if err != nil {
+			return requestError("Invalid start_date format. Use YYYY-MM-DD")
+		}
+		rule.StartDate = start
+	}
+
+	rule.EndDate = nil
+	if endDate != nil && *endDate != "" {
+		end, err := time.Parse("2006-01-02", *endDate)
+		if err != nil {
+			return requestError("Invalid end_date format. Use YYYY-MM-DD")
+		}
+		rule.EndDate = &end
+	}
+	return nil
+}
+
+// checkRule validates the schedule and category of a rule.
+func checkRule(rule *models.RecurringRule) error {
+	if rule.Frequency != recurring.FrequencyCustom {
+		rule.RRule = ""
+	}
+	if _, err := recurring.ForFrequency(rule.Frequency, rule.RRule); err != nil {
+		return requestError("Invalid schedule: " + err.Error())
+	}
+	if rule.EndDate != nil && rule.EndDate.Before(rule.StartDate) {
+		return requestError("end_date must not be before start_date")
+	}
+	if rule.Category == transferCategory || rule.Category == splitCategory {
+		return requestError("'" + rule.Category + "' cannot be used as the category of a recurring rule")
+	}
+	return nil
+}
+
+// checkRuleCategory makes sure the category of a rule is one of the user's
+// categories of the rule's type that is not archived.
+func checkRuleCategory(q ledger.Querier, userID int, rule *models.RecurringRule) error {
+	cat, err := resolveCategory(q, userID, rule.Type, nil, rule.Category, nil)
+	if err != nil {
+		return err
+	}
+	rule.Category = cat.Name
+	return nil
+}
+
+func previewCount(c *gin.Context) (int, bool) {
+	count, err := strconv.Atoi(c.DefaultQuery("count", "10"))
+	if err != nil || count < 1 || count > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and 100"})
+		return 0, false
+	}
+	return count, true
+}
+
+func respondPreview(c *gin.Context, rule models.RecurringRule, count int) {
+	dates, err := recurring.Upcoming(rule, time.Now(), count)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule: " + err.Error()})
+		return
+	}
+
+	occurrences := []models.Occurrence{}
+	if rule.IsActive {
+		for _, date := range dates {
+			occurrences = append(occurrences, models.Occurrence{
+				Date:        date,
+				Amount:      rule.Amount,
+				Type:        rule.Type,
+				Category:    rule.Category,
+				Description: rule.Description,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rule_id":     rule.ID,
+		"occurrences": occurrences,
+	})
+}
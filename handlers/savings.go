@@ -3,10 +3,9 @@ package handlers
 import (
 	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
-	"strings"
+	"student-money-manager/ledger"
 	"student-money-manager/models"
 	"time"
 
@@ -175,25 +174,48 @@ func (h *Handler) DeleteSavingsGoal(c *gin.Context) {
 
 // Savings Transactions
 
+// GetSavingsTransactions lists savings deposits and withdrawals newest first,
+// paginated like GetTransactions.
 func (h *Handler) GetSavingsTransactions(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
-	query := `SELECT id, user_id, goal_id, amount, type, description, date, created_at, updated_at
-			  FROM savings_transactions WHERE user_id = $1 ORDER BY date DESC, created_at DESC`
+	order := pageSort{column: "date", desc: true}
+	limit, offset, cursor, err := parsePage(c, order)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	includeTotal, err := wantTotal(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
 
-	rows, err := h.db.Query(query, userID)
+	var total *int
+	if includeTotal {
+		total = new(int)
+		if err := h.db.QueryRow(`SELECT COUNT(*) FROM savings_transactions WHERE user_id = $1`, userID).Scan(total); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count savings transactions"})
+			return
+		}
+	}
+
+	query, args := paginate(`SELECT id, user_id, account_id, goal_id, amount, type, description, date, created_at, updated_at
+			  FROM savings_transactions WHERE user_id = $1`, []interface{}{userID}, order, limit, offset, cursor)
+
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch savings transactions"})
 		return
 	}
 	defer rows.Close()
 
-	var transactions []models.SavingsTransaction
+	transactions := []models.SavingsTransaction{}
 	for rows.Next() {
 		var transaction models.SavingsTransaction
 		var goalID sql.NullInt32
 
-		err := rows.Scan(&transaction.ID, &transaction.UserID, &goalID, &transaction.Amount,
+		err := rows.Scan(&transaction.ID, &transaction.UserID, &transaction.AccountID, &goalID, &transaction.Amount,
 			&transaction.Type, &transaction.Description, &transaction.Date,
 			&transaction.CreatedAt, &transaction.UpdatedAt)
 		if err != nil {
@@ -209,7 +231,23 @@ func (h *Handler) GetSavingsTransactions(c *gin.Context) {
 		transactions = append(transactions, transaction)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
+	var nextCursor *string
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		next := encodeCursor(order.cursor(formatTimestamp(last.Date), last.CreatedAt, last.ID))
+		nextCursor = &next
+	}
+
+	response := gin.H{
+		"transactions": transactions,
+		"count":        len(transactions),
+		"next_cursor":  nextCursor,
+	}
+	if total != nil {
+		response["total"] = *total
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // Transfer between current balance and savings
@@ -217,29 +255,12 @@ func (h *Handler) GetSavingsTransactions(c *gin.Context) {
 func (h *Handler) TransferToSavings(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
-	// Log raw JSON body first
-	rawBody, _ := c.GetRawData()
-	fmt.Printf("Raw JSON body: %s\n", string(rawBody))
-
-	// Reset request body for binding
-	c.Request.Body = ioutil.NopCloser(strings.NewReader(string(rawBody)))
-
 	var req models.SavingsTransferRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Debug logging
-	fmt.Printf("Received transfer request: Amount=%f, Type=%s, GoalID=%v\n", req.Amount, req.Type, req.GoalID)
-
-	// Additional debug for goal ID
-	if req.GoalID != nil {
-		fmt.Printf("Goal ID is provided: %d\n", *req.GoalID)
-	} else {
-		fmt.Printf("No Goal ID provided - this withdrawal will not affect specific goals\n")
-	}
-
 	// Start transaction
 	tx, err := h.db.Begin()
 	if err != nil {
@@ -248,16 +269,24 @@ func (h *Handler) TransferToSavings(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	// Get current account balances
-	var currentBalance, savingsBalance float64
-	query := `SELECT balance, savings_balance FROM accounts WHERE user_id = $1`
-	err = tx.QueryRow(query, userID).Scan(&currentBalance, &savingsBalance)
+	// Get current account balances and lock the rows until commit, so a
+	// concurrent transfer sees our result instead of the stale balances.
+	// Money moves out of or into the selected wallet, while the savings
+	// balance is kept on the primary account.
+	accounts, err := lockAccounts(tx, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get account balance"})
+		respondAccountError(c, err)
 		return
 	}
+	wallet, err := accounts.open(req.AccountID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	primary := accounts.primary()
+	currentBalance, savingsBalance := wallet.Balance, primary.SavingsBalance
 
-	var newCurrentBalance, newSavingsBalance float64
+	var newCurrentBalance, newSavingsBalance models.Money
 	var transactionType string
 	var description string
 
@@ -285,7 +314,7 @@ func (h *Handler) TransferToSavings(c *gin.Context) {
 		// If no specific goal is selected, we need to handle withdrawals from allocated goals
 		if req.GoalID == nil {
 			// Get total amount allocated to active goals
-			var totalGoalAmount float64
+			var totalGoalAmount models.Money
 			goalQuery := `SELECT COALESCE(SUM(CASE WHEN st.type = 'deposit' THEN st.amount WHEN st.type = 'withdrawal' THEN -st.amount ELSE 0 END), 0) as total_goal_amount
 						  FROM savings_goals g
 						  LEFT JOIN savings_transactions st ON g.id = st.goal_id
@@ -300,13 +329,13 @@ func (h *Handler) TransferToSavings(c *gin.Context) {
 			unallocatedSavings := savingsBalance - totalGoalAmount
 			if req.Amount > unallocatedSavings && totalGoalAmount > 0 {
 				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Cannot withdraw $%.2f from general savings. Only $%.2f available in unallocated savings. Please select a specific goal to withdraw from or reduce the amount.", req.Amount, unallocatedSavings),
+					"error": fmt.Sprintf("Cannot withdraw $%s from general savings. Only $%s available in unallocated savings. Please select a specific goal to withdraw from or reduce the amount.", req.Amount, unallocatedSavings),
 				})
 				return
 			}
 		} else {
 			// Validate goal-specific withdrawal
-			var goalCurrentAmount float64
+			var goalCurrentAmount models.Money
 			goalQuery := `SELECT COALESCE(SUM(CASE WHEN st.type = 'deposit' THEN st.amount WHEN st.type = 'withdrawal' THEN -st.amount ELSE 0 END), 0) as current_amount
 						  FROM savings_goals g
 						  LEFT JOIN savings_transactions st ON g.id = st.goal_id
@@ -319,7 +348,7 @@ func (h *Handler) TransferToSavings(c *gin.Context) {
 
 			if req.Amount > goalCurrentAmount {
 				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Cannot withdraw $%.2f from this goal. Only $%.2f available in this goal.", req.Amount, goalCurrentAmount),
+					"error": fmt.Sprintf("Cannot withdraw $%s from this goal. Only $%s available in this goal.", req.Amount, goalCurrentAmount),
 				})
 				return
 			}
@@ -336,8 +365,12 @@ func (h *Handler) TransferToSavings(c *gin.Context) {
 	}
 
 	// Update account balances
-	updateQuery := `UPDATE accounts SET balance = $1, savings_balance = $2, updated_at = NOW() WHERE user_id = $3`
-	_, err = tx.Exec(updateQuery, newCurrentBalance, newSavingsBalance, userID)
+	if err := adjustBalance(tx, wallet.ID, newCurrentBalance-currentBalance); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balances"})
+		return
+	}
+	updateQuery := `UPDATE accounts SET savings_balance = savings_balance + $1, updated_at = NOW() WHERE id = $2`
+	_, err = tx.Exec(updateQuery, newSavingsBalance-savingsBalance, primary.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balances"})
 		return
@@ -345,22 +378,19 @@ func (h *Handler) TransferToSavings(c *gin.Context) {
 
 	// Create savings transaction record
 	var savingsTransaction models.SavingsTransaction
-	savingsQuery := `INSERT INTO savings_transactions (user_id, goal_id, amount, type, description, date, created_at, updated_at)
-					 VALUES ($1, $2, $3, $4, $5, CURRENT_DATE, NOW(), NOW())
-					 RETURNING id, user_id, goal_id, amount, type, description, date, created_at, updated_at`
+	savingsQuery := `INSERT INTO savings_transactions (user_id, account_id, goal_id, amount, type, description, date, created_at, updated_at)
+					 VALUES ($1, $2, $3, $4, $5, $6, CURRENT_DATE, NOW(), NOW())
+					 RETURNING id, user_id, account_id, goal_id, amount, type, description, date, created_at, updated_at`
 
 	var goalID sql.NullInt32
 	if req.GoalID != nil {
 		goalID.Int32 = int32(*req.GoalID)
 		goalID.Valid = true
-		fmt.Printf("Setting goalID to: %d (valid: %t)\n", goalID.Int32, goalID.Valid)
-	} else {
-		fmt.Printf("No goalID provided, setting to NULL\n")
 	}
 
 	var scannedGoalID sql.NullInt32
-	err = tx.QueryRow(savingsQuery, userID, goalID, req.Amount, transactionType, description).Scan(
-		&savingsTransaction.ID, &savingsTransaction.UserID, &scannedGoalID,
+	err = tx.QueryRow(savingsQuery, userID, wallet.ID, goalID, req.Amount, transactionType, description).Scan(
+		&savingsTransaction.ID, &savingsTransaction.UserID, &savingsTransaction.AccountID, &scannedGoalID,
 		&savingsTransaction.Amount, &savingsTransaction.Type, &savingsTransaction.Description,
 		&savingsTransaction.Date, &savingsTransaction.CreatedAt, &savingsTransaction.UpdatedAt)
 	if err != nil {
@@ -374,6 +404,17 @@ func (h *Handler) TransferToSavings(c *gin.Context) {
 		savingsTransaction.GoalID = &goalIDInt
 	}
 
+	// Journal the transfer and make sure the books still agree
+	if _, err := ledger.Post(tx, ledger.ForSavingsTransaction(savingsTransaction)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record journal entry"})
+		return
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Search
+
+// searchHeadline configures the excerpts of search results.
+const searchHeadline = `StartSel=<mark>, StopSel=</mark>, MaxWords=20, MinWords=5`
+
+// SearchTransactions finds transactions whose description or category match
+// the words in ?q=, best match first. q takes web search syntax: quoted
+// phrases, "or" and -excluded words. The filters of GetTransactions apply
+// as well.
+func (h *Handler) SearchTransactions(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	// q is the search text here, not a filter query
+	filter.Query = ""
+	limit, offset, err := parseLimit(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	query, args, err := filterTransactions(`SELECT `+transactionColumns+`,
+			  ts_rank(search_vector, q) AS rank,
+			  ts_headline('english', COALESCE(description, ''), q, '`+searchHeadline+`')
+			  FROM transactions, websearch_to_tsquery('english', $2) q
+			  WHERE user_id = $1 AND search_vector @@ q`, []interface{}{userID, text}, filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	query += " ORDER BY rank DESC, date DESC, id DESC"
+
+	args = append(args, limit)
+	query += " LIMIT $" + strconv.Itoa(len(args))
+
+	args = append(args, offset)
+	query += " OFFSET $" + strconv.Itoa(len(args))
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search transactions"})
+		return
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var r models.SearchResult
+		if err := rows.Scan(append(transactionFields(&r.Transaction), &r.Rank, &r.Highlight)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan transaction"})
+			return
+		}
+		results = append(results, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"count":   len(results),
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+
+	"github.com/lib/pq"
+)
+
+// splitCategory is stored as the category of a transaction whose amount is
+// divided between the categories of its splits.
+const splitCategory = "Split"
+
+// newSplits converts the split lines of a request.
+func newSplits(reqs []models.TransactionSplitRequest) []models.TransactionSplit {
+	splits := make([]models.TransactionSplit, 0, len(reqs))
+	for _, req := range reqs {
+		splits = append(splits, models.TransactionSplit{
+			CategoryID: req.CategoryID,
+			Category:   req.Category,
+			Amount:     req.Amount,
+			Note:       req.Note,
+		})
+	}
+	return splits
+}
+
+// checkSplits makes sure the splits of t add up to its amount and marks it
+// as split.
+func checkSplits(t *models.Transaction) error {
+	var total models.Money
+	for _, split := range t.Splits {
+		if split.Category == transferCategory || split.Category == splitCategory {
+			return requestError("'" + split.Category + "' cannot be used as a split category")
+		}
+		total += split.Amount
+	}
+	if total != t.Amount {
+		return requestError("Splits add up to " + total.String() + " but the transaction amount is " + t.Amount.String())
+	}
+	t.Category = splitCategory
+	return nil
+}
+
+// saveSplits replaces the stored splits of t with t.Splits and fills in
+// their ids.
+func saveSplits(q ledger.Querier, t *models.Transaction) error {
+	if _, err := q.Exec("DELETE FROM transaction_splits WHERE transaction_id = $1", t.ID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO transaction_splits (transaction_id, category_id, category, amount, note, created_at)
+			  VALUES ($1, $2, $3, $4, $5, NOW())
+			  RETURNING id`
+	for i := range t.Splits {
+		split := &t.Splits[i]
+		split.TransactionID = t.ID
+		if err := q.QueryRow(query, t.ID, split.CategoryID, split.Category, split.Amount, split.Note).Scan(&split.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSplits attaches the stored splits to each transaction with one query.
+func loadSplits(q ledger.Querier, transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Transaction, len(transactions))
+	ids := make([]int64, 0, len(transactions))
+	for i := range transactions {
+		transactions[i].Splits = nil
+		byID[transactions[i].ID] = &transactions[i]
+		ids = append(ids, int64(transactions[i].ID))
+	}
+
+	rows, err := q.Query(`SELECT id, transaction_id, category_id, category, amount, COALESCE(note, '')
+						  FROM transaction_splits WHERE transaction_id = ANY($1) ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var split models.TransactionSplit
+		if err := rows.Scan(&split.ID, &split.TransactionID, &split.CategoryID, &split.Category, &split.Amount, &split.Note); err != nil {
+			return err
+		}
+		t := byID[split.TransactionID]
+		t.Splits = append(t.Splits, split)
+	}
+	return rows.Err()
+}
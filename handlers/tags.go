@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Tags
+
+// tagQuery selects tags with the number of transactions carrying each.
+const tagQuery = `SELECT g.id, g.user_id, g.name, g.color, g.created_at, g.updated_at,
+	(SELECT COUNT(*) FROM transaction_tags tt WHERE tt.tag_id = g.id)
+	FROM tags g`
+
+// scanTag reads a row selected with tagQuery.
+func scanTag(row rowScanner, tag *models.Tag) error {
+	return row.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt, &tag.TransactionCount)
+}
+
+// GetTags lists the user's tags. With ?q= it autocompletes: only tags
+// starting with q are returned, most used first, at most ?limit= of them
+// (default 10).
+func (h *Handler) GetTags(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	query := tagQuery + ` WHERE g.user_id = $1 ORDER BY g.name`
+	args := []interface{}{userID}
+	if prefix := c.Query("q"); prefix != "" {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		if err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		query = `SELECT * FROM (` + tagQuery + ` WHERE g.user_id = $1 AND g.name LIKE $2) tags
+				 ORDER BY 7 DESC, 3 LIMIT $3`
+		args = append(args, escapeLike(normalizeTag(prefix))+"%", limit)
+	}
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := scanTag(rows, &tag); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan tag"})
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+func (h *Handler) CreateTag(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, err := checkTagName(req.Name)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	var tagID int
+	query := `INSERT INTO tags (user_id, name, color, created_at, updated_at)
+			  VALUES ($1, $2, $3, NOW(), NOW())
+			  RETURNING id`
+	if err := h.db.QueryRow(query, userID, name, req.Color).Scan(&tagID); err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		return
+	}
+
+	var tag models.Tag
+	if err := scanTag(h.db.QueryRow(tagQuery+` WHERE g.id = $1`, tagID), &tag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// PatchTag renames or recolors a tag. Transactions carrying it show the new
+// name right away.
+func (h *Handler) PatchTag(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	tagID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	var req models.TagPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != nil {
+		name, err := checkTagName(*req.Name)
+		if err != nil {
+			respondAccountError(c, err)
+			return
+		}
+		req.Name = &name
+	}
+
+	query := `UPDATE tags SET name = COALESCE($1, name), color = COALESCE($2, color), updated_at = NOW()
+			  WHERE id = $3 AND user_id = $4`
+	result, err := h.db.Exec(query, req.Name, req.Color, tagID, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	var tag models.Tag
+	if err := scanTag(h.db.QueryRow(tagQuery+` WHERE g.id = $1`, tagID), &tag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag removes a tag from every transaction and deletes it.
+func (h *Handler) DeleteTag(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	result, err := h.db.Exec("DELETE FROM tags WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// GetTagAnalytics totals income and expenses per tag over the transactions
+// matching the same filters as GetTransactions.
+func (h *Handler) GetTagAnalytics(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	query, args, err := filterTransactions(`SELECT tt.tag_id, transactions.type, transactions.amount
+			  FROM transactions JOIN transaction_tags tt ON tt.transaction_id = transactions.id
+			  WHERE transactions.user_id = $1 AND transactions.type IN ('income', 'expense')`, []interface{}{userID}, filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	query = `SELECT g.id, g.name,
+			 COALESCE(SUM(CASE WHEN l.type = 'income' THEN l.amount ELSE 0 END), 0),
+			 COALESCE(SUM(CASE WHEN l.type = 'expense' THEN l.amount ELSE 0 END), 0),
+			 COUNT(l.tag_id)
+			 FROM tags g LEFT JOIN (` + query + `) l ON l.tag_id = g.id
+			 WHERE g.user_id = $1
+			 GROUP BY g.id
+			 ORDER BY 4 DESC, g.name`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+	defer rows.Close()
+
+	analytics := []models.TagAnalytics{}
+	for rows.Next() {
+		var ta models.TagAnalytics
+		if err := rows.Scan(&ta.TagID, &ta.Tag, &ta.TotalIncome, &ta.TotalExpense, &ta.Count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan analytics"})
+			return
+		}
+		analytics = append(analytics, ta)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"analytics": analytics})
+}
+
+// normalizeTag is the stored form of a tag name.
+func normalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// checkTagName normalizes a tag name and rejects names that could not be
+// used in a comma-separated tag filter.
+func checkTagName(name string) (string, error) {
+	name = normalizeTag(name)
+	if name == "" {
+		return "", requestError("Tag names must not be empty")
+	}
+	if len(name) > 50 {
+		return "", requestError("Tag '" + name + "' is longer than 50 characters")
+	}
+	if strings.Contains(name, ",") {
+		return "", requestError("Tag '" + name + "' must not contain a comma")
+	}
+	return name, nil
+}
+
+// checkTags normalizes the tag names of a transaction, dropping duplicates.
+func checkTags(names []string) ([]string, error) {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name, err := checkTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+	return tags, nil
+}
+
+// splitTags parses a comma-separated tag filter, dropping duplicates.
+func splitTags(list string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		if name = normalizeTag(name); name != "" && !seen[name] {
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+// saveTags replaces the tags of t with t.Tags, creating tags the user does
+// not have yet.
+func saveTags(q ledger.Querier, t *models.Transaction) error {
+	if _, err := q.Exec("DELETE FROM transaction_tags WHERE transaction_id = $1", t.ID); err != nil {
+		return err
+	}
+
+	upsert := `INSERT INTO tags (user_id, name, created_at, updated_at)
+			   VALUES ($1, $2, NOW(), NOW())
+			   ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+			   RETURNING id`
+	for _, name := range t.Tags {
+		var tagID int
+		if err := q.QueryRow(upsert, t.UserID, name).Scan(&tagID); err != nil {
+			return err
+		}
+		if _, err := q.Exec(`INSERT INTO transaction_tags (transaction_id, tag_id) VALUES ($1, $2)`, t.ID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags attaches the tag names to each transaction with one query.
+func loadTags(q ledger.Querier, transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Transaction, len(transactions))
+	ids := make([]int64, 0, len(transactions))
+	for i := range transactions {
+		transactions[i].Tags = nil
+		byID[transactions[i].ID] = &transactions[i]
+		ids = append(ids, int64(transactions[i].ID))
+	}
+
+	rows, err := q.Query(`SELECT tt.transaction_id, g.name FROM transaction_tags tt
+						  JOIN tags g ON g.id = tt.tag_id
+						  WHERE tt.transaction_id = ANY($1) ORDER BY g.name`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transactionID int
+		var name string
+		if err := rows.Scan(&transactionID, &name); err != nil {
+			return err
+		}
+		t := byID[transactionID]
+		t.Tags = append(t.Tags, name)
+	}
+	return rows.Err()
+}
+
+// tagCondition is the filter condition for transactions carrying at least
+// min of the tags in the array parameter tags.
+func tagCondition(tags, min string) string {
+	return ` AND (SELECT COUNT(*) FROM transaction_tags tt JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.transaction_id = transactions.id AND g.name = ANY(` + tags + `)) >= ` + min
+}
@@ -3,7 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
-	"strconv"
+	"student-money-manager/ledger"
 	"student-money-manager/models"
 	"time"
 
@@ -13,39 +13,44 @@ import (
 func (h *Handler) GetTransactions(c *gin.Context) {
 	userID := c.GetInt("user_id")
 
-	// Get query parameters for filtering
-	limit := c.DefaultQuery("limit", "5")
-	offset := c.DefaultQuery("offset", "0")
-	category := c.Query("category")
-	transactionType := c.Query("type")
-
-	query := `SELECT id, user_id, amount, type, category, description, date, created_at, updated_at 
-			  FROM transactions WHERE user_id = $1`
-
-	args := []interface{}{userID}
-	argCount := 1
-
-	if category != "" {
-		argCount++
-		query += " AND category = $" + strconv.Itoa(argCount)
-		args = append(args, category)
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
 	}
-
-	if transactionType != "" {
-		argCount++
-		query += " AND type = $" + strconv.Itoa(argCount)
-		args = append(args, transactionType)
+	order, err := parseTransactionSort(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	limit, offset, cursor, err := parsePage(c, order)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	includeTotal, err := wantTotal(c)
+	if err != nil {
+		respondAccountError(c, err)
+		return
 	}
 
-	query += " ORDER BY date DESC, created_at DESC"
+	conditions, args, err := filterTransactions("", []interface{}{userID}, filter)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
 
-	argCount++
-	query += " LIMIT $" + strconv.Itoa(argCount)
-	args = append(args, limit)
+	var total *int
+	if includeTotal {
+		total = new(int)
+		if err := h.db.QueryRow(`SELECT COUNT(*) FROM transactions WHERE user_id = $1`+conditions, args...).Scan(total); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count transactions"})
+			return
+		}
+	}
 
-	argCount++
-	query += " OFFSET $" + strconv.Itoa(argCount)
-	args = append(args, offset)
+	query, args := paginate(`SELECT `+transactionColumns+`
+			  FROM transactions WHERE user_id = $1`+conditions, args, order, limit, offset, cursor)
 
 	rows, err := h.db.Query(query, args...)
 	if err != nil {
@@ -54,22 +59,42 @@ func (h *Handler) GetTransactions(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var transactions []models.Transaction
+	transactions := []models.Transaction{}
 	for rows.Next() {
 		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.UserID, &t.Amount, &t.Type, &t.Category,
-			&t.Description, &t.Date, &t.CreatedAt, &t.UpdatedAt)
-		if err != nil {
+		if err := scanTransaction(rows, &t); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan transaction"})
 			return
 		}
 		transactions = append(transactions, t)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	var nextCursor *string
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		next := encodeCursor(order.cursor(transactionSortValue(order.column, last), last.CreatedAt, last.ID))
+		nextCursor = &next
+	}
+
+	if err := loadSplits(h.db, transactions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch splits"})
+		return
+	}
+	if err := loadTags(h.db, transactions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	response := gin.H{
 		"transactions": transactions,
 		"count":        len(transactions),
-	})
+		"next_cursor":  nextCursor,
+	}
+	if total != nil {
+		response["total"] = *total
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *Handler) CreateTransaction(c *gin.Context) {
@@ -88,36 +113,96 @@ func (h *Handler) CreateTransaction(c *gin.Context) {
 		return
 	}
 
+	tags, err := checkTags(req.Tags)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	accounts, err := lockAccounts(tx, userID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	account, err := accounts.open(req.AccountID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	transaction := models.Transaction{
+		AccountID:   account.ID,
+		ToAccountID: req.ToAccountID,
+		Amount:      req.Amount,
+		Type:        req.Type,
+		CategoryID:  req.CategoryID,
+		Category:    req.Category,
+		Description: req.Description,
+		Date:        date,
+		Splits:      newSplits(req.Splits),
+		EnvelopeID:  req.EnvelopeID,
+		Tags:        tags,
+	}
+	if err := checkTransaction(accounts, nil, &transaction); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if err := resolveTransactionCategories(tx, userID, nil, &transaction); err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+	if err := checkEnvelope(tx, userID, nil, &transaction, req.EnvelopeID == nil); err != nil {
+		respondEnvelopeError(c, err)
+		return
+	}
+
 	// Create transaction
-	var transaction models.Transaction
-	query := `INSERT INTO transactions (user_id, amount, type, category, description, date, created_at, updated_at)
-			  VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
-			  RETURNING id, user_id, amount, type, category, description, date, created_at, updated_at`
-
-	err = h.db.QueryRow(query, userID, req.Amount, req.Type, req.Category, req.Description, date).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Type,
-		&transaction.Category, &transaction.Description, &transaction.Date,
-		&transaction.CreatedAt, &transaction.UpdatedAt)
+	err = scanTransaction(tx.QueryRow(insertTransactionQuery, userID, transaction.AccountID, transaction.ToAccountID, transaction.Amount,
+		transaction.Type, transaction.CategoryID, transaction.Category, transaction.Description, transaction.Date, transaction.EnvelopeID), &transaction)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction"})
 		return
 	}
 
-	// Update account balance
-	var balanceChange float64
-	if req.Type == "income" {
-		balanceChange = req.Amount
-	} else {
-		balanceChange = -req.Amount
+	if err := saveSplits(tx, &transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save splits"})
+		return
+	}
+	if err := saveTags(tx, &transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tags"})
+		return
 	}
 
-	_, err = h.db.Exec("UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE user_id = $2",
-		balanceChange, userID)
-	if err != nil {
+	// Journal the transaction
+	if _, err := ledger.Post(tx, ledger.ForTransaction(transaction)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record journal entry"})
+		return
+	}
+
+	// Update account balances
+	if err := applyBalanceChanges(tx, nil, &transaction); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
 		return
 	}
 
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusCreated, transaction)
 }
 
@@ -126,13 +211,10 @@ func (h *Handler) GetTransaction(c *gin.Context) {
 	transactionID := c.Param("id")
 
 	var transaction models.Transaction
-	query := `SELECT id, user_id, amount, type, category, description, date, created_at, updated_at 
+	query := `SELECT ` + transactionColumns + `
 			  FROM transactions WHERE id = $1 AND user_id = $2`
 
-	err := h.db.QueryRow(query, transactionID, userID).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Type,
-		&transaction.Category, &transaction.Description, &transaction.Date,
-		&transaction.CreatedAt, &transaction.UpdatedAt)
+	err := scanTransaction(h.db.QueryRow(query, transactionID, userID), &transaction)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
@@ -142,7 +224,17 @@ func (h *Handler) GetTransaction(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, transaction)
+	transactions := []models.Transaction{transaction}
+	if err := loadSplits(h.db, transactions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch splits"})
+		return
+	}
+	if err := loadTags(h.db, transactions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transactions[0])
 }
 
 func (h *Handler) UpdateTransaction(c *gin.Context) {
@@ -155,16 +247,35 @@ func (h *Handler) UpdateTransaction(c *gin.Context) {
 		return
 	}
 
-	// Get existing transaction
-	var oldTransaction models.Transaction
-	query := `SELECT id, user_id, amount, type, category, description, date, created_at, updated_at 
-			  FROM transactions WHERE id = $1 AND user_id = $2`
+	// Parse new date
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		return
+	}
+
+	tags, err := checkTags(req.Tags)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
 
-	err := h.db.QueryRow(query, transactionID, userID).Scan(
-		&oldTransaction.ID, &oldTransaction.UserID, &oldTransaction.Amount, &oldTransaction.Type,
-		&oldTransaction.Category, &oldTransaction.Description, &oldTransaction.Date,
-		&oldTransaction.CreatedAt, &oldTransaction.UpdatedAt)
+	accounts, err := lockAccounts(tx, userID)
 	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	// Get existing transaction
+	var oldTransaction models.Transaction
+	if err := lockTransaction(tx, transactionID, userID, &oldTransaction); err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 			return
@@ -173,53 +284,94 @@ func (h *Handler) UpdateTransaction(c *gin.Context) {
 		return
 	}
 
-	// Parse new date
-	date, err := time.Parse("2006-01-02", req.Date)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+	oldSplits := []models.Transaction{oldTransaction}
+	if err := loadSplits(tx, oldSplits); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch splits"})
+		return
+	}
+	oldTransaction = oldSplits[0]
+
+	// Both the old and the new wallets must still be open. Without an
+	// account_id the transaction stays in its current wallet.
+	if err := checkOpen(accounts, oldTransaction); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	transaction := models.Transaction{
+		AccountID:   oldTransaction.AccountID,
+		ToAccountID: req.ToAccountID,
+		Amount:      req.Amount,
+		Type:        req.Type,
+		CategoryID:  req.CategoryID,
+		Category:    req.Category,
+		Description: req.Description,
+		Date:        date,
+		Splits:      newSplits(req.Splits),
+		EnvelopeID:  req.EnvelopeID,
+		Tags:        tags,
+	}
+	if req.AccountID != nil {
+		transaction.AccountID = *req.AccountID
+	}
+	if err := checkTransaction(accounts, &oldTransaction, &transaction); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	if err := resolveTransactionCategories(tx, userID, &oldTransaction, &transaction); err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+	if err := checkEnvelope(tx, userID, &oldTransaction, &transaction, req.EnvelopeID == nil); err != nil {
+		respondEnvelopeError(c, err)
 		return
 	}
 
 	// Update transaction
-	var transaction models.Transaction
-	updateQuery := `UPDATE transactions 
-					SET amount = $1, type = $2, category = $3, description = $4, date = $5, updated_at = NOW()
-					WHERE id = $6 AND user_id = $7
-					RETURNING id, user_id, amount, type, category, description, date, created_at, updated_at`
-
-	err = h.db.QueryRow(updateQuery, req.Amount, req.Type, req.Category, req.Description, date, transactionID, userID).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Type,
-		&transaction.Category, &transaction.Description, &transaction.Date,
-		&transaction.CreatedAt, &transaction.UpdatedAt)
+	err = scanTransaction(tx.QueryRow(updateTransactionQuery, transaction.AccountID, transaction.ToAccountID, transaction.Amount,
+		transaction.Type, transaction.CategoryID, transaction.Category, transaction.Description, transaction.Date, transaction.EnvelopeID,
+		transactionID, userID), &transaction)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
 		return
 	}
 
-	// Update account balance
-	var oldBalanceChange float64
-	if oldTransaction.Type == "income" {
-		oldBalanceChange = -oldTransaction.Amount
-	} else {
-		oldBalanceChange = oldTransaction.Amount
+	// Reverse the journal entry of the old version
+	if err := ledger.ReverseTransaction(tx, userID, oldTransaction.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse journal entry"})
+		return
 	}
 
-	var newBalanceChange float64
-	if req.Type == "income" {
-		newBalanceChange = req.Amount
-	} else {
-		newBalanceChange = -req.Amount
+	if err := saveSplits(tx, &transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save splits"})
+		return
+	}
+	if err := saveTags(tx, &transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tags"})
+		return
 	}
 
-	totalBalanceChange := oldBalanceChange + newBalanceChange
+	// Journal the transaction
+	if _, err := ledger.Post(tx, ledger.ForTransaction(transaction)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record journal entry"})
+		return
+	}
 
-	_, err = h.db.Exec("UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE user_id = $2",
-		totalBalanceChange, userID)
-	if err != nil {
+	// Update account balances
+	if err := applyBalanceChanges(tx, &oldTransaction, &transaction); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
 		return
 	}
 
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, transaction)
 }
 
@@ -233,16 +385,22 @@ func (h *Handler) PatchTransaction(c *gin.Context) {
 		return
 	}
 
-	// Get existing transaction
-	var oldTransaction models.Transaction
-	query := `SELECT id, user_id, amount, type, category, description, date, created_at, updated_at 
-			  FROM transactions WHERE id = $1 AND user_id = $2`
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
 
-	err := h.db.QueryRow(query, transactionID, userID).Scan(
-		&oldTransaction.ID, &oldTransaction.UserID, &oldTransaction.Amount, &oldTransaction.Type,
-		&oldTransaction.Category, &oldTransaction.Description, &oldTransaction.Date,
-		&oldTransaction.CreatedAt, &oldTransaction.UpdatedAt)
+	accounts, err := lockAccounts(tx, userID)
 	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	// Get existing transaction
+	var oldTransaction models.Transaction
+	if err := lockTransaction(tx, transactionID, userID, &oldTransaction); err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 			return
@@ -251,75 +409,89 @@ func (h *Handler) PatchTransaction(c *gin.Context) {
 		return
 	}
 
-	// Prepare update fields with existing values as defaults
-	amount := oldTransaction.Amount
-	transactionType := oldTransaction.Type
-	category := oldTransaction.Category
-	description := oldTransaction.Description
-	date := oldTransaction.Date
+	if err := checkOpen(accounts, oldTransaction); err != nil {
+		respondAccountError(c, err)
+		return
+	}
 
-	// Update only provided fields
-	if req.Amount != nil {
-		amount = *req.Amount
+	oldSplits := []models.Transaction{oldTransaction}
+	if err := loadSplits(tx, oldSplits); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch splits"})
+		return
 	}
-	if req.Type != nil {
-		transactionType = *req.Type
+	if err := loadTags(tx, oldSplits); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
 	}
-	if req.Category != nil {
-		category = *req.Category
+	oldTransaction = oldSplits[0]
+
+	// Start from the existing values and update only provided fields
+	transaction := oldTransaction
+	if err := applyPatch(&transaction, req); err != nil {
+		respondAccountError(c, err)
+		return
 	}
-	if req.Description != nil {
-		description = *req.Description
+	if err := checkTransaction(accounts, &oldTransaction, &transaction); err != nil {
+		respondAccountError(c, err)
+		return
 	}
-	if req.Date != nil {
-		parsedDate, err := time.Parse("2006-01-02", *req.Date)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
-			return
-		}
-		date = parsedDate
+	if err := resolveTransactionCategories(tx, userID, &oldTransaction, &transaction); err != nil {
+		respondCategoryError(c, err)
+		return
+	}
+	// Without an envelope_id a new category or type picks its envelope again
+	autoEnvelope := req.EnvelopeID == nil && (req.CategoryID != nil || req.Category != nil || req.Splits != nil || req.Type != nil)
+	if err := checkEnvelope(tx, userID, &oldTransaction, &transaction, autoEnvelope); err != nil {
+		respondEnvelopeError(c, err)
+		return
 	}
 
 	// Update transaction
-	var transaction models.Transaction
-	updateQuery := `UPDATE transactions 
-					SET amount = $1, type = $2, category = $3, description = $4, date = $5, updated_at = NOW()
-					WHERE id = $6 AND user_id = $7
-					RETURNING id, user_id, amount, type, category, description, date, created_at, updated_at`
-
-	err = h.db.QueryRow(updateQuery, amount, transactionType, category, description, date, transactionID, userID).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Type,
-		&transaction.Category, &transaction.Description, &transaction.Date,
-		&transaction.CreatedAt, &transaction.UpdatedAt)
+	err = scanTransaction(tx.QueryRow(updateTransactionQuery, transaction.AccountID, transaction.ToAccountID, transaction.Amount,
+		transaction.Type, transaction.CategoryID, transaction.Category, transaction.Description, transaction.Date, transaction.EnvelopeID,
+		transactionID, userID), &transaction)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
 		return
 	}
 
-	// Update account balance only if amount or type changed
-	if req.Amount != nil || req.Type != nil {
-		var oldBalanceChange float64
-		if oldTransaction.Type == "income" {
-			oldBalanceChange = -oldTransaction.Amount
-		} else {
-			oldBalanceChange = oldTransaction.Amount
-		}
+	// Reverse the journal entry of the old version
+	if err := ledger.ReverseTransaction(tx, userID, oldTransaction.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse journal entry"})
+		return
+	}
 
-		var newBalanceChange float64
-		if transactionType == "income" {
-			newBalanceChange = amount
-		} else {
-			newBalanceChange = -amount
+	if err := saveSplits(tx, &transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save splits"})
+		return
+	}
+	if req.Tags != nil {
+		if err := saveTags(tx, &transaction); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tags"})
+			return
 		}
+	}
 
-		totalBalanceChange := oldBalanceChange + newBalanceChange
+	// Journal the transaction
+	if _, err := ledger.Post(tx, ledger.ForTransaction(transaction)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record journal entry"})
+		return
+	}
 
-		_, err = h.db.Exec("UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE user_id = $2",
-			totalBalanceChange, userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
-			return
-		}
+	// Update account balances
+	if err := applyBalanceChanges(tx, &oldTransaction, &transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
+		return
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
 	}
 
 	c.JSON(http.StatusOK, transaction)
@@ -329,16 +501,22 @@ func (h *Handler) DeleteTransaction(c *gin.Context) {
 	userID := c.GetInt("user_id")
 	transactionID := c.Param("id")
 
-	// Get existing transaction
-	var transaction models.Transaction
-	query := `SELECT id, user_id, amount, type, category, description, date, created_at, updated_at 
-			  FROM transactions WHERE id = $1 AND user_id = $2`
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
 
-	err := h.db.QueryRow(query, transactionID, userID).Scan(
-		&transaction.ID, &transaction.UserID, &transaction.Amount, &transaction.Type,
-		&transaction.Category, &transaction.Description, &transaction.Date,
-		&transaction.CreatedAt, &transaction.UpdatedAt)
+	accounts, err := lockAccounts(tx, userID)
 	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	// Get existing transaction
+	var transaction models.Transaction
+	if err := lockTransaction(tx, transactionID, userID, &transaction); err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 			return
@@ -347,27 +525,150 @@ func (h *Handler) DeleteTransaction(c *gin.Context) {
 		return
 	}
 
+	if err := checkOpen(accounts, transaction); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	// Attachment contents are removed once nothing else refers to them
+	hashes, err := attachmentHashes(tx, transaction.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments"})
+		return
+	}
+
 	// Delete transaction
-	_, err = h.db.Exec("DELETE FROM transactions WHERE id = $1 AND user_id = $2", transactionID, userID)
+	_, err = tx.Exec("DELETE FROM transactions WHERE id = $1 AND user_id = $2", transactionID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete transaction"})
 		return
 	}
 
-	// Update account balance
-	var balanceChange float64
-	if transaction.Type == "income" {
-		balanceChange = -transaction.Amount
-	} else {
-		balanceChange = transaction.Amount
+	// Reverse its journal entry
+	if err := ledger.ReverseTransaction(tx, userID, transaction.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse journal entry"})
+		return
 	}
 
-	_, err = h.db.Exec("UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE user_id = $2",
-		balanceChange, userID)
-	if err != nil {
+	// Update account balances
+	if err := applyBalanceChanges(tx, &transaction, nil); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account balance"})
 		return
 	}
 
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	h.removeUnusedBlobs(hashes)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Transaction deleted successfully"})
 }
+
+// applyPatch sets the fields of t given in req.
+func applyPatch(t *models.Transaction, req models.TransactionPatchRequest) error {
+	if req.AccountID != nil {
+		t.AccountID = *req.AccountID
+	}
+	if req.ToAccountID != nil {
+		t.ToAccountID = req.ToAccountID
+	}
+	if req.Amount != nil {
+		t.Amount = *req.Amount
+	}
+	if req.Type != nil {
+		t.Type = *req.Type
+	}
+	if req.CategoryID != nil || req.Category != nil {
+		// A single category replaces the splits unless new ones are given
+		t.CategoryID = req.CategoryID
+		if req.Category != nil {
+			t.Category = *req.Category
+		}
+		t.Splits = nil
+	}
+	if req.Splits != nil {
+		t.Splits = newSplits(*req.Splits)
+	}
+	if req.EnvelopeID != nil {
+		t.EnvelopeID = req.EnvelopeID
+		if *req.EnvelopeID == 0 {
+			t.EnvelopeID = nil
+		}
+	}
+	if req.Tags != nil {
+		tags, err := checkTags(*req.Tags)
+		if err != nil {
+			return err
+		}
+		t.Tags = tags
+	}
+	if req.Description != nil {
+		t.Description = *req.Description
+	}
+	if req.Date != nil {
+		parsedDate, err := time.Parse("2006-01-02", *req.Date)
+		if err != nil {
+			return requestError("Invalid date format. Use YYYY-MM-DD")
+		}
+		t.Date = parsedDate
+	}
+	return nil
+}
+
+const transactionColumns = `id, user_id, account_id, to_account_id, amount, type, category_id, category, description, date, created_at, updated_at,
+	recurring_rule_id, envelope_id`
+
+const insertTransactionQuery = `INSERT INTO transactions (user_id, account_id, to_account_id, amount, type, category_id, category,
+	description, date, envelope_id, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
+	RETURNING ` + transactionColumns
+
+const updateTransactionQuery = `UPDATE transactions
+	SET account_id = $1, to_account_id = $2, amount = $3, type = $4, category_id = $5, category = $6, description = $7, date = $8,
+	envelope_id = $9, updated_at = NOW()
+	WHERE id = $10 AND user_id = $11
+	RETURNING ` + transactionColumns
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTransaction reads a row selected with transactionColumns.
+func scanTransaction(row rowScanner, t *models.Transaction) error {
+	return row.Scan(transactionFields(t)...)
+}
+
+// transactionFields are the scan destinations for transactionColumns.
+func transactionFields(t *models.Transaction) []interface{} {
+	return []interface{}{&t.ID, &t.UserID, &t.AccountID, &t.ToAccountID, &t.Amount, &t.Type, &t.CategoryID, &t.Category,
+		&t.Description, &t.Date, &t.CreatedAt, &t.UpdatedAt, &t.RecurringRuleID, &t.EnvelopeID}
+}
+
+// checkOpen makes sure every wallet an existing transaction touches is still
+// open before it is edited or deleted.
+func checkOpen(accounts userAccounts, t models.Transaction) error {
+	if _, err := accounts.open(&t.AccountID); err != nil {
+		return err
+	}
+	if t.ToAccountID != nil {
+		if _, err := accounts.open(t.ToAccountID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockTransaction loads a user's transaction and holds a row lock on it until
+// tx ends, so concurrent edits of the same row are applied one after another.
+func lockTransaction(tx *sql.Tx, transactionID interface{}, userID int, t *models.Transaction) error {
+	query := `SELECT ` + transactionColumns + `
+			  FROM transactions WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	return scanTransaction(tx.QueryRow(query, transactionID, userID), t)
+}
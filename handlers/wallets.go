@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listAccounts reads every wallet of the user without locking them.
+func (h *Handler) listAccounts(userID int) (userAccounts, error) {
+	query := `SELECT ` + accountColumns + `
+			  FROM accounts WHERE user_id = $1 ORDER BY id`
+	rows, err := h.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := userAccounts{}
+	for rows.Next() {
+		var account models.Account
+		if err := scanAccount(rows, &account); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (h *Handler) ListAccounts(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	accounts, err := h.listAccounts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts":      accounts,
+		"total_balance": accounts.total(),
+	})
+}
+
+func (h *Handler) CreateAccount(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.AccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := lockAccounts(tx, userID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	var account models.Account
+	query := `INSERT INTO accounts (user_id, name, type, is_primary, balance, savings_balance, allowance_income, created_at, updated_at)
+			  VALUES ($1, $2, $3, false, $4, 0, 0, NOW(), NOW())
+			  RETURNING ` + accountColumns
+
+	err = scanAccount(tx.QueryRow(query, userID, req.Name, req.Type, req.InitialBalance), &account)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+
+	// Money already in the wallet enters the books as opening equity
+	_, err = ledger.Post(tx, models.JournalEntry{
+		UserID:      userID,
+		Description: "Opening balance of " + account.Name,
+		Date:        time.Now(),
+		Postings: []models.Posting{
+			{Account: ledger.WalletAccount(account.ID), Amount: req.InitialBalance},
+			{Account: ledger.OpeningBalance, Amount: -req.InitialBalance},
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record journal entry"})
+		return
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger verification failed"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+func (h *Handler) PatchAccount(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	var req models.AccountPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var account models.Account
+	query := `UPDATE accounts
+			  SET name = COALESCE($1, name), type = COALESCE($2, type), updated_at = NOW()
+			  WHERE id = $3 AND user_id = $4
+			  RETURNING ` + accountColumns
+
+	err = scanAccount(h.db.QueryRow(query, req.Name, req.Type, accountID, userID), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// CloseAccount retires a wallet. Accounts are never deleted because their
+// transactions keep referring to them; a closed wallet just stops accepting
+// new money movements. Only empty, non-primary wallets can be closed.
+func (h *Handler) CloseAccount(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	accounts, err := lockAccounts(tx, userID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	account, err := accounts.open(&accountID)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	if account.IsPrimary {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The primary account cannot be closed"})
+		return
+	}
+	if account.Balance != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Move the remaining balance of " + account.Balance.String() + " out before closing this account"})
+		return
+	}
+
+	query := `UPDATE accounts SET closed_at = NOW(), updated_at = NOW()
+			  WHERE id = $1 AND user_id = $2
+			  RETURNING ` + accountColumns
+	if err := scanAccount(tx.QueryRow(query, accountID, userID), account); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close account"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
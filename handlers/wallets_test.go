@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"student-money-manager/reconcile"
+	"testing"
+	"time"
+)
+
+// TestReconcileKeepsOpeningBalance checks that the initial balance of a new
+// wallet, which only the journal records, is not taken for drift.
+func TestReconcileKeepsOpeningBalance(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+
+	w := serve(h.CreateAccount, userID, http.MethodPost, map[string]string{"name": "Wallet", "type": "cash", "initial_balance": "250.00"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create wallet: %d %s", w.Code, w.Body)
+	}
+	var wallet models.Account
+	if err := json.Unmarshal(w.Body.Bytes(), &wallet); err != nil {
+		t.Fatal(err)
+	}
+	expense := map[string]interface{}{
+		"account_id": wallet.ID, "amount": "12.50", "type": "expense",
+		"category": "Food & Dining", "date": time.Now().Format("2006-01-02"),
+	}
+	if w := serve(h.CreateTransaction, userID, http.MethodPost, expense); w.Code != http.StatusCreated {
+		t.Fatalf("create expense: %d %s", w.Code, w.Body)
+	}
+
+	for _, repair := range []bool{false, true} {
+		result, err := reconcile.Run(h.db, reconcile.Options{UserID: userID, Repair: repair})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Discrepancies) != 0 {
+			t.Errorf("repair=%v: discrepancies %+v, want none", repair, result.Discrepancies)
+		}
+	}
+
+	var balance models.Money
+	if err := h.db.QueryRow("SELECT balance FROM accounts WHERE id = $1", wallet.ID).Scan(&balance); err != nil {
+		t.Fatal(err)
+	}
+	if balance != 23750 {
+		t.Errorf("wallet balance = %s, want 237.50", balance)
+	}
+}
+
+// TestReconcileRepairsEditedBalance checks that a balance changed behind the
+// journal's back is repaired so that the books verify and writes go on.
+func TestReconcileRepairsEditedBalance(t *testing.T) {
+	h := newTestHandler(t)
+	userID := newTestUser(t, h)
+	today := time.Now().Format("2006-01-02")
+	income := map[string]string{"amount": "50.00", "type": "income", "category": "Allowance", "date": today}
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost, income), http.StatusCreated, nil)
+
+	for _, query := range []string{
+		`UPDATE accounts SET balance = balance + 1000 WHERE user_id = $1 AND is_primary`,
+		`UPDATE accounts SET savings_balance = savings_balance + 25 WHERE user_id = $1 AND is_primary`,
+	} {
+		if _, err := h.db.Exec(query, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := reconcile.Run(h.db, reconcile.Options{UserID: userID, Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Discrepancies) != 1 || !result.Discrepancies[0].Repaired {
+		t.Fatalf("discrepancies %+v, want one repaired", result.Discrepancies)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ledger.Verify(tx, userID)
+	tx.Rollback()
+	if err != nil {
+		t.Errorf("ledger after repair: %v", err)
+	}
+	var balance, savings models.Money
+	err = h.db.QueryRow(`SELECT balance, savings_balance FROM accounts WHERE user_id = $1 AND is_primary`, userID).Scan(&balance, &savings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 5000 || savings != 0 {
+		t.Errorf("balance %s, savings %s after repair, want 50.00 and 0.00", balance, savings)
+	}
+
+	decode(t, serve(h.CreateTransaction, userID, http.MethodPost, income), http.StatusCreated, nil)
+}
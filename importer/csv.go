@@ -0,0 +1,373 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+)
+
+// delimiters are the CSV delimiters the importer detects.
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// columnFields lists the column fields of a mapping with the lower-case
+// words that identify them in a header. Debit and credit come before
+// amount, which their headers often contain.
+func columnFields(m *models.CSVMapping) []struct {
+	column *string
+	words  []string
+} {
+	return []struct {
+		column *string
+		words  []string
+	}{
+		{&m.Date, []string{"date"}},
+		{&m.Debit, []string{"debit", "withdrawal", "money out", "paid out"}},
+		{&m.Credit, []string{"credit", "deposit", "money in", "paid in"}},
+		{&m.Amount, []string{"amount", "value"}},
+		{&m.Description, []string{"description", "details", "memo", "narrative", "payee", "particulars"}},
+		{&m.Category, []string{"category"}},
+		{&m.Type, []string{"type", "dr/cr"}},
+		{&m.ExternalID, []string{"transaction id", "reference", "ref", "fitid"}},
+	}
+}
+
+// ParseCSV reads a CSV statement with the given mapping and returns the
+// mapping with every detected field filled in, and the rows. Rows that
+// cannot be read carry an Error; the error result is for a file that
+// cannot be imported at all.
+func ParseCSV(data []byte, mapping models.CSVMapping) (models.CSVMapping, []models.ImportRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	if mapping.Delimiter == "" {
+		mapping.Delimiter = string(detectDelimiter(data))
+	}
+	delimiter := []rune(mapping.Delimiter)
+	if len(delimiter) != 1 {
+		return mapping, nil, errors.New("delimiter must be a single character")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter[0]
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return mapping, nil, fmt.Errorf("cannot read CSV: %v", err)
+		}
+		if isBlank(record) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	if len(records) == 0 {
+		return mapping, nil, errors.New("the file has no rows")
+	}
+
+	if mapping.HasHeader == nil {
+		hasHeader := !hasDate(records[0])
+		mapping.HasHeader = &hasHeader
+	}
+	var header []string
+	if *mapping.HasHeader {
+		header, records, lines = records[0], records[1:], lines[1:]
+	}
+	if len(records) > MaxRows {
+		return mapping, nil, fmt.Errorf("the file has more than %d rows", MaxRows)
+	}
+
+	columns, err := resolveColumns(&mapping, header)
+	if err != nil {
+		return mapping, nil, err
+	}
+
+	if mapping.DateFormat == "" {
+		format, ok := detectDateFormat(cells(records, columns.date), dateFormats)
+		if !ok {
+			return mapping, nil, errors.New("cannot detect the date format; set date_format")
+		}
+		mapping.DateFormat = format
+	}
+	layout, ok := dateLayout(mapping.DateFormat)
+	if !ok {
+		return mapping, nil, fmt.Errorf("unknown date_format '%s'", mapping.DateFormat)
+	}
+
+	if mapping.DecimalComma == nil {
+		var amounts []string
+		for _, column := range []int{columns.amount, columns.debit, columns.credit} {
+			amounts = append(amounts, cells(records, column)...)
+		}
+		decimalComma := detectDecimalComma(amounts)
+		mapping.DecimalComma = &decimalComma
+	}
+
+	rows := make([]models.ImportRow, len(records))
+	for i, record := range records {
+		rows[i] = readRow(record, columns, layout, *mapping.DecimalComma)
+		rows[i].Line = lines[i]
+	}
+	return mapping, rows, nil
+}
+
+// csvColumns are the 0-based positions of the mapped columns, -1 when a
+// column is not mapped.
+type csvColumns struct {
+	date, amount, debit, credit, kind, description, category, externalID int
+}
+
+// resolveColumns finds the position of each mapped column, detecting
+// columns by their header where the mapping names none, and writes the
+// header names of the detected columns back into the mapping.
+func resolveColumns(m *models.CSVMapping, header []string) (csvColumns, error) {
+	used := map[int]bool{}
+	positions := map[*string]int{}
+	for _, field := range columnFields(m) {
+		positions[field.column] = -1
+		if *field.column == "" {
+			continue
+		}
+		position, err := findColumn(*field.column, header)
+		if err != nil {
+			return csvColumns{}, err
+		}
+		positions[field.column] = position
+		used[position] = true
+	}
+
+	// Detect the unmapped columns by the first header containing one of
+	// their words, but never mix amount with debit and credit
+	for _, field := range columnFields(m) {
+		if header == nil || *field.column != "" {
+			continue
+		}
+		if field.column == &m.Amount && (m.Debit != "" || m.Credit != "") {
+			continue
+		}
+		if (field.column == &m.Debit || field.column == &m.Credit) && m.Amount != "" {
+			continue
+		}
+		for position, name := range header {
+			if !used[position] && headerMatches(name, field.words) {
+				*field.column = strings.TrimSpace(name)
+				positions[field.column] = position
+				used[position] = true
+				break
+			}
+		}
+	}
+
+	columns := csvColumns{
+		date:        positions[&m.Date],
+		amount:      positions[&m.Amount],
+		debit:       positions[&m.Debit],
+		credit:      positions[&m.Credit],
+		kind:        positions[&m.Type],
+		description: positions[&m.Description],
+		category:    positions[&m.Category],
+		externalID:  positions[&m.ExternalID],
+	}
+	if columns.date < 0 {
+		if header == nil {
+			return columns, errors.New("the file has no header row; map the date column by its number")
+		}
+		return columns, errors.New("cannot find the date column; map it in the mapping")
+	}
+	if columns.amount < 0 && columns.debit < 0 && columns.credit < 0 {
+		return columns, errors.New("cannot find an amount column; map amount, or debit and credit")
+	}
+	if columns.amount >= 0 && (columns.debit >= 0 || columns.credit >= 0) {
+		return columns, errors.New("map either amount or debit and credit, not both")
+	}
+	return columns, nil
+}
+
+// findColumn returns the position of a column named by its header or by
+// its 1-based number.
+func findColumn(name string, header []string) (int, error) {
+	if number, err := strconv.Atoi(name); err == nil {
+		if number < 1 {
+			return 0, fmt.Errorf("column numbers start at 1, got %d", number)
+		}
+		return number - 1, nil
+	}
+	for position, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), strings.TrimSpace(name)) {
+			return position, nil
+		}
+	}
+	return 0, fmt.Errorf("the file has no column '%s'", name)
+}
+
+func headerMatches(name string, words []string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, word := range words {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// readRow turns a record into a row. Amounts are stored positive, with
+// their sign or column giving the type.
+func readRow(record []string, columns csvColumns, layout string, decimalComma bool) models.ImportRow {
+	var row models.ImportRow
+	row.Description = cell(record, columns.description)
+	row.Category = cell(record, columns.category)
+	row.ExternalID = cell(record, columns.externalID)
+
+	value := cell(record, columns.date)
+	date, err := parseDate(value, layout)
+	if err != nil {
+		row.Error = "invalid date '" + value + "'"
+		return row
+	}
+	row.Date = date.Format("2006-01-02")
+
+	var amount models.Money
+	if columns.amount >= 0 {
+		value := cell(record, columns.amount)
+		amount, err = parseAmount(value, decimalComma)
+		if err != nil {
+			row.Error = "invalid amount '" + value + "'"
+			return row
+		}
+	} else {
+		debit, credit := cell(record, columns.debit), cell(record, columns.credit)
+		if debit != "" {
+			parsed, err := parseAmount(debit, decimalComma)
+			if err != nil {
+				row.Error = "invalid debit '" + debit + "'"
+				return row
+			}
+			amount -= abs(parsed)
+		}
+		if credit != "" {
+			parsed, err := parseAmount(credit, decimalComma)
+			if err != nil {
+				row.Error = "invalid credit '" + credit + "'"
+				return row
+			}
+			amount += abs(parsed)
+		}
+	}
+
+	row.Type = "income"
+	if amount < 0 {
+		row.Type = "expense"
+	}
+	if columns.kind >= 0 {
+		value := cell(record, columns.kind)
+		kind, ok := parseType(value)
+		if !ok {
+			row.Error = "unknown type '" + value + "'"
+			return row
+		}
+		if kind != "" {
+			row.Type = kind
+		}
+	}
+
+	row.Amount = abs(amount)
+	if row.Amount == 0 {
+		row.Error = "amount is zero"
+	}
+	return row
+}
+
+// parseType reads a type column. An empty value leaves the type to the sign
+// of the amount.
+func parseType(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return "", true
+	case "income", "credit", "cr", "deposit", "in":
+		return "income", true
+	case "expense", "debit", "dr", "withdrawal", "payment", "out":
+		return "expense", true
+	}
+	return "", false
+}
+
+// detectDelimiter picks the delimiter that splits the first lines into the
+// same, largest number of fields.
+func detectDelimiter(data []byte) rune {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if len(lines) > 20 {
+		lines = lines[:20]
+	}
+
+	best, bestFields := ',', 0
+	for _, delimiter := range delimiters {
+		fields := -1
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			count := strings.Count(line, string(delimiter))
+			if fields == -1 || count < fields {
+				fields = count
+			}
+		}
+		if fields > bestFields {
+			best, bestFields = delimiter, fields
+		}
+	}
+	return best
+}
+
+// hasDate reports whether any field parses as a date in a known format.
+func hasDate(record []string) bool {
+	for _, value := range record {
+		for _, format := range dateFormats {
+			if _, err := parseDate(value, format.layout); err == nil && strings.TrimSpace(value) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// cell returns a field of record, or "" when the column is not mapped or
+// the record is short.
+func cell(record []string, position int) string {
+	if position < 0 || position >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[position])
+}
+
+// cells returns the non-empty values of a column.
+func cells(records [][]string, position int) []string {
+	var values []string
+	for _, record := range records {
+		if value := cell(record, position); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
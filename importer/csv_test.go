@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"student-money-manager/models"
+	"testing"
+)
+
+func TestParseCSVSemicolonDecimalComma(t *testing.T) {
+	mapping, rows, err := ParseCSV(readTestdata(t, "semicolon.csv"), models.CSVMapping{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Delimiter != ";" || mapping.DecimalComma == nil || !*mapping.DecimalComma ||
+		mapping.DateFormat != "DD.MM.YYYY" || mapping.HasHeader == nil || !*mapping.HasHeader {
+		t.Errorf("detected %+v", mapping)
+	}
+	if mapping.Date != "Date" || mapping.Amount != "Amount" || mapping.Description != "Description" || mapping.Category != "Category" {
+		t.Errorf("columns %+v", mapping)
+	}
+	checkRows(t, rows, []models.ImportRow{
+		{Line: 2, Date: "2026-01-05", Amount: 450, Type: "expense", Category: "Food & Dining", Description: "Campus Coffee"},
+		{Line: 3, Date: "2026-01-10", Amount: 120000, Type: "income", Category: "Salary", Description: "Payroll; January"},
+		{Line: 4, Date: "2026-01-15", Amount: 6235, Type: "expense", Category: "Education", Description: "Bookshop"},
+	})
+}
+
+func TestParseCSVDebitCredit(t *testing.T) {
+	mapping, rows, err := ParseCSV(readTestdata(t, "debit_credit.csv"), models.CSVMapping{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Debit != "Money Out" || mapping.Credit != "Money In" || mapping.Amount != "" ||
+		mapping.Date != "Transaction Date" || mapping.ExternalID != "Reference" {
+		t.Errorf("columns %+v", mapping)
+	}
+	checkRows(t, rows, []models.ImportRow{
+		{Line: 2, Date: "2026-01-05", Amount: 450, Type: "expense", Description: "Campus Coffee", ExternalID: "TX-1"},
+		{Line: 3, Date: "2026-01-10", Amount: 120000, Type: "income", Description: "Payroll", ExternalID: "TX-2"},
+		{Line: 4, Date: "2026-01-12", Amount: 400, Type: "income", Description: "Refund less fee", ExternalID: "TX-3"},
+	})
+}
+
+func TestParseCSVWithoutHeader(t *testing.T) {
+	data := readTestdata(t, "no_header.csv")
+	if _, _, err := ParseCSV(data, models.CSVMapping{}); err == nil ||
+		err.Error() != "the file has no header row; map the date column by its number" {
+		t.Errorf("unmapped file: error = %v", err)
+	}
+
+	mapping, rows, err := ParseCSV(data, models.CSVMapping{Date: "2", Amount: "3", Description: "4", ExternalID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.HasHeader == nil || *mapping.HasHeader {
+		t.Errorf("has_header = %v, want false", mapping.HasHeader)
+	}
+	checkRows(t, rows, []models.ImportRow{
+		{Line: 1, Date: "2026-01-05", Amount: 450, Type: "expense", Description: "Campus Coffee", ExternalID: "1001"},
+		{Line: 2, Date: "2026-01-10", Amount: 120000, Type: "income", Description: "Payroll", ExternalID: "1002"},
+		{Line: 4, Date: "2026-01-31", Amount: 1200, Type: "expense", Description: "Lunch", ExternalID: "1003"},
+	})
+
+	if _, _, err := ParseCSV(data, models.CSVMapping{Date: "0", Amount: "3"}); err == nil {
+		t.Error("column 0 was accepted")
+	}
+}
+
+func TestParseCSVDateOrder(t *testing.T) {
+	tests := []struct {
+		file, dateFormat string
+		wantFormat       string
+		wantDates        []string
+	}{
+		{"day_first.csv", "", "DD/MM/YYYY", []string{"2026-01-02", "2026-01-13"}},
+		{"month_first.csv", "", "MM/DD/YYYY", []string{"2026-01-02", "2026-01-13"}},
+		{"day_first.csv", "MM/DD/YYYY", "MM/DD/YYYY", []string{"2026-02-01", ""}},
+	}
+	for _, test := range tests {
+		mapping, rows, err := ParseCSV(readTestdata(t, test.file), models.CSVMapping{DateFormat: test.dateFormat})
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		if mapping.DateFormat != test.wantFormat {
+			t.Errorf("%s: date format %q, want %q", test.file, mapping.DateFormat, test.wantFormat)
+		}
+		for i, row := range rows {
+			if row.Date != test.wantDates[i] {
+				t.Errorf("%s as %s: row %d date %q, want %q", test.file, test.wantFormat, i, row.Date, test.wantDates[i])
+			}
+		}
+	}
+}
+
+func TestParseCSVNegativeAmounts(t *testing.T) {
+	_, rows, err := ParseCSV(readTestdata(t, "negatives.csv"), models.CSVMapping{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, rows, []models.ImportRow{
+		{Line: 2, Date: "2026-01-05", Amount: 1250, Type: "expense", Description: "Coffee"},
+		{Line: 3, Date: "2026-01-06", Amount: 1250, Type: "expense", Description: "Books"},
+		{Line: 4, Date: "2026-01-07", Amount: 1250, Type: "income", Description: "Refund"},
+		{Line: 5, Date: "2026-01-08", Type: "income", Description: "Nothing", Error: "amount is zero"},
+		{Line: 6, Date: "2026-01-09", Description: "Unreadable", Error: "invalid amount 'abc'"},
+		{Line: 7, Description: "Bad date", Error: "invalid date '2026-02-30'"},
+	})
+}
+
+func TestParseCSVMappingErrors(t *testing.T) {
+	tests := []struct {
+		file    string
+		mapping models.CSVMapping
+		want    string
+	}{
+		{"debit_credit.csv", models.CSVMapping{Amount: "4", Debit: "Money Out"}, "map either amount or debit and credit, not both"},
+		{"debit_credit.csv", models.CSVMapping{Amount: "Money In", Credit: "5"}, "map either amount or debit and credit, not both"},
+		{"debit_credit.csv", models.CSVMapping{Amount: "Balance"}, "the file has no column 'Balance'"},
+		{"day_first.csv", models.CSVMapping{DateFormat: "DD/MM"}, "unknown date_format 'DD/MM'"},
+		{"day_first.csv", models.CSVMapping{Delimiter: ";;"}, "delimiter must be a single character"},
+	}
+	for _, test := range tests {
+		_, _, err := ParseCSV(readTestdata(t, test.file), test.mapping)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s with %+v: error = %v, want %q", test.file, test.mapping, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package importer reads bank statements into rows the import handlers turn
+// into transactions.
+package importer
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"student-money-manager/models"
+	"time"
+)
+
+// MaxRows limits the rows of one statement.
+const MaxRows = 5000
+
+type dateFormat struct {
+	name   string
+	layout string
+}
+
+// dateFormats are the date formats the importer detects, tried in order,
+// with the layouts that parse them. Day-first formats come before
+// month-first ones, so an ambiguous file is read day first unless the
+// mapping says otherwise.
+var dateFormats = []dateFormat{
+	{"YYYY-MM-DD", "2006-1-2"},
+	{"YYYY/MM/DD", "2006/1/2"},
+	{"DD/MM/YYYY", "2/1/2006"},
+	{"MM/DD/YYYY", "1/2/2006"},
+	{"DD.MM.YYYY", "2.1.2006"},
+	{"DD-MM-YYYY", "2-1-2006"},
+	{"MM-DD-YYYY", "1-2-2006"},
+	{"DD/MM/YY", "2/1/06"},
+	{"MM/DD/YY", "1/2/06"},
+	{"YYYYMMDD", "20060102"},
+	{"DD MMM YYYY", "2 Jan 2006"},
+}
+
+// DetectFormat returns the format of a statement from its file extension,
+// or from its content when the extension is not known. QFX is Quicken's
+// name for OFX and is read as OFX.
+func DetectFormat(filename string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".txt":
+		return "csv"
+	case ".ofx", ".qfx":
+		return "ofx"
+	case ".qif":
+		return "qif"
+	}
+
+	head := bytes.ToUpper(bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	switch {
+	case bytes.Contains(head, []byte("OFXHEADER")) || bytes.Contains(head, []byte("<OFX>")):
+		return "ofx"
+	case bytes.HasPrefix(head, []byte("!TYPE:")) || bytes.HasPrefix(head, []byte("!ACCOUNT")) ||
+		bytes.HasPrefix(head, []byte("!OPTION")):
+		return "qif"
+	}
+	return "csv"
+}
+
+// parseDate parses a date, ignoring a time after it.
+func parseDate(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		if cut := strings.IndexAny(value, "T "); cut > 0 && !strings.Contains(layout, " ") {
+			return time.Parse(layout, value[:cut])
+		}
+	}
+	return date, err
+}
+
+// parseAmount reads an amount written with any currency symbol, thousands
+// separators, and a leading or trailing minus or parentheses for negative
+// amounts.
+func parseAmount(value string, decimalComma bool) (models.Money, error) {
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-") || strings.HasSuffix(value, "-") ||
+		(strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")"))
+
+	var digits strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '.' && !decimalComma, r == ',' && decimalComma:
+			digits.WriteRune('.')
+		}
+	}
+	amount, err := models.ParseMoney(digits.String())
+	if err != nil {
+		return 0, err
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func abs(m models.Money) models.Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// detectDateFormat returns the first of formats that parses every value, or
+// else the one that parses most of them.
+func detectDateFormat(values []string, formats []dateFormat) (string, bool) {
+	best, bestCount := "", 0
+	for _, format := range formats {
+		count := 0
+		for _, value := range values {
+			if _, err := parseDate(value, format.layout); err == nil {
+				count++
+			}
+		}
+		if count == len(values) && count > 0 {
+			return format.name, true
+		}
+		if count > bestCount {
+			best, bestCount = format.name, count
+		}
+	}
+	return best, bestCount > 0
+}
+
+func dateLayout(format string) (string, bool) {
+	for _, f := range dateFormats {
+		if strings.EqualFold(f.name, format) {
+			return f.layout, true
+		}
+	}
+	return "", false
+}
+
+// detectDecimalComma reports whether amounts use a decimal comma: more of
+// them end in a comma and one or two digits than in a point and one or two
+// digits.
+func detectDecimalComma(values []string) bool {
+	commas, points := 0, 0
+	for _, value := range values {
+		value = strings.TrimRight(strings.TrimSpace(value), "-) ")
+		separator := strings.LastIndexAny(value, ".,")
+		if separator < 0 {
+			continue
+		}
+		if decimals := len(value) - separator - 1; decimals < 1 || decimals > 2 {
+			continue
+		}
+		if value[separator] == ',' {
+			commas++
+		} else {
+			points++
+		}
+	}
+	return commas > points
+}
+
+// describe joins a statement's payee and memo into a description, leaving
+// out a memo that repeats the payee.
+func describe(payee, memo string) string {
+	payee, memo = strings.TrimSpace(payee), strings.TrimSpace(memo)
+	switch {
+	case payee == "":
+		return memo
+	case memo == "", strings.EqualFold(memo, payee):
+		return payee
+	}
+	return payee + " - " + memo
+}
@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"student-money-manager/models"
+	"time"
+)
+
+// ParseOFX reads the transactions of an OFX or QFX statement, in either the
+// SGML syntax of OFX 1, where values have no closing tags, or the XML of
+// OFX 2. Every STMTTRN of the file is read, from bank and credit card
+// statements alike, and its FITID becomes the row's external id.
+func ParseOFX(data []byte) ([]models.ImportRow, error) {
+	start := bytes.Index(bytes.ToUpper(data), []byte("<OFX>"))
+	if start < 0 {
+		return nil, errors.New("not an OFX file: it has no <OFX> element")
+	}
+	line := 1 + bytes.Count(data[:start], []byte("\n"))
+	src := string(data[start:])
+
+	var rows []models.ImportRow
+	var fields map[string]string
+	var fieldsLine int
+	pos, counted := 0, 0
+	for {
+		open := strings.IndexByte(src[pos:], '<')
+		if open < 0 {
+			break
+		}
+		open += pos
+		end := strings.IndexByte(src[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: unclosed tag", line+strings.Count(src[counted:open], "\n"))
+		}
+		end += open
+		tag := strings.TrimSpace(src[open+1 : end])
+
+		next := strings.IndexByte(src[end:], '<')
+		if next < 0 {
+			next = len(src)
+		} else {
+			next += end
+		}
+		value := strings.TrimSpace(html.UnescapeString(src[end+1 : next]))
+		pos = next
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToUpper(strings.TrimPrefix(tag, "/"))
+		switch {
+		case strings.HasPrefix(tag, "?"), strings.HasPrefix(tag, "!"):
+		case name == "STMTTRN" && !closing:
+			line += strings.Count(src[counted:open], "\n")
+			counted = open
+			fields, fieldsLine = map[string]string{}, line
+		case name == "STMTTRN":
+			if fields == nil {
+				return nil, fmt.Errorf("line %d: </STMTTRN> without <STMTTRN>", line+strings.Count(src[counted:open], "\n"))
+			}
+			if len(rows) == MaxRows {
+				return nil, fmt.Errorf("the statement has more than %d transactions", MaxRows)
+			}
+			rows = append(rows, readOFXTransaction(fields, fieldsLine))
+			fields = nil
+		case fields != nil && !closing && value != "":
+			// Aggregates nested in the transaction, such as PAYEE, add
+			// their values too; the first value of a name wins
+			if _, ok := fields[name]; !ok {
+				fields[name] = value
+			}
+		}
+	}
+	if fields != nil {
+		return nil, fmt.Errorf("line %d: <STMTTRN> is not closed", fieldsLine)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("the statement has no transactions")
+	}
+	return rows, nil
+}
+
+// readOFXTransaction turns the values of a STMTTRN into a row. The sign of
+// TRNAMT gives the type; TRNTYPE is not reliable across banks.
+func readOFXTransaction(fields map[string]string, line int) models.ImportRow {
+	row := models.ImportRow{Line: line}
+	row.ExternalID = fields["FITID"]
+	row.Description = describe(fields["NAME"], fields["MEMO"])
+
+	value := fields["DTPOSTED"]
+	date, err := parseOFXDate(value)
+	if err != nil {
+		row.Error = "invalid date '" + value + "'"
+		return row
+	}
+	row.Date = date.Format("2006-01-02")
+
+	value = fields["TRNAMT"]
+	if value == "" {
+		row.Error = "missing amount"
+		return row
+	}
+	decimalComma := strings.Contains(value, ",") && !strings.Contains(value, ".")
+	amount, err := parseAmount(value, decimalComma)
+	if err != nil {
+		row.Error = "invalid amount '" + value + "'"
+		return row
+	}
+
+	row.Type = "income"
+	if amount < 0 {
+		row.Type = "expense"
+	}
+	row.Amount = abs(amount)
+	if row.Amount == 0 {
+		row.Error = "amount is zero"
+	}
+	return row
+}
+
+// parseOFXDate reads the date of an OFX datetime such as
+// 20260105120000.000[-5:EST], ignoring the time and zone.
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, errors.New("date is too short")
+	}
+	return time.Parse("20060102", value[:8])
+}
@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"os"
+	"strings"
+	"student-money-manager/models"
+	"testing"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func checkRows(t *testing.T, got, want []models.ImportRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if want[i].ExternalID == "*" {
+			if got[i].ExternalID == "" {
+				t.Errorf("row %d has no external id", i)
+			}
+			want[i].ExternalID = got[i].ExternalID
+		}
+		if got[i] != want[i] {
+			t.Errorf("row %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseOFXSGML(t *testing.T) {
+	rows, err := ParseOFX(readTestdata(t, "statement.ofx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, rows, []models.ImportRow{
+		{Line: 39, Date: "2026-01-05", Amount: 450, Type: "expense",
+			Description: "CAMPUS COFFEE - Card purchase", ExternalID: "202601050001"},
+		{Line: 47, Date: "2026-01-10", Amount: 120000, Type: "income",
+			Description: "UNIVERSITY PAYROLL", ExternalID: "202601100001"},
+		{Line: 54, Date: "2026-01-15", Amount: 6235, Type: "expense",
+			Description: "BARNES & NOBLE", ExternalID: "202601150001"},
+	})
+}
+
+func TestParseOFXXML(t *testing.T) {
+	rows, err := ParseOFX(readTestdata(t, "statement.qfx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, rows, []models.ImportRow{
+		{Line: 19, Date: "2026-02-03", Amount: 1599, Type: "expense",
+			Description: "Streaming Service", ExternalID: "CC-0203-1"},
+		{Line: 29, Date: "2026-02-10", Amount: 1599, Type: "income",
+			Description: "Refund - Streaming Service", ExternalID: "CC-0210-1"},
+		{Line: 37, Description: "Broken Date", ExternalID: "CC-0211-1", Error: "invalid date '2026021'"},
+	})
+}
+
+func TestParseOFXErrors(t *testing.T) {
+	tests := []struct {
+		name, data, err string
+	}{
+		{"not OFX", "Date,Amount\n2026-01-01,1.00\n", "not an OFX file"},
+		{"no transactions", "<OFX><BANKTRANLIST></BANKTRANLIST></OFX>", "no transactions"},
+		{"unclosed transaction", "<OFX>\n<STMTTRN>\n<TRNAMT>1.00\n</OFX>", "line 2: <STMTTRN> is not closed"},
+		{"unclosed tag", "<OFX>\n<STMTTRN\n", "unclosed tag"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseOFX([]byte(test.data))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename, data, want string
+	}{
+		{"statement.OFX", "", "ofx"},
+		{"statement.qfx", "", "ofx"},
+		{"statement.qif", "", "qif"},
+		{"statement.csv", "OFXHEADER:100", "csv"},
+		{"download", "OFXHEADER:100\n<OFX>", "ofx"},
+		{"download", "<?xml version=\"1.0\"?>\n<OFX>", "ofx"},
+		{"download", "!Type:Bank\nD1/5'26", "qif"},
+		{"download", "\xef\xbb\xbf!Account\nNChecking", "qif"},
+		{"download", "Date,Amount", "csv"},
+	}
+	for _, test := range tests {
+		if got := DetectFormat(test.filename, []byte(test.data)); got != test.want {
+			t.Errorf("DetectFormat(%q, %q) = %q, want %q", test.filename, test.data, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+)
+
+// qifDateFormats are the date formats detected in QIF files, month first
+// as Quicken writes them. Two-digit years are expanded before dates are
+// parsed, so the formats need four.
+var qifDateFormats = []dateFormat{
+	{"MM/DD/YYYY", "1/2/2006"},
+	{"DD/MM/YYYY", "2/1/2006"},
+	{"YYYY-MM-DD", "2006-1-2"},
+	{"DD.MM.YYYY", "2.1.2006"},
+}
+
+// qifRecord holds the fields of one QIF transaction.
+type qifRecord struct {
+	line                                int
+	date, amount, payee, memo, category string
+}
+
+// ParseQIF reads the transactions of the bank, cash and credit card
+// sections of a QIF file, skipping account and category lists. Dates are
+// read in dateFormat, or in the detected format when it is empty, and the
+// format used is returned.
+//
+// QIF has no transaction ids, so each row's external id is derived from
+// its date, amount, payee and memo, with repeats of the same values
+// numbered in file order. Re-importing an overlapping file therefore finds
+// the rows imported before.
+func ParseQIF(data []byte, dateFormat string) (string, []models.ImportRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	var records []qifRecord
+	var record *qifRecord
+	section := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if line[0] == '!' {
+			header := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(header, "!TYPE:"):
+				switch strings.TrimSpace(header[len("!TYPE:"):]) {
+				case "BANK", "CASH", "CCARD", "OTH A", "OTH L":
+					section = "transactions"
+				case "INVST":
+					return "", nil, fmt.Errorf("line %d: investment accounts are not supported", i+1)
+				default:
+					section = "skip"
+				}
+			case strings.HasPrefix(header, "!ACCOUNT"):
+				section = "skip"
+			}
+			continue
+		}
+		switch section {
+		case "":
+			return "", nil, fmt.Errorf("line %d: the file has no !Type header", i+1)
+		case "skip":
+			continue
+		}
+
+		if line[0] == '^' {
+			if record != nil {
+				records = append(records, *record)
+			}
+			record = nil
+			continue
+		}
+		if record == nil {
+			if len(records) == MaxRows {
+				return "", nil, fmt.Errorf("the file has more than %d transactions", MaxRows)
+			}
+			record = &qifRecord{line: i + 1}
+		}
+		value := strings.TrimSpace(line[1:])
+		switch line[0] {
+		case 'D':
+			record.date = normalizeQIFDate(value)
+		case 'T':
+			record.amount = value
+		case 'U':
+			if record.amount == "" {
+				record.amount = value
+			}
+		case 'P':
+			record.payee = value
+		case 'M':
+			record.memo = value
+		case 'L':
+			record.category = value
+		}
+	}
+	if record != nil {
+		records = append(records, *record)
+	}
+	if len(records) == 0 {
+		return "", nil, errors.New("the file has no transactions")
+	}
+
+	var dates, amounts []string
+	for _, record := range records {
+		if record.date != "" {
+			dates = append(dates, record.date)
+		}
+		amounts = append(amounts, record.amount)
+	}
+	if upper := strings.ToUpper(dateFormat); strings.HasSuffix(upper, "YY") && !strings.HasSuffix(upper, "YYYY") {
+		dateFormat += "YY"
+	}
+	if dateFormat == "" {
+		format, ok := detectDateFormat(dates, qifDateFormats)
+		if !ok {
+			return "", nil, errors.New("cannot detect the date format; set date_format")
+		}
+		dateFormat = format
+	}
+	layout, ok := dateLayout(dateFormat)
+	if !ok {
+		return "", nil, fmt.Errorf("unknown date_format '%s'", dateFormat)
+	}
+	decimalComma := detectDecimalComma(amounts)
+
+	rows := make([]models.ImportRow, len(records))
+	seen := map[string]int{}
+	for i, record := range records {
+		rows[i] = readQIFRecord(record, layout, decimalComma)
+		if rows[i].Error != "" {
+			continue
+		}
+		key := strings.Join([]string{rows[i].Date, rows[i].Type, rows[i].Amount.String(), record.payee, record.memo}, "\x00")
+		seen[key]++
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%d", key, seen[key])))
+		rows[i].ExternalID = "qif:" + hex.EncodeToString(sum[:])
+	}
+	return dateFormat, rows, nil
+}
+
+// readQIFRecord turns a record into a row. A category names a subcategory
+// after its parent, as in Food:Groceries, and may end in /class; the row
+// keeps only the subcategory. A transfer to another account, in brackets,
+// has no category.
+func readQIFRecord(record qifRecord, layout string, decimalComma bool) models.ImportRow {
+	row := models.ImportRow{Line: record.line}
+	row.Description = describe(record.payee, record.memo)
+
+	category := record.category
+	if cut := strings.IndexByte(category, '/'); cut >= 0 {
+		category = category[:cut]
+	}
+	if !strings.HasPrefix(category, "[") {
+		row.Category = strings.TrimSpace(category[strings.LastIndexByte(category, ':')+1:])
+	}
+
+	date, err := parseDate(record.date, layout)
+	if err != nil {
+		row.Error = "invalid date '" + record.date + "'"
+		return row
+	}
+	row.Date = date.Format("2006-01-02")
+
+	if record.amount == "" {
+		row.Error = "missing amount"
+		return row
+	}
+	amount, err := parseAmount(record.amount, decimalComma)
+	if err != nil {
+		row.Error = "invalid amount '" + record.amount + "'"
+		return row
+	}
+
+	row.Type = "income"
+	if amount < 0 {
+		row.Type = "expense"
+	}
+	row.Amount = abs(amount)
+	if row.Amount == 0 {
+		row.Error = "amount is zero"
+	}
+	return row
+}
+
+// normalizeQIFDate removes the spaces Quicken pads dates with and expands
+// a two-digit year, which Quicken writes after an apostrophe from 2000 on,
+// as in 1/ 5'26, to four digits.
+func normalizeQIFDate(value string) string {
+	value = strings.ReplaceAll(strings.ReplaceAll(value, " ", ""), "'", "/")
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '.' || r == '-' })
+	if len(parts) != 3 || len(parts[0]) > 2 || len(parts[2]) != 2 {
+		return value
+	}
+	year, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return value
+	}
+	// The same pivot as Go's two-digit years
+	century := "20"
+	if year >= 69 {
+		century = "19"
+	}
+	return value[:len(value)-2] + century + parts[2]
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"strings"
+	"student-money-manager/models"
+	"testing"
+)
+
+func TestParseQIF(t *testing.T) {
+	format, rows, err := ParseQIF(readTestdata(t, "statement.qif"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "MM/DD/YYYY" {
+		t.Errorf("got date format %q, want MM/DD/YYYY", format)
+	}
+	checkRows(t, rows, []models.ImportRow{
+		{Line: 6, Date: "2026-01-05", Amount: 450, Type: "expense", Category: "Coffee",
+			Description: "Campus Coffee", ExternalID: "*"},
+		{Line: 11, Date: "2026-01-05", Amount: 450, Type: "expense", Category: "Coffee",
+			Description: "Campus Coffee", ExternalID: "*"},
+		{Line: 16, Date: "2026-01-10", Amount: 120000, Type: "income", Category: "Salary",
+			Description: "University Payroll", ExternalID: "*"},
+		{Line: 21, Date: "2026-01-12", Amount: 30000, Type: "expense",
+			Description: "Transfer to savings", ExternalID: "*"},
+		{Line: 26, Date: "2026-01-15", Amount: 6235, Type: "expense", Category: "Education",
+			Description: "Bookstore - Textbooks", ExternalID: "*"},
+		{Line: 32, Description: "Bad date", Error: "invalid date '13/45/2026'"},
+	})
+	if rows[0].ExternalID == rows[1].ExternalID {
+		t.Error("repeated transactions share an external id")
+	}
+}
+
+func TestParseQIFExternalIDsAreStable(t *testing.T) {
+	january := "!Type:Bank\nD1/5'26\nT-4.50\nPCampus Coffee\n^\nD1/5'26\nT-4.50\nPCampus Coffee\n^\n"
+	february := "!Type:Bank\nD2/1'26\nT-9.99\nPPhone\n^\n"
+
+	_, first, err := ParseQIF([]byte(january), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, overlapping, err := ParseQIF([]byte(january+february[len("!Type:Bank\n"):]), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range first {
+		if first[i].ExternalID != overlapping[i].ExternalID {
+			t.Errorf("row %d: external id changed from %s to %s", i, first[i].ExternalID, overlapping[i].ExternalID)
+		}
+	}
+}
+
+func TestParseQIFDateFormat(t *testing.T) {
+	data := []byte("!Type:CCard\nD05/01/26\nT-1.00\n^\n")
+	for _, test := range []struct{ format, want string }{
+		{"", "2026-05-01"},
+		{"DD/MM/YY", "2026-01-05"},
+		{"DD/MM/YYYY", "2026-01-05"},
+	} {
+		_, rows, err := ParseQIF(data, test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows[0].Date != test.want {
+			t.Errorf("date format %q: got %s, want %s", test.format, rows[0].Date, test.want)
+		}
+	}
+}
+
+func TestParseQIFErrors(t *testing.T) {
+	tests := []struct {
+		name, data, format, err string
+	}{
+		{"no header", "D1/5'26\nT-1.00\n^\n", "", "line 1: the file has no !Type header"},
+		{"investments", "!Type:Invst\nD1/5'26\n^\n", "", "investment accounts are not supported"},
+		{"only categories", "!Type:Cat\nNFood\nE\n^\n", "", "no transactions"},
+		{"unknown date format", "!Type:Bank\nD1/5'26\nT-1.00\n^\n", "MM-YYYY", "unknown date_format"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := ParseQIF([]byte(test.data), test.format)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
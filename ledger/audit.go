@@ -0,0 +1,171 @@
+package ledger
+
+import (
+	"fmt"
+	"student-money-manager/models"
+)
+
+// WalletReport compares one wallet's cached balance with its ledger account.
+type WalletReport struct {
+	AccountID     int          `json:"account_id"`
+	Balance       models.Money `json:"balance"`
+	LedgerBalance models.Money `json:"ledger_balance"`
+}
+
+// Report compares the balances cached on accounts with the balances derived
+// from postings for one user.
+type Report struct {
+	UserID            int            `json:"user_id"`
+	Wallets           []WalletReport `json:"wallets"`
+	SavingsBalance    models.Money   `json:"savings_balance"`
+	LedgerSavings     models.Money   `json:"ledger_savings_balance"`
+	UnbalancedEntries []int          `json:"unbalanced_entries"`
+}
+
+// OK reports whether the cached balances match the journal and every entry
+// balances.
+func (r Report) OK() bool {
+	for _, w := range r.Wallets {
+		if w.Balance != w.LedgerBalance {
+			return false
+		}
+	}
+	return r.SavingsBalance == r.LedgerSavings && len(r.UnbalancedEntries) == 0
+}
+
+// Check audits one user's books.
+func Check(q Querier, userID int) (Report, error) {
+	report := Report{UserID: userID, Wallets: []WalletReport{}, UnbalancedEntries: []int{}}
+
+	rows, err := q.Query(`SELECT a.id, a.balance,
+						  COALESCE((SELECT SUM(p.amount) FROM postings p
+									JOIN ledger_accounts la ON la.id = p.ledger_account_id
+									WHERE la.user_id = a.user_id AND la.code = $2::text || ':' || a.id), 0)
+						  FROM accounts a WHERE a.user_id = $1 ORDER BY a.id`, userID, Current)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var w WalletReport
+		if err := rows.Scan(&w.AccountID, &w.Balance, &w.LedgerBalance); err != nil {
+			rows.Close()
+			return report, err
+		}
+		report.Wallets = append(report.Wallets, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	err = q.QueryRow(`SELECT COALESCE(SUM(savings_balance), 0) FROM accounts WHERE user_id = $1`, userID).
+		Scan(&report.SavingsBalance)
+	if err != nil {
+		return report, err
+	}
+
+	query := `SELECT COALESCE(SUM(p.amount), 0)
+			  FROM postings p
+			  JOIN ledger_accounts a ON a.id = p.ledger_account_id
+			  WHERE a.user_id = $1 AND (a.code = $2 OR a.code LIKE $2 || ':%')`
+	err = q.QueryRow(query, userID, Savings).Scan(&report.LedgerSavings)
+	if err != nil {
+		return report, err
+	}
+
+	rows, err = q.Query(`SELECT e.id FROM journal_entries e
+						 LEFT JOIN postings p ON p.entry_id = e.id
+						 WHERE e.user_id = $1
+						 GROUP BY e.id
+						 HAVING COALESCE(SUM(p.amount), 0) <> 0
+						 ORDER BY e.id`, userID)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return report, err
+		}
+		report.UnbalancedEntries = append(report.UnbalancedEntries, id)
+	}
+
+	return report, rows.Err()
+}
+
+// Verify returns ErrOutOfBalance when the user's books do not agree. Handlers
+// call it before committing so a write can never leave the cached balances
+// and the journal disagreeing.
+func Verify(q Querier, userID int) error {
+	report, err := Check(q, userID)
+	if err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("%w: %+v", ErrOutOfBalance, report)
+	}
+	return nil
+}
+
+// Accounts lists the user's ledger accounts with their derived balances.
+func Accounts(q Querier, userID int) ([]models.LedgerAccount, error) {
+	query := `SELECT a.id, a.user_id, a.code, a.kind, COALESCE(SUM(p.amount), 0), a.created_at
+			  FROM ledger_accounts a
+			  LEFT JOIN postings p ON p.ledger_account_id = a.id
+			  WHERE a.user_id = $1
+			  GROUP BY a.id
+			  ORDER BY a.kind, a.code`
+	rows, err := q.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.LedgerAccount{}
+	for rows.Next() {
+		var a models.LedgerAccount
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Code, &a.Kind, &a.Balance, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// Entries lists the user's journal, newest first, with postings attached.
+func Entries(q Querier, userID, limit, offset int) ([]models.JournalEntry, error) {
+	query := `SELECT id, user_id, transaction_id, savings_transaction_id, reverses_entry_id,
+			  COALESCE(description, ''), date, created_at
+			  FROM journal_entries WHERE user_id = $1
+			  ORDER BY id DESC LIMIT $2 OFFSET $3`
+	rows, err := q.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.JournalEntry{}
+	for rows.Next() {
+		var e models.JournalEntry
+		err := rows.Scan(&e.ID, &e.UserID, &e.TransactionID, &e.SavingsTransactionID, &e.ReversesEntryID,
+			&e.Description, &e.Date, &e.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		postings, err := entryPostings(q, entries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Postings = postings
+	}
+	return entries, nil
+}
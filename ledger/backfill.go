@@ -0,0 +1,163 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"student-money-manager/models"
+	"time"
+)
+
+// Backfill journals the history of users whose accounts predate the ledger.
+// Each existing transaction and savings transfer is posted in date order;
+// whatever the history does not explain (balances edited by hand, rows lost
+// before transactions were atomic) is booked against equity:opening so the
+// journal starts out agreeing with the cached balances.
+func Backfill(db *sql.DB) error {
+	query := `SELECT a.user_id FROM accounts a
+			  WHERE NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.user_id = a.user_id)
+			  AND (a.balance <> 0 OR a.savings_balance <> 0
+				   OR EXISTS (SELECT 1 FROM transactions t WHERE t.user_id = a.user_id)
+				   OR EXISTS (SELECT 1 FROM savings_transactions st WHERE st.user_id = a.user_id))
+			  ORDER BY a.user_id`
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := backfillUser(db, userID); err != nil {
+			return fmt.Errorf("backfill ledger for user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+func backfillUser(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the accounts and re-check under the lock, another instance may
+	// have journaled this user since the candidate list was read.
+	if _, err := tx.Exec(`SELECT id FROM accounts WHERE user_id = $1 ORDER BY id FOR UPDATE`, userID); err != nil {
+		return err
+	}
+	var journaled bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM journal_entries WHERE user_id = $1)`, userID).Scan(&journaled); err != nil {
+		return err
+	}
+	if journaled {
+		return nil
+	}
+
+	var entries []models.JournalEntry
+	var transactions []models.Transaction
+
+	rows, err := tx.Query(`SELECT id, user_id, account_id, to_account_id, amount, type, category, COALESCE(description, ''), date
+						   FROM transactions WHERE user_id = $1 ORDER BY date, id`, userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var t models.Transaction
+		if err := rows.Scan(&t.ID, &t.UserID, &t.AccountID, &t.ToAccountID, &t.Amount, &t.Type, &t.Category, &t.Description, &t.Date); err != nil {
+			rows.Close()
+			return err
+		}
+		transactions = append(transactions, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	splits := map[int][]models.TransactionSplit{}
+	rows, err = tx.Query(`SELECT s.transaction_id, s.category, s.amount
+						  FROM transaction_splits s JOIN transactions t ON t.id = s.transaction_id
+						  WHERE t.user_id = $1 ORDER BY s.id`, userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var split models.TransactionSplit
+		if err := rows.Scan(&split.TransactionID, &split.Category, &split.Amount); err != nil {
+			rows.Close()
+			return err
+		}
+		splits[split.TransactionID] = append(splits[split.TransactionID], split)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range transactions {
+		t.Splits = splits[t.ID]
+		entries = append(entries, ForTransaction(t))
+	}
+
+	rows, err = tx.Query(`SELECT id, user_id, account_id, goal_id, amount, type, COALESCE(description, ''), date
+						  FROM savings_transactions WHERE user_id = $1 ORDER BY date, id`, userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var st models.SavingsTransaction
+		if err := rows.Scan(&st.ID, &st.UserID, &st.AccountID, &st.GoalID, &st.Amount, &st.Type, &st.Description, &st.Date); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, ForSavingsTransaction(st))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, err := Post(tx, entry); err != nil {
+			return err
+		}
+	}
+
+	report, err := Check(tx, userID)
+	if err != nil {
+		return err
+	}
+	adjustment := models.JournalEntry{
+		UserID:      userID,
+		Description: "Opening balance adjustment",
+		Date:        time.Now(),
+	}
+	var total models.Money
+	for _, w := range report.Wallets {
+		diff := w.Balance - w.LedgerBalance
+		adjustment.Postings = append(adjustment.Postings, models.Posting{Account: WalletAccount(w.AccountID), Amount: diff})
+		total += diff
+	}
+	savingsDiff := report.SavingsBalance - report.LedgerSavings
+	adjustment.Postings = append(adjustment.Postings,
+		models.Posting{Account: Savings, Amount: savingsDiff},
+		models.Posting{Account: OpeningBalance, Amount: -(total + savingsDiff)})
+	if _, err := Post(tx, adjustment); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
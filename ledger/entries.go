@@ -0,0 +1,77 @@
+package ledger
+
+import (
+	"student-money-manager/models"
+)
+
+// ForTransaction builds the journal entry for a transaction: income debits
+// the wallet and credits income:<category>, an expense debits
+// expense:<category> and credits the wallet, and a transfer debits the
+// destination wallet and credits the source. A split transaction posts one
+// income or expense line per split.
+func ForTransaction(t models.Transaction) models.JournalEntry {
+	id := t.ID
+	entry := models.JournalEntry{
+		UserID:        t.UserID,
+		TransactionID: &id,
+		Description:   t.Description,
+		Date:          t.Date,
+	}
+
+	wallet := WalletAccount(t.AccountID)
+	switch t.Type {
+	case "income":
+		entry.Postings = []models.Posting{{Account: wallet, Amount: t.Amount}}
+		for _, line := range categoryLines(t) {
+			entry.Postings = append(entry.Postings, models.Posting{Account: IncomeAccount(line.Category), Amount: -line.Amount})
+		}
+	case "transfer":
+		entry.Postings = []models.Posting{
+			{Account: WalletAccount(*t.ToAccountID), Amount: t.Amount},
+			{Account: wallet, Amount: -t.Amount},
+		}
+	default:
+		for _, line := range categoryLines(t) {
+			entry.Postings = append(entry.Postings, models.Posting{Account: ExpenseAccount(line.Category), Amount: line.Amount})
+		}
+		entry.Postings = append(entry.Postings, models.Posting{Account: wallet, Amount: -t.Amount})
+	}
+
+	return entry
+}
+
+// categoryLines returns the splits of t, or a single line for its own
+// category when it is not split.
+func categoryLines(t models.Transaction) []models.TransactionSplit {
+	if len(t.Splits) > 0 {
+		return t.Splits
+	}
+	return []models.TransactionSplit{{Category: t.Category, Amount: t.Amount}}
+}
+
+// ForSavingsTransaction builds the journal entry for a transfer between a
+// wallet and savings. Transfers tied to a goal move money into or out of
+// that goal's sub-account instead of unallocated savings.
+func ForSavingsTransaction(st models.SavingsTransaction) models.JournalEntry {
+	id := st.ID
+	savingsAccount := Savings
+	if st.GoalID != nil {
+		savingsAccount = GoalAccount(*st.GoalID)
+	}
+
+	amount := st.Amount
+	if st.Type == "withdrawal" {
+		amount = -amount
+	}
+
+	return models.JournalEntry{
+		UserID:               st.UserID,
+		SavingsTransactionID: &id,
+		Description:          st.Description,
+		Date:                 st.Date,
+		Postings: []models.Posting{
+			{Account: savingsAccount, Amount: amount},
+			{Account: WalletAccount(st.AccountID), Amount: -amount},
+		},
+	}
+}
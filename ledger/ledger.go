@@ -0,0 +1,241 @@
+// Package ledger keeps a double-entry journal next to the balance columns on
+// accounts. Every change to a balance is posted as a journal entry whose
+// postings sum to zero, so the cached balances can always be re-derived and
+// audited from the postings.
+//
+// Sign convention: debits are positive and credits negative. Asset accounts
+// (wallets, savings, savings goals) and expense accounts therefore carry
+// positive balances, income and equity accounts negative ones.
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+)
+
+// Account codes. Wallet, category and goal accounts are built with the
+// helpers below; Current is the prefix of every wallet account.
+const (
+	Current        = "current"
+	Savings        = "savings"
+	OpeningBalance = "equity:opening"
+)
+
+const (
+	KindAsset   = "asset"
+	KindIncome  = "income"
+	KindExpense = "expense"
+	KindEquity  = "equity"
+)
+
+var (
+	ErrUnbalanced   = errors.New("ledger: postings do not sum to zero")
+	ErrOutOfBalance = errors.New("ledger: account balances disagree with postings")
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// WalletAccount is the asset account mirroring the balance of one wallet
+// (a row in accounts).
+func WalletAccount(accountID int) string {
+	return Current + ":" + strconv.Itoa(accountID)
+}
+
+// GoalAccount is the savings sub-account holding money allocated to a goal.
+func GoalAccount(goalID int) string {
+	return Savings + ":goal:" + strconv.Itoa(goalID)
+}
+
+// IncomeAccount is the income account for a transaction category.
+func IncomeAccount(category string) string {
+	return KindIncome + ":" + category
+}
+
+// ExpenseAccount is the expense account for a transaction category.
+func ExpenseAccount(category string) string {
+	return KindExpense + ":" + category
+}
+
+// kindOf derives the account kind from its code.
+func kindOf(code string) string {
+	switch {
+	case strings.HasPrefix(code, KindIncome+":"):
+		return KindIncome
+	case strings.HasPrefix(code, KindExpense+":"):
+		return KindExpense
+	case strings.HasPrefix(code, KindEquity+":"):
+		return KindEquity
+	default:
+		return KindAsset
+	}
+}
+
+// Post validates that the entry balances and writes it with its postings.
+// Ledger accounts are created on first use.
+func Post(tx *sql.Tx, entry models.JournalEntry) (int, error) {
+	var sum models.Money
+	nonZero := 0
+	for _, p := range entry.Postings {
+		sum += p.Amount
+		if p.Amount != 0 {
+			nonZero++
+		}
+	}
+	if sum != 0 {
+		return 0, fmt.Errorf("%w (off by %s)", ErrUnbalanced, sum)
+	}
+	if nonZero == 0 {
+		// Nothing moves, e.g. a zero allowance; there is nothing to record.
+		return 0, nil
+	}
+
+	var entryID int
+	query := `INSERT INTO journal_entries (user_id, transaction_id, savings_transaction_id, reverses_entry_id, description, date, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, NOW())
+			  RETURNING id`
+	err := tx.QueryRow(query, entry.UserID, entry.TransactionID, entry.SavingsTransactionID,
+		entry.ReversesEntryID, entry.Description, entry.Date).Scan(&entryID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range entry.Postings {
+		if p.Amount == 0 {
+			continue
+		}
+		accountID, err := ensureAccount(tx, entry.UserID, p.Account)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT INTO postings (entry_id, ledger_account_id, amount) VALUES ($1, $2, $3)`,
+			entryID, accountID, p.Amount)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return entryID, nil
+}
+
+func ensureAccount(tx *sql.Tx, userID int, code string) (int, error) {
+	var id int
+	query := `INSERT INTO ledger_accounts (user_id, code, kind, created_at)
+			  VALUES ($1, $2, $3, NOW())
+			  ON CONFLICT (user_id, code) DO UPDATE SET code = EXCLUDED.code
+			  RETURNING id`
+	err := tx.QueryRow(query, userID, code, kindOf(code)).Scan(&id)
+	return id, err
+}
+
+// RenameAccount moves a ledger account to a new code, keeping its postings.
+// It is used when a category is renamed. If an account with the new code
+// already exists, the postings are moved onto it and the old account is
+// dropped.
+func RenameAccount(tx *sql.Tx, userID int, from, to string) error {
+	var fromID, toID int
+	err := tx.QueryRow(`SELECT id FROM ledger_accounts WHERE user_id = $1 AND code = $2`, userID, from).Scan(&fromID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`SELECT id FROM ledger_accounts WHERE user_id = $1 AND code = $2`, userID, to).Scan(&toID)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec(`UPDATE ledger_accounts SET code = $1 WHERE id = $2`, to, fromID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE postings SET ledger_account_id = $1 WHERE ledger_account_id = $2`, toID, fromID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM ledger_accounts WHERE id = $1`, fromID)
+	return err
+}
+
+// ReverseTransaction posts a reversing entry for every live entry recorded
+// for a transaction. It is used before a transaction is edited or deleted.
+func ReverseTransaction(tx *sql.Tx, userID, transactionID int) error {
+	query := `SELECT e.id, e.description, e.date FROM journal_entries e
+			  WHERE e.user_id = $1 AND e.transaction_id = $2 AND e.reverses_entry_id IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM journal_entries r WHERE r.reverses_entry_id = e.id)
+			  ORDER BY e.id`
+	rows, err := tx.Query(query, userID, transactionID)
+	if err != nil {
+		return err
+	}
+
+	var live []models.JournalEntry
+	for rows.Next() {
+		var e models.JournalEntry
+		if err := rows.Scan(&e.ID, &e.Description, &e.Date); err != nil {
+			rows.Close()
+			return err
+		}
+		live = append(live, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range live {
+		postings, err := entryPostings(tx, e.ID)
+		if err != nil {
+			return err
+		}
+		for i := range postings {
+			postings[i].Amount = -postings[i].Amount
+		}
+
+		reversed := e.ID
+		txID := transactionID
+		_, err = Post(tx, models.JournalEntry{
+			UserID:          userID,
+			TransactionID:   &txID,
+			ReversesEntryID: &reversed,
+			Description:     fmt.Sprintf("Reversal of entry #%d: %s", e.ID, e.Description),
+			Date:            e.Date,
+			Postings:        postings,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func entryPostings(q Querier, entryID int) ([]models.Posting, error) {
+	query := `SELECT p.id, p.entry_id, a.code, p.amount
+			  FROM postings p JOIN ledger_accounts a ON a.id = p.ledger_account_id
+			  WHERE p.entry_id = $1 ORDER BY p.id`
+	rows, err := q.Query(query, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var postings []models.Posting
+	for rows.Next() {
+		var p models.Posting
+		if err := rows.Scan(&p.ID, &p.EntryID, &p.Account, &p.Amount); err != nil {
+			return nil, err
+		}
+		postings = append(postings, p)
+	}
+	return postings, rows.Err()
+}
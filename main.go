@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
 	"log"
 	"os"
+	"student-money-manager/allowance"
 	"student-money-manager/database"
 	"student-money-manager/handlers"
+	"student-money-manager/ledger"
 	"student-money-manager/middleware"
+	"student-money-manager/reconcile"
+	"student-money-manager/recurring"
+	"student-money-manager/scheduler"
+	"student-money-manager/storage"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	// "github.com/joho/godotenv"
@@ -29,8 +40,36 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Journal balances recorded before the ledger existed
+	if err := ledger.Backfill(db); err != nil {
+		log.Fatal("Failed to backfill ledger:", err)
+	}
+
+	// CLI mode: `main reconcile [-user N] [-repair]`
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := runReconcile(db, os.Args[2:]); err != nil {
+			log.Fatal("Reconcile failed:", err)
+		}
+		return
+	}
+
+	// Background jobs: allowance on payday and due recurring transactions
+	if os.Getenv("SCHEDULER_ENABLED") != "false" {
+		startScheduler(db)
+	}
+
+	// Attachment contents are kept on the local filesystem
+	attachmentsDir := os.Getenv("ATTACHMENTS_DIR")
+	if attachmentsDir == "" {
+		attachmentsDir = "data/attachments"
+	}
+	store, err := storage.NewLocal(attachmentsDir)
+	if err != nil {
+		log.Fatal("Failed to open attachment storage:", err)
+	}
+
 	// Initialize handlers
-	handler := handlers.NewHandler(db)
+	handler := handlers.NewHandler(db, store)
 
 	// Setup Gin router
 	router := gin.Default()
@@ -62,15 +101,102 @@ func main() {
 			protected.PUT("/account", handler.UpdateAccount)
 			protected.POST("/account/auto-allowance", handler.ProcessAutoAllowance)
 
+			// Wallet routes
+			accounts := protected.Group("/accounts")
+			{
+				accounts.GET("", handler.ListAccounts)
+				accounts.POST("", handler.CreateAccount)
+				accounts.PATCH("/:id", handler.PatchAccount)
+				accounts.DELETE("/:id", handler.CloseAccount)
+			}
+
 			// Transaction routes
 			transactions := protected.Group("/transactions")
 			{
 				transactions.GET("", handler.GetTransactions)
 				transactions.POST("", handler.CreateTransaction)
+				transactions.POST("/batch", handler.BatchTransactions)
+				transactions.POST("/recategorize", handler.RecategorizeTransactions)
+				transactions.GET("/search", handler.SearchTransactions)
+				transactions.GET("/duplicates", handler.GetDuplicates)
+				transactions.POST("/duplicates/merge", handler.MergeDuplicates)
+				transactions.POST("/duplicates/dismiss", handler.DismissDuplicates)
 				transactions.GET("/:id", handler.GetTransaction)
 				transactions.PUT("/:id", handler.UpdateTransaction)
 				transactions.PATCH("/:id", handler.PatchTransaction)
 				transactions.DELETE("/:id", handler.DeleteTransaction)
+				transactions.GET("/:id/attachments", handler.GetAttachments)
+				transactions.POST("/:id/attachments", handler.UploadAttachments)
+				transactions.GET("/:id/attachments/:attachmentId", handler.DownloadAttachment)
+				transactions.DELETE("/:id/attachments/:attachmentId", handler.DeleteAttachment)
+			}
+
+			// Category routes
+			categories := protected.Group("/categories")
+			{
+				categories.GET("", handler.GetCategories)
+				categories.POST("", handler.CreateCategory)
+				categories.PATCH("/:id", handler.PatchCategory)
+				categories.POST("/:id/merge", handler.MergeCategory)
+			}
+
+			// Tag routes
+			tags := protected.Group("/tags")
+			{
+				tags.GET("", handler.GetTags)
+				tags.POST("", handler.CreateTag)
+				tags.PATCH("/:id", handler.PatchTag)
+				tags.DELETE("/:id", handler.DeleteTag)
+			}
+
+			// Statement import routes
+			imports := protected.Group("/imports")
+			{
+				imports.POST("", handler.CreateImport)
+				imports.GET("/:id", handler.GetImport)
+				imports.POST("/:id/commit", handler.CommitImport)
+			}
+
+			importProfiles := protected.Group("/import-profiles")
+			{
+				importProfiles.GET("", handler.GetImportProfiles)
+				importProfiles.POST("", handler.CreateImportProfile)
+				importProfiles.PUT("/:id", handler.UpdateImportProfile)
+				importProfiles.DELETE("/:id", handler.DeleteImportProfile)
+			}
+
+			// Recurring transaction routes
+			recurringRoutes := protected.Group("/recurring")
+			{
+				recurringRoutes.GET("", handler.GetRecurringRules)
+				recurringRoutes.POST("", handler.CreateRecurringRule)
+				recurringRoutes.POST("/preview", handler.PreviewRecurringDraft)
+				recurringRoutes.POST("/run", handler.RunRecurringRules)
+				recurringRoutes.GET("/:id", handler.GetRecurringRule)
+				recurringRoutes.PATCH("/:id", handler.PatchRecurringRule)
+				recurringRoutes.DELETE("/:id", handler.DeleteRecurringRule)
+				recurringRoutes.GET("/:id/preview", handler.PreviewRecurringRule)
+			}
+
+			// Budget routes
+			budgets := protected.Group("/budgets")
+			{
+				budgets.GET("", handler.GetBudgets)
+				budgets.POST("", handler.CreateBudget)
+				budgets.GET("/status", handler.GetBudgetStatus)
+				budgets.PUT("/:id", handler.UpdateBudget)
+				budgets.DELETE("/:id", handler.DeleteBudget)
+			}
+
+			// Envelope routes
+			envelopes := protected.Group("/envelopes")
+			{
+				envelopes.GET("", handler.GetEnvelopes)
+				envelopes.POST("", handler.CreateEnvelope)
+				envelopes.GET("/moves", handler.GetEnvelopeMoves)
+				envelopes.POST("/moves", handler.MoveEnvelopeMoney)
+				envelopes.PATCH("/:id", handler.PatchEnvelope)
+				envelopes.DELETE("/:id", handler.DeleteEnvelope)
 			}
 
 			// Analytics routes
@@ -78,6 +204,7 @@ func main() {
 			{
 				analytics.GET("/summary", handler.GetSummary)
 				analytics.GET("/categories", handler.GetCategoryAnalytics)
+				analytics.GET("/tags", handler.GetTagAnalytics)
 			}
 
 			// Savings routes
@@ -90,6 +217,29 @@ func main() {
 				savings.GET("/transactions", handler.GetSavingsTransactions)
 				savings.POST("/transfer", handler.TransferToSavings)
 			}
+
+			// Export routes
+			export := protected.Group("/export")
+			{
+				export.GET("/transactions", handler.ExportTransactions)
+				export.GET("/savings/transactions", handler.ExportSavingsTransactions)
+				export.GET("/savings/goals", handler.ExportSavingsGoals)
+			}
+
+			// Ledger routes
+			ledgerRoutes := protected.Group("/ledger")
+			{
+				ledgerRoutes.GET("/accounts", handler.GetLedgerAccounts)
+				ledgerRoutes.GET("/entries", handler.GetJournalEntries)
+				ledgerRoutes.GET("/verify", handler.VerifyLedger)
+			}
+
+			// Admin routes
+			admin := protected.Group("/admin")
+			admin.Use(middleware.AdminOnly())
+			{
+				admin.POST("/reconcile", handler.Reconcile)
+			}
 		}
 	}
 
@@ -101,3 +251,61 @@ func main() {
 	log.Printf("Server starting on port %s", port)
 	log.Fatal(router.Run(":" + port))
 }
+
+// runReconcile checks balances from the command line and prints the result
+// as JSON. It is a dry run unless -repair is given.
+func runReconcile(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	userID := flags.Int("user", 0, "only reconcile this user ID (default: all users)")
+	repair := flags.Bool("repair", false, "fix drifted balances instead of only reporting them")
+	flags.Parse(args)
+
+	result, err := reconcile.Run(db, reconcile.Options{UserID: *userID, Repair: *repair})
+	if err != nil {
+		return err
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	return out.Encode(result)
+}
+
+// startScheduler runs the periodic jobs in the background. Every instance
+// starts one; advisory locks keep each job on a single instance at a time.
+func startScheduler(db *sql.DB) {
+	interval := time.Hour
+	if value := os.Getenv("SCHEDULER_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatal("Invalid SCHEDULER_INTERVAL:", value)
+		}
+		interval = parsed
+	}
+
+	jobs := []scheduler.Job{
+		{
+			Name:  "allowance",
+			Every: interval,
+			Run: func(db *sql.DB, now time.Time) error {
+				result, err := allowance.Due(db, now)
+				for _, e := range result.Errors {
+					log.Printf("scheduler: allowance for user %d: %s", e.UserID, e.Error)
+				}
+				return err
+			},
+		},
+		{
+			Name:  "recurring",
+			Every: interval,
+			Run: func(db *sql.DB, now time.Time) error {
+				result, err := recurring.Due(db, 0, now)
+				for _, e := range result.Errors {
+					log.Printf("scheduler: recurring rule %d: %s", e.RuleID, e.Error)
+				}
+				return err
+			},
+		},
+	}
+
+	scheduler.New(db, time.Minute, jobs...).Start(context.Background())
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly allows requests whose JWT email is listed in the comma-separated
+// ADMIN_EMAILS environment variable. It must run after JWTAuthMiddleware.
+func AdminOnly() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		email := c.GetString("email")
+
+		for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+			admin = strings.TrimSpace(admin)
+			if admin != "" && strings.EqualFold(admin, email) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		c.Abort()
+	})
+}
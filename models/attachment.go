@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Attachment is a receipt photo or PDF attached to a transaction. Its
+// contents are kept in the attachment store under SHA256, shared by every
+// attachment with the same bytes.
+type Attachment struct {
+	ID            int       `json:"id" db:"id"`
+	UserID        int       `json:"user_id" db:"user_id"`
+	TransactionID int       `json:"transaction_id" db:"transaction_id"`
+	Filename      string    `json:"filename" db:"filename"`
+	ContentType   string    `json:"content_type" db:"content_type"`
+	Size          int64     `json:"size" db:"size"`
+	SHA256        string    `json:"sha256" db:"sha256"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
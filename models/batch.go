@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// TransactionBatchRequest applies up to 100 operations in order, all or
+// none of them.
+type TransactionBatchRequest struct {
+	Operations []TransactionOperation `json:"operations" binding:"required,min=1,max=100"`
+}
+
+// TransactionOperation creates, patches or deletes one transaction. Create
+// takes a TransactionRequest and patch a TransactionPatchRequest in
+// Transaction; patch and delete name the transaction by ID.
+type TransactionOperation struct {
+	Op          string          `json:"op"`
+	ID          int             `json:"id,omitempty"`
+	Transaction json.RawMessage `json:"transaction,omitempty"`
+}
+
+// TransactionOperationResult is the outcome of the operation at Index.
+// Transaction is the created or patched transaction.
+type TransactionOperationResult struct {
+	Index       int          `json:"index"`
+	Op          string       `json:"op"`
+	ID          int          `json:"id"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+}
+
+// TransactionOperationError is why the operation at Index was rejected.
+type TransactionOperationError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+)
+
+// Budget limits spending in one expense category per calendar period.
+// Periods start on Monday, on the first of the month or on January 1st.
+// With Rollover set, whatever was left unspent in a period is added to the
+// next one, starting from the period containing StartDate.
+type Budget struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Category  string    `json:"category" db:"category"`
+	Amount    Money     `json:"amount" db:"amount"`
+	Period    string    `json:"period" db:"period"` // "weekly", "monthly" or "yearly"
+	Rollover  bool      `json:"rollover" db:"rollover"`
+	StartDate time.Time `json:"start_date" db:"start_date"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// BudgetRequest.StartDate defaults to today.
+type BudgetRequest struct {
+	Category  string  `json:"category" binding:"required,max=100"`
+	Amount    Money   `json:"amount" binding:"required,gt=0"`
+	Period    string  `json:"period" binding:"omitempty,oneof=weekly monthly yearly"`
+	Rollover  bool    `json:"rollover"`
+	StartDate *string `json:"start_date,omitempty"`
+}
+
+// BudgetStatus is a budget's position in the period containing a date.
+// Available is the limit plus any rollover; Projected extrapolates the
+// spending so far to the whole period.
+type BudgetStatus struct {
+	BudgetID            int       `json:"budget_id"`
+	Category            string    `json:"category"`
+	Period              string    `json:"period"`
+	PeriodStart         time.Time `json:"period_start"`
+	PeriodEnd           time.Time `json:"period_end"`
+	Limit               Money     `json:"limit"`
+	RolloverAmount      Money     `json:"rollover_amount"`
+	Available           Money     `json:"available"`
+	Spent               Money     `json:"spent"`
+	Remaining           Money     `json:"remaining"`
+	PercentUsed         float64   `json:"percent_used"`
+	Projected           Money     `json:"projected"`
+	OverBudget          bool      `json:"over_budget"`
+	ProjectedOverBudget bool      `json:"projected_over_budget"`
+}
+
+// Envelope holds money assigned to one purpose. Money is assigned from the
+// user's "to be assigned" pool, the part of their wallet balances not yet in
+// any envelope, and expenses drawn from the envelope use it up. Expenses in
+// Category draw from the envelope automatically. A strict envelope rejects
+// expenses larger than what it has left.
+type Envelope struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	Category  *string   `json:"category,omitempty" db:"category"`
+	Strict    bool      `json:"strict" db:"strict"`
+	Assigned  Money     `json:"assigned"`
+	Spent     Money     `json:"spent"`
+	Available Money     `json:"available"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type EnvelopeRequest struct {
+	Name     string  `json:"name" binding:"required,max=100"`
+	Category *string `json:"category,omitempty" binding:"omitempty,min=1,max=100"`
+	Strict   bool    `json:"strict"`
+}
+
+type EnvelopePatchRequest struct {
+	Name     *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Category *string `json:"category,omitempty" binding:"omitempty,max=100"`
+	Strict   *bool   `json:"strict,omitempty"`
+}
+
+// EnvelopeMove moves money between envelopes. A missing FromEnvelopeID takes
+// it from the "to be assigned" pool, a missing ToEnvelopeID returns it there.
+type EnvelopeMove struct {
+	ID             int       `json:"id" db:"id"`
+	UserID         int       `json:"user_id" db:"user_id"`
+	FromEnvelopeID *int      `json:"from_envelope_id,omitempty" db:"from_envelope_id"`
+	ToEnvelopeID   *int      `json:"to_envelope_id,omitempty" db:"to_envelope_id"`
+	Amount         Money     `json:"amount" db:"amount"`
+	Note           string    `json:"note" db:"note"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+type EnvelopeMoveRequest struct {
+	FromEnvelopeID *int   `json:"from_envelope_id,omitempty"`
+	ToEnvelopeID   *int   `json:"to_envelope_id,omitempty"`
+	Amount         Money  `json:"amount" binding:"required,gt=0"`
+	Note           string `json:"note"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+)
+
+// Category is one of a user's income or expense categories. New users get
+// the StudentCategories defaults. Archived categories keep their history but
+// cannot be used for new transactions. A category may sit under a parent of
+// the same type, to any depth; names stay unique per user and type.
+type Category struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	ParentID   *int       `json:"parent_id,omitempty" db:"parent_id"`
+	Name       string     `json:"name" db:"name"`
+	Type       string     `json:"type" db:"type"` // "income" or "expense"
+	Color      string     `json:"color" db:"color"`
+	Icon       string     `json:"icon" db:"icon"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+type CategoryRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Type     string `json:"type" binding:"required,oneof=income expense"`
+	ParentID *int   `json:"parent_id,omitempty"`
+	Color    string `json:"color" binding:"omitempty,hexcolor"`
+	Icon     string `json:"icon" binding:"max=50"`
+}
+
+// CategoryPatchRequest.Name renames the category everywhere it is used,
+// including past transactions. ParentID 0 moves it to the top level.
+type CategoryPatchRequest struct {
+	Name     *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	ParentID *int    `json:"parent_id,omitempty"`
+	Color    *string `json:"color,omitempty" binding:"omitempty,hexcolor"`
+	Icon     *string `json:"icon,omitempty" binding:"omitempty,max=50"`
+	Archived *bool   `json:"archived,omitempty"`
+}
+
+// CategoryNode is a category in the analytics tree. Amount and Count cover
+// the transactions booked on the category itself; Total and TotalCount add
+// those of all its descendants.
+type CategoryNode struct {
+	ID         int             `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	ParentID   *int            `json:"parent_id,omitempty"`
+	Amount     Money           `json:"amount"`
+	Count      int             `json:"count"`
+	Total      Money           `json:"total"`
+	TotalCount int             `json:"total_count"`
+	Children   []*CategoryNode `json:"children"`
+}
+
+// CategoryMergeRequest moves everything booked on a category into the
+// category IntoID, which must have the same type, and deletes it. With
+// Preview set nothing is changed.
+type CategoryMergeRequest struct {
+	IntoID  int  `json:"into_id" binding:"required"`
+	Preview bool `json:"preview"`
+}
+
+// CategoryMergeResult counts the rows a merge moved, or would move in
+// preview mode.
+type CategoryMergeResult struct {
+	Preview        bool `json:"preview"`
+	Transactions   int  `json:"transactions"`
+	Splits         int  `json:"splits"`
+	RecurringRules int  `json:"recurring_rules"`
+	Budgets        int  `json:"budgets"`
+	Envelopes      int  `json:"envelopes"`
+	Subcategories  int  `json:"subcategories"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// DuplicateCandidate is a pair of transactions that are likely the same one
+// recorded twice. Transaction was recorded first. Confidence runs from 0 to
+// 1 and orders the candidates.
+type DuplicateCandidate struct {
+	Transaction           Transaction `json:"transaction"`
+	Duplicate             Transaction `json:"duplicate"`
+	Confidence            float64     `json:"confidence"`
+	DescriptionSimilarity float64     `json:"description_similarity"`
+	DaysApart             int         `json:"days_apart"`
+}
+
+// DuplicatePairRequest names a pair of transactions. Merging keeps
+// TransactionID and deletes DuplicateID; dismissing keeps both and stops
+// reporting the pair.
+type DuplicatePairRequest struct {
+	TransactionID int `json:"transaction_id" binding:"required"`
+	DuplicateID   int `json:"duplicate_id" binding:"required"`
+}
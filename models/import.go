@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+)
+
+// CSVMapping tells the CSV importer how to read a bank's statement. Columns
+// are named by their header or by their 1-based position. Empty fields are
+// detected from the file, and an import reports the mapping it used with
+// every field filled in. A signed Amount column books negative amounts as
+// expenses; Debit and Credit columns are the alternative for banks that
+// split them.
+type CSVMapping struct {
+	Delimiter    string `json:"delimiter,omitempty"`
+	HasHeader    *bool  `json:"has_header,omitempty"`
+	DateFormat   string `json:"date_format,omitempty"`
+	DecimalComma *bool  `json:"decimal_comma,omitempty"`
+	Date         string `json:"date,omitempty"`
+	Amount       string `json:"amount,omitempty"`
+	Debit        string `json:"debit,omitempty"`
+	Credit       string `json:"credit,omitempty"`
+	Type         string `json:"type,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Category     string `json:"category,omitempty"`
+	ExternalID   string `json:"external_id,omitempty"`
+}
+
+// ImportRow is one transaction read from a statement. Line is its line in
+// the file. ExternalID is the bank's id for the transaction, such as the
+// FITID of OFX, if the statement has one; a row whose ExternalID was imported into the wallet
+// before is a Duplicate and is skipped. Error explains why a row cannot be
+// imported.
+type ImportRow struct {
+	Line          int    `json:"line"`
+	Date          string `json:"date,omitempty"`
+	Amount        Money  `json:"amount"`
+	Type          string `json:"type,omitempty"`
+	Category      string `json:"category,omitempty"`
+	Description   string `json:"description"`
+	ExternalID    string `json:"external_id,omitempty"`
+	Duplicate     bool   `json:"duplicate,omitempty"`
+	Error         string `json:"error,omitempty"`
+	TransactionID *int   `json:"transaction_id,omitempty"`
+}
+
+// Import is an uploaded statement. It is parsed and checked on upload, with
+// status "preview", and its rows become transactions when it is committed.
+// Format is csv, ofx or qif. Mapping is the CSV mapping used, holds only
+// the date format for QIF, and is empty for OFX.
+type Import struct {
+	ID          int         `json:"id" db:"id"`
+	UserID      int         `json:"user_id" db:"user_id"`
+	AccountID   int         `json:"account_id" db:"account_id"`
+	Format      string      `json:"format" db:"format"`
+	Filename    string      `json:"filename" db:"filename"`
+	Mapping     *CSVMapping `json:"mapping,omitempty" db:"mapping"`
+	Status      string      `json:"status" db:"status"`
+	Valid       int         `json:"valid"`
+	Invalid     int         `json:"invalid"`
+	Duplicates  int         `json:"duplicates"`
+	Rows        []ImportRow `json:"rows"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	CommittedAt *time.Time  `json:"committed_at,omitempty" db:"committed_at"`
+}
+
+// ImportCommitRequest.SkipInvalid commits the valid rows of an import that
+// also has rows with errors, which is otherwise rejected.
+type ImportCommitRequest struct {
+	SkipInvalid bool `json:"skip_invalid"`
+}
+
+// ImportProfile is a saved CSV mapping, typically one per bank.
+type ImportProfile struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	Name      string     `json:"name" db:"name"`
+	Mapping   CSVMapping `json:"mapping" db:"mapping"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+type ImportProfileRequest struct {
+	Name    string     `json:"name" binding:"required,max=100"`
+	Mapping CSVMapping `json:"mapping"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// LedgerAccount is one account in a user's double-entry chart of accounts,
+// e.g. "current", "savings:goal:3" or "expense:Food & Dining".
+type LedgerAccount struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Code      string    `json:"code" db:"code"`
+	Kind      string    `json:"kind" db:"kind"` // "asset", "income", "expense" or "equity"
+	Balance   Money     `json:"balance"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// JournalEntry groups postings that sum to zero. Entries are never edited;
+// corrections are recorded as reversing entries.
+type JournalEntry struct {
+	ID                   int       `json:"id" db:"id"`
+	UserID               int       `json:"user_id" db:"user_id"`
+	TransactionID        *int      `json:"transaction_id,omitempty" db:"transaction_id"`
+	SavingsTransactionID *int      `json:"savings_transaction_id,omitempty" db:"savings_transaction_id"`
+	ReversesEntryID      *int      `json:"reverses_entry_id,omitempty" db:"reverses_entry_id"`
+	Description          string    `json:"description" db:"description"`
+	Date                 time.Time `json:"date" db:"date"`
+	Postings             []Posting `json:"postings"`
+	CreatedAt            time.Time `json:"created_at" db:"created_at"`
+}
+
+// Posting is a signed amount against a ledger account: debits are positive,
+// credits negative.
+type Posting struct {
+	ID      int    `json:"id" db:"id"`
+	EntryID int    `json:"entry_id" db:"entry_id"`
+	Account string `json:"account"`
+	Amount  Money  `json:"amount" db:"amount"`
+}
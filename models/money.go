@@ -0,0 +1,185 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact monetary amount stored as integer minor units (cents).
+// It maps onto the DECIMAL(20,2) columns without going through float64, so
+// sums and balance comparisons never drift. The representable range is that
+// of int64 cents, roughly ±92 quadrillion.
+type Money int64
+
+const moneyScale = 100
+
+var (
+	ErrMoneyFormat    = errors.New("invalid money amount")
+	ErrMoneyPrecision = errors.New("money amount has more than 2 decimal places")
+	ErrMoneyOverflow  = errors.New("money amount is out of range")
+)
+
+// ParseMoney parses a decimal string such as "12", "-3.5" or "1024.99".
+// Amounts with more than two significant decimal places are rejected rather
+// than rounded.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrMoneyFormat
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrMoneyFormat
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrMoneyFormat
+	}
+
+	// Trailing zeros beyond the scale are harmless ("1.500" from a numeric
+	// column with a wider scale), anything else would lose precision.
+	if len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return 0, ErrMoneyPrecision
+		}
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	var units uint64
+	if whole != "" {
+		w, err := strconv.ParseUint(whole, 10, 64)
+		if err != nil || w > math.MaxInt64/moneyScale {
+			return 0, ErrMoneyOverflow
+		}
+		units = w * moneyScale
+	}
+	f, _ := strconv.ParseUint(frac, 10, 64)
+	units += f
+	if units > math.MaxInt64 {
+		return 0, ErrMoneyOverflow
+	}
+
+	if negative {
+		return -Money(units), nil
+	}
+	return Money(units), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Abs returns the absolute value of the amount.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Float64 returns an approximate floating point value. Use it only for
+// ratios such as percentages, never for arithmetic on amounts.
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// String formats the amount with exactly two decimal places, e.g. "-12.30".
+func (m Money) String() string {
+	sign := ""
+	u := uint64(m)
+	if m < 0 {
+		sign = "-"
+		u = uint64(-m)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, u/moneyScale, u%moneyScale)
+}
+
+// Scan implements sql.Scanner for DECIMAL and integer columns.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		if err != nil {
+			return fmt.Errorf("scan money %q: %w", v, err)
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return fmt.Errorf("scan money %q: %w", v, err)
+		}
+		*m = parsed
+		return nil
+	case int64:
+		if v > math.MaxInt64/moneyScale || v < math.MinInt64/moneyScale {
+			return ErrMoneyOverflow
+		}
+		*m = Money(v * moneyScale)
+		return nil
+	default:
+		return fmt.Errorf("scan money: unsupported type %T", src)
+	}
+}
+
+// Value implements driver.Valuer. The amount is sent as decimal text so
+// Postgres stores it in the DECIMAL column without a float conversion.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimals. The
+// literal is produced from integers, so no precision is lost on the way out.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts either a JSON number (12.5) or a string ("12.50").
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		s = str
+	} else if strings.ContainsAny(s, "eE") {
+		// Exponent notation is valid JSON but not a sensible way to send money.
+		return ErrMoneyFormat
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
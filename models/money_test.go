@@ -0,0 +1,182 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  error
+	}{
+		{"12", 1200, nil},
+		{"1024.99", 102499, nil},
+		{"-3.5", -350, nil},
+		{"+7.05", 705, nil},
+		{".5", 50, nil},
+		{"-.5", -50, nil},
+		{"5.", 500, nil},
+		{" 12.30 ", 1230, nil},
+		{"1.500", 150, nil},
+		{"0.001", 0, ErrMoneyPrecision},
+		{"12.345", 0, ErrMoneyPrecision},
+		{"", 0, ErrMoneyFormat},
+		{"-", 0, ErrMoneyFormat},
+		{".", 0, ErrMoneyFormat},
+		{"1e3", 0, ErrMoneyFormat},
+		{"1,000.00", 0, ErrMoneyFormat},
+		{"--1", 0, ErrMoneyFormat},
+		{"92233720368547758.07", 9223372036854775807, nil},
+		{"92233720368547758.08", 0, ErrMoneyOverflow},
+		{"92233720368547759", 0, ErrMoneyOverflow},
+		{"99999999999999999999999", 0, ErrMoneyOverflow},
+	}
+	for _, test := range tests {
+		got, err := ParseMoney(test.in)
+		if !errors.Is(err, test.err) {
+			t.Errorf("ParseMoney(%q) error = %v, want %v", test.in, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMoneyIsExact(t *testing.T) {
+	a, _ := ParseMoney("0.1")
+	b, _ := ParseMoney("0.2")
+	want, _ := ParseMoney("0.3")
+	if a+b != want {
+		t.Errorf("0.1 + 0.2 = %s, want 0.30", a+b)
+	}
+
+	var sum Money
+	for i := 0; i < 1000; i++ {
+		sum += a
+	}
+	if sum.String() != "100.00" {
+		t.Errorf("1000 × 0.1 = %s, want 100.00", sum)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1230, "12.30"},
+		{-102499, "-1024.99"},
+	}
+	for _, test := range tests {
+		if got := test.in.String(); got != test.want {
+			t.Errorf("Money(%d).String() = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src     interface{}
+		want    Money
+		wantErr bool
+	}{
+		{[]byte("12.30"), 1230, false},
+		{[]byte("-0.05"), -5, false},
+		{"1024.99", 102499, false},
+		{int64(42), 4200, false},
+		{nil, 0, false},
+		{[]byte("12.345"), 0, true},
+		{"abc", 0, true},
+		{int64(1) << 62, 0, true},
+		{12.3, 0, true},
+	}
+	for _, test := range tests {
+		m := Money(999)
+		err := m.Scan(test.src)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Scan(%#v) error = %v, want error %v", test.src, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && m != test.want {
+			t.Errorf("Scan(%#v) = %d, want %d", test.src, m, test.want)
+		}
+	}
+}
+
+func TestMoneyValue(t *testing.T) {
+	value, err := Money(-1230).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "-12.30" {
+		t.Errorf("Value() = %#v, want \"-12.30\"", value)
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{`12.5`, 1250, false},
+		{`"12.50"`, 1250, false},
+		{`-0.1`, -10, false},
+		{`null`, 999, false},
+		{`1e2`, 0, true},
+		{`1.5E1`, 0, true},
+		{`"1e2"`, 0, true},
+		{`12.345`, 0, true},
+		{`"abc"`, 0, true},
+		{`"12.5`, 0, true},
+	}
+	for _, test := range tests {
+		m := Money(999)
+		err := json.Unmarshal([]byte(test.in), &m)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, want error %v", test.in, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && m != test.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", test.in, m, test.want)
+		}
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	type payload struct {
+		Amount Money  `json:"amount"`
+		Target *Money `json:"target"`
+	}
+	target := Money(-99)
+	for _, in := range []payload{
+		{Amount: 0},
+		{Amount: 1230, Target: &target},
+		{Amount: 9223372036854775807},
+	} {
+		data, err := json.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out payload
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if out.Amount != in.Amount || (in.Target == nil) != (out.Target == nil) ||
+			(in.Target != nil && *out.Target != *in.Target) {
+			t.Errorf("round trip of %s gave %+v", data, out)
+		}
+	}
+
+	data, _ := json.Marshal(Money(1230))
+	if string(data) != "12.30" {
+		t.Errorf("Marshal(1230) = %s, want 12.30", data)
+	}
+}
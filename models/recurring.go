@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+)
+
+// RecurringRule generates an income or expense transaction on every
+// occurrence of its schedule between StartDate and EndDate. LastRunDate is
+// the last occurrence already materialized.
+type RecurringRule struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	AccountID   int        `json:"account_id" db:"account_id"`
+	Type        string     `json:"type" db:"type"` // "income" or "expense"
+	Amount      Money      `json:"amount" db:"amount"`
+	Category    string     `json:"category" db:"category"`
+	Description string     `json:"description" db:"description"`
+	Frequency   string     `json:"frequency" db:"frequency"` // "daily", "weekly", "biweekly", "monthly" or "custom"
+	RRule       string     `json:"rrule,omitempty" db:"rrule"`
+	StartDate   time.Time  `json:"start_date" db:"start_date"`
+	EndDate     *time.Time `json:"end_date,omitempty" db:"end_date"`
+	LastRunDate *time.Time `json:"last_run_date,omitempty" db:"last_run_date"`
+	IsActive    bool       `json:"is_active" db:"is_active"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// RecurringRuleRequest.RRule is required for the custom frequency, e.g.
+// "FREQ=MONTHLY;BYMONTHDAY=1,15". AccountID defaults to the primary wallet.
+type RecurringRuleRequest struct {
+	AccountID   *int    `json:"account_id,omitempty"`
+	Type        string  `json:"type" binding:"required,oneof=income expense"`
+	Amount      Money   `json:"amount" binding:"required,gt=0"`
+	Category    string  `json:"category" binding:"required,max=100"`
+	Description string  `json:"description"`
+	Frequency   string  `json:"frequency" binding:"required,oneof=daily weekly biweekly monthly custom"`
+	RRule       string  `json:"rrule" binding:"required_if=Frequency custom"`
+	StartDate   string  `json:"start_date" binding:"required"`
+	EndDate     *string `json:"end_date,omitempty"`
+}
+
+// RecurringRulePatchRequest changes only the fields provided. An empty
+// EndDate removes the end date.
+type RecurringRulePatchRequest struct {
+	AccountID   *int    `json:"account_id,omitempty"`
+	Type        *string `json:"type,omitempty" binding:"omitempty,oneof=income expense"`
+	Amount      *Money  `json:"amount,omitempty" binding:"omitempty,gt=0"`
+	Category    *string `json:"category,omitempty" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description,omitempty"`
+	Frequency   *string `json:"frequency,omitempty" binding:"omitempty,oneof=daily weekly biweekly monthly custom"`
+	RRule       *string `json:"rrule,omitempty"`
+	StartDate   *string `json:"start_date,omitempty"`
+	EndDate     *string `json:"end_date,omitempty"`
+	IsActive    *bool   `json:"is_active,omitempty"`
+}
+
+// Occurrence is one upcoming date of a recurring rule.
+type Occurrence struct {
+	Date        time.Time `json:"date"`
+	Amount      Money     `json:"amount"`
+	Type        string    `json:"type"`
+	Category    string    `json:"category"`
+	Description string    `json:"description"`
+}
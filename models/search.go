@@ -0,0 +1,11 @@
+package models
+
+// SearchResult is a transaction found by full-text search. Rank orders the
+// results, best match first. Highlight is an excerpt of the description with
+// the matched words wrapped in <mark> tags; the rest of the text is not
+// HTML-escaped.
+type SearchResult struct {
+	Transaction
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// Tag is a free-form label a user attaches to any number of transactions.
+// Names are stored trimmed and in lower case and are unique per user.
+type Tag struct {
+	ID               int       `json:"id" db:"id"`
+	UserID           int       `json:"user_id" db:"user_id"`
+	Name             string    `json:"name" db:"name"`
+	Color            string    `json:"color" db:"color"`
+	TransactionCount int       `json:"transaction_count"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type TagRequest struct {
+	Name  string `json:"name" binding:"required,max=50"`
+	Color string `json:"color" binding:"omitempty,hexcolor"`
+}
+
+type TagPatchRequest struct {
+	Name  *string `json:"name,omitempty" binding:"omitempty,min=1,max=50"`
+	Color *string `json:"color,omitempty" binding:"omitempty,hexcolor"`
+}
+
+// TagAnalytics totals the transactions carrying one tag. A transaction with
+// several tags counts towards each of them.
+type TagAnalytics struct {
+	TagID        int    `json:"tag_id"`
+	Tag          string `json:"tag"`
+	TotalIncome  Money  `json:"total_income"`
+	TotalExpense Money  `json:"total_expense"`
+	Count        int    `json:"count"`
+}
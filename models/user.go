@@ -13,29 +13,68 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Account is one of a user's wallets. Every user has exactly one primary
+// account, created at registration, which also carries the user-wide savings
+// balance and allowance settings.
 type Account struct {
-	ID              int       `json:"id" db:"id"`
-	UserID          int       `json:"user_id" db:"user_id"`
-	Balance         float64   `json:"balance" db:"balance"`
-	SavingsBalance  float64   `json:"savings_balance" db:"savings_balance"`
-	AllowanceIncome float64   `json:"allowance_income" db:"allowance_income"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	ID              int        `json:"id" db:"id"`
+	UserID          int        `json:"user_id" db:"user_id"`
+	Name            string     `json:"name" db:"name"`
+	Type            string     `json:"type" db:"type"` // "cash", "bank", "card" or "campus_card"
+	IsPrimary       bool       `json:"is_primary" db:"is_primary"`
+	Balance         Money      `json:"balance" db:"balance"`
+	SavingsBalance  Money      `json:"savings_balance" db:"savings_balance"`
+	AllowanceIncome Money      `json:"allowance_income" db:"allowance_income"`
+	AllowancePayday int        `json:"allowance_payday" db:"allowance_payday"` // day of the month allowance is paid
+	ClosedAt        *time.Time `json:"closed_at,omitempty" db:"closed_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// AccountOverview is the primary account with every wallet and their total.
+type AccountOverview struct {
+	Account
+	Accounts     []Account `json:"accounts"`
+	TotalBalance Money     `json:"total_balance"`
 }
 
 type Transaction struct {
 	ID          int       `json:"id" db:"id"`
 	UserID      int       `json:"user_id" db:"user_id"`
-	Amount      float64   `json:"amount" db:"amount"`
-	Type        string    `json:"type" db:"type"` // "income" or "expense"
+	AccountID   int       `json:"account_id" db:"account_id"`
+	ToAccountID *int      `json:"to_account_id,omitempty" db:"to_account_id"` // destination wallet of a transfer
+	Amount      Money     `json:"amount" db:"amount"`
+	Type        string    `json:"type" db:"type"`                         // "income", "expense" or "transfer"
+	CategoryID  *int      `json:"category_id,omitempty" db:"category_id"` // nil for transfers and split transactions
 	Category    string    `json:"category" db:"category"`
 	Description string    `json:"description" db:"description"`
 	Date        time.Time `json:"date" db:"date"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+
+	RecurringRuleID *int               `json:"recurring_rule_id,omitempty" db:"recurring_rule_id"` // rule that generated it
+	EnvelopeID      *int               `json:"envelope_id,omitempty" db:"envelope_id"`             // envelope an expense draws from
+	Splits          []TransactionSplit `json:"splits,omitempty"`
+	Tags            []string           `json:"tags,omitempty"`
+
+	// EnvelopeOverspent is set in create and update responses when the
+	// expense took its envelope below zero, by that much.
+	EnvelopeOverspent Money `json:"envelope_overspent,omitempty"`
+}
+
+// TransactionSplit is one line item of a transaction split across several
+// categories. The split amounts of a transaction add up to its amount and the
+// transaction itself is stored with the category "Split".
+type TransactionSplit struct {
+	ID            int    `json:"id" db:"id"`
+	TransactionID int    `json:"transaction_id" db:"transaction_id"`
+	CategoryID    *int   `json:"category_id,omitempty" db:"category_id"`
+	Category      string `json:"category" db:"category"`
+	Amount        Money  `json:"amount" db:"amount"`
+	Note          string `json:"note" db:"note"`
 }
 
-// Student-specific expense categories
+// StudentCategories are the categories every new user starts with.
 var StudentCategories = map[string][]string{
 	"expense": {
 		"Food & Dining",
@@ -68,20 +107,101 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type AccountRequest struct {
+	Name           string `json:"name" binding:"required,max=100"`
+	Type           string `json:"type" binding:"required,oneof=cash bank card campus_card"`
+	InitialBalance Money  `json:"initial_balance" binding:"gte=0"`
+}
+
+type AccountPatchRequest struct {
+	Name *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Type *string `json:"type,omitempty" binding:"omitempty,oneof=cash bank card campus_card"`
+}
+
+// TransactionRequest.AccountID selects the wallet; it defaults to the
+// primary account when omitted. A transfer moves money from AccountID to
+// ToAccountID and needs no category. An income or expense either has a
+// category, given by CategoryID or by name in Category, or is split into
+// Splits, whose amounts must add up to Amount. An expense draws from
+// EnvelopeID, or from the envelope of its category when omitted. Tags that
+// do not exist yet are created.
 type TransactionRequest struct {
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
-	Type        string  `json:"type" binding:"required,oneof=income expense"`
-	Category    string  `json:"category" binding:"required"`
-	Description string  `json:"description"`
-	Date        string  `json:"date" binding:"required"`
+	AccountID   *int                      `json:"account_id,omitempty"`
+	ToAccountID *int                      `json:"to_account_id,omitempty" binding:"required_if=Type transfer"`
+	Amount      Money                     `json:"amount" binding:"required,gt=0"`
+	Type        string                    `json:"type" binding:"required,oneof=income expense transfer"`
+	CategoryID  *int                      `json:"category_id,omitempty"`
+	Category    string                    `json:"category"`
+	Description string                    `json:"description"`
+	Date        string                    `json:"date" binding:"required"`
+	Splits      []TransactionSplitRequest `json:"splits,omitempty" binding:"omitempty,dive"`
+	EnvelopeID  *int                      `json:"envelope_id,omitempty"`
+	Tags        []string                  `json:"tags,omitempty" binding:"omitempty,max=20"`
 }
 
+// TransactionPatchRequest.Splits and Tags replace the splits and tags of the
+// transaction when present. Setting only CategoryID or Category turns a split
+// transaction back into a single category one. EnvelopeID 0 takes the expense
+// out of its envelope.
 type TransactionPatchRequest struct {
-	Amount      *float64 `json:"amount,omitempty" binding:"omitempty,gt=0"`
-	Type        *string  `json:"type,omitempty" binding:"omitempty,oneof=income expense"`
-	Category    *string  `json:"category,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	Date        *string  `json:"date,omitempty"`
+	AccountID   *int                       `json:"account_id,omitempty"`
+	ToAccountID *int                       `json:"to_account_id,omitempty"`
+	Amount      *Money                     `json:"amount,omitempty" binding:"omitempty,gt=0"`
+	Type        *string                    `json:"type,omitempty" binding:"omitempty,oneof=income expense transfer"`
+	CategoryID  *int                       `json:"category_id,omitempty"`
+	Category    *string                    `json:"category,omitempty"`
+	Description *string                    `json:"description,omitempty"`
+	Date        *string                    `json:"date,omitempty"`
+	Splits      *[]TransactionSplitRequest `json:"splits,omitempty" binding:"omitempty,dive"`
+	EnvelopeID  *int                       `json:"envelope_id,omitempty"`
+	Tags        *[]string                  `json:"tags,omitempty" binding:"omitempty,max=20"`
+}
+
+type TransactionSplitRequest struct {
+	CategoryID *int   `json:"category_id,omitempty"`
+	Category   string `json:"category" binding:"required_without=CategoryID,max=100"`
+	Amount     Money  `json:"amount" binding:"required,gt=0"`
+	Note       string `json:"note"`
+}
+
+// TransactionFilter selects transactions. Categories and CategoryIDs match
+// a transaction in any of the categories or their subcategories, including
+// split transactions with a line in one of them. From and To are YYYY-MM-DD
+// and inclusive, as are the amount bounds. Description matches any part of
+// the description, ignoring case. TagsAny and TagsAll are comma-separated
+// tag names, of which a transaction needs one or all. Query is written in
+// the syntax of package querylang.
+type TransactionFilter struct {
+	CategoryIDs []int    `json:"category_ids,omitempty"`
+	Categories  []string `json:"categories,omitempty"`
+	Type        string   `json:"type,omitempty" binding:"omitempty,oneof=income expense transfer"`
+	AccountID   *int     `json:"account_id,omitempty"`
+	From        string   `json:"from,omitempty"`
+	To          string   `json:"to,omitempty"`
+	MinAmount   *Money   `json:"min_amount,omitempty"`
+	MaxAmount   *Money   `json:"max_amount,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tag         string   `json:"tag,omitempty"`
+	TagsAny     string   `json:"tags_any,omitempty"`
+	TagsAll     string   `json:"tags_all,omitempty"`
+	Query       string   `json:"q,omitempty"`
+}
+
+// RecategorizeRequest moves every income or expense matching Filter into
+// CategoryID. Split transactions are left alone. With Preview set nothing is
+// changed.
+type RecategorizeRequest struct {
+	Filter     TransactionFilter `json:"filter"`
+	CategoryID int               `json:"category_id" binding:"required"`
+	Preview    bool              `json:"preview"`
+}
+
+// RecategorizeResult lists the transactions a recategorization changed, or
+// would change in preview mode.
+type RecategorizeResult struct {
+	Preview        bool  `json:"preview"`
+	Affected       int   `json:"affected"`
+	TransactionIDs []int `json:"transaction_ids"`
 }
 
 type AuthResponse struct {
@@ -89,27 +209,40 @@ type AuthResponse struct {
 	User  User   `json:"user"`
 }
 
+// Summary totals cover every wallet; CurrentBalance is the sum of the wallet
+// balances.
 type Summary struct {
-	TotalIncome      float64 `json:"total_income"`
-	TotalExpense     float64 `json:"total_expense"`
-	CurrentBalance   float64 `json:"current_balance"`
-	SavingsBalance   float64 `json:"savings_balance"`
-	TransactionCount int     `json:"transaction_count"`
+	TotalIncome      Money           `json:"total_income"`
+	TotalExpense     Money           `json:"total_expense"`
+	CurrentBalance   Money           `json:"current_balance"`
+	SavingsBalance   Money           `json:"savings_balance"`
+	TransactionCount int             `json:"transaction_count"`
+	Wallets          []WalletSummary `json:"wallets"`
+}
+
+type WalletSummary struct {
+	AccountID        int    `json:"account_id"`
+	Name             string `json:"name"`
+	Type             string `json:"type"`
+	Balance          Money  `json:"balance"`
+	TotalIncome      Money  `json:"total_income"`
+	TotalExpense     Money  `json:"total_expense"`
+	TransactionCount int    `json:"transaction_count"`
 }
 
 type CategoryAnalytics struct {
-	Category string  `json:"category"`
-	Amount   float64 `json:"amount"`
-	Count    int     `json:"count"`
-	Type     string  `json:"type"`
+	Category string `json:"category"`
+	Amount   Money  `json:"amount"`
+	Count    int    `json:"count"`
+	Type     string `json:"type"`
 }
 
 type SavingsGoal struct {
 	ID            int        `json:"id" db:"id"`
 	UserID        int        `json:"user_id" db:"user_id"`
 	Name          string     `json:"name" db:"name"`
-	TargetAmount  float64    `json:"target_amount" db:"target_amount"`
-	CurrentAmount float64    `json:"current_amount" db:"current_amount"`
+	TargetAmount  Money      `json:"target_amount" db:"target_amount"`
+	CurrentAmount Money      `json:"current_amount" db:"current_amount"`
 	Deadline      *time.Time `json:"deadline,omitempty" db:"deadline"`
 	Description   string     `json:"description" db:"description"`
 	IsActive      bool       `json:"is_active" db:"is_active"`
@@ -120,8 +253,9 @@ type SavingsGoal struct {
 type SavingsTransaction struct {
 	ID          int       `json:"id" db:"id"`
 	UserID      int       `json:"user_id" db:"user_id"`
+	AccountID   int       `json:"account_id" db:"account_id"`
 	GoalID      *int      `json:"goal_id,omitempty" db:"goal_id"`
-	Amount      float64   `json:"amount" db:"amount"`
+	Amount      Money     `json:"amount" db:"amount"`
 	Type        string    `json:"type" db:"type"` // "deposit" or "withdrawal"
 	Description string    `json:"description" db:"description"`
 	Date        time.Time `json:"date" db:"date"`
@@ -131,22 +265,25 @@ type SavingsTransaction struct {
 
 type SavingsGoalRequest struct {
 	Name         string  `json:"name" binding:"required"`
-	TargetAmount float64 `json:"target_amount" binding:"required,gt=0"`
+	TargetAmount Money   `json:"target_amount" binding:"required,gt=0"`
 	Deadline     *string `json:"deadline,omitempty"`
 	Description  string  `json:"description"`
 }
 
 type SavingsTransactionRequest struct {
-	GoalID      *int    `json:"goal_id,omitempty"`
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
-	Type        string  `json:"type" binding:"required,oneof=deposit withdrawal"`
-	Description string  `json:"description"`
-	Date        string  `json:"date" binding:"required"`
+	GoalID      *int   `json:"goal_id,omitempty"`
+	Amount      Money  `json:"amount" binding:"required,gt=0"`
+	Type        string `json:"type" binding:"required,oneof=deposit withdrawal"`
+	Description string `json:"description"`
+	Date        string `json:"date" binding:"required"`
 }
 
+// SavingsTransferRequest.AccountID selects the wallet money moves out of or
+// into; it defaults to the primary account.
 type SavingsTransferRequest struct {
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
-	Type        string  `json:"type" binding:"required,oneof=to_savings from_savings"`
-	Description string  `json:"description"`
-	GoalID      *int    `json:"goal_id,omitempty"`
+	AccountID   *int   `json:"account_id,omitempty"`
+	Amount      Money  `json:"amount" binding:"required,gt=0"`
+	Type        string `json:"type" binding:"required,oneof=to_savings from_savings"`
+	Description string `json:"description"`
+	GoalID      *int   `json:"goal_id,omitempty"`
 }
@@ -0,0 +1,379 @@
+// Package querylang parses the compact transaction filter syntax, such as
+//
+//	category:"Food & Dining" amount>10 date>=2026-01-01 -tag:reimbursable desc~coffee
+//
+// Terms separated by spaces must all match; OR between terms matches either
+// side, and parentheses group. A leading - negates a term. A term is a
+// field, an operator and a value, or a bare word or quoted phrase that the
+// description must contain.
+//
+// Fields and their operators:
+//
+//	category, cat  : = != ~   category name; : and = include subcategories
+//	type           : = !=     income, expense or transfer
+//	amount         : = != < <= > >=
+//	date           : = != < <= > >=   YYYY-MM-DD
+//	description, desc  : = != ~   : and ~ match any part of the text
+//	tag            : = != ~
+//	account        : = !=     wallet id
+//
+// Text comparisons ignore case.
+package querylang
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"student-money-manager/models"
+	"time"
+	"unicode"
+)
+
+// Node is a parsed query: an And, Or, Not or Cond.
+type Node interface {
+	node()
+}
+
+// And matches when every node matches.
+type And []Node
+
+// Or matches when any node matches.
+type Or []Node
+
+// Not matches when its node does not.
+type Not struct {
+	Node Node
+}
+
+// Cond compares a field with a value. Op is one of = ~ < <= > >=; : is
+// read as = except for description, where it means ~. The value is parsed
+// into Amount for amount, Date for date and ID for account, and kept in
+// Text otherwise.
+type Cond struct {
+	Field  string
+	Op     string
+	Text   string
+	Amount models.Money
+	Date   time.Time
+	ID     int
+}
+
+func (And) node()  {}
+func (Or) node()   {}
+func (Not) node()  {}
+func (Cond) node() {}
+
+// Error is a syntax error at Pos, the 1-based character position in the
+// query.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+// fields maps field names and their aliases to the field and the operators
+// it accepts.
+var fields = map[string]struct {
+	name string
+	ops  string
+}{
+	"category":    {"category", ": = != ~"},
+	"cat":         {"category", ": = != ~"},
+	"type":        {"type", ": = !="},
+	"amount":      {"amount", ": = != < <= > >="},
+	"date":        {"date", ": = != < <= > >="},
+	"description": {"description", ": = != ~"},
+	"desc":        {"description", ": = != ~"},
+	"tag":         {"tag", ": = != ~"},
+	"account":     {"account", ": = !="},
+}
+
+// MaxDepth is how deeply negations and parentheses may nest.
+const MaxDepth = 32
+
+// operators are tried longest first.
+var operators = []string{"<=", ">=", "!=", ":", "=", "~", "<", ">"}
+
+// Parse parses a query. An empty query returns a nil Node.
+func Parse(query string) (Node, error) {
+	p := &parser{src: []rune(query)}
+	p.skipSpace()
+	if p.done() {
+		return nil, nil
+	}
+
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected '%c'", p.src[p.pos])
+	}
+	return node, nil
+}
+
+type parser struct {
+	src   []rune
+	pos   int
+	depth int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.pos, format, args...)
+}
+
+func (p *parser) errorAt(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// atOr reports whether the next word is the OR keyword.
+func (p *parser) atOr() bool {
+	end := p.pos + 2
+	return end <= len(p.src) && string(p.src[p.pos:end]) == "OR" &&
+		(end == len(p.src) || unicode.IsSpace(p.src[end]) || p.src[end] == '(')
+}
+
+func (p *parser) or() (Node, error) {
+	var nodes Or
+	for {
+		node, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if !p.atOr() {
+			break
+		}
+		p.pos += 2
+		p.skipSpace()
+		if p.done() || p.src[p.pos] == ')' {
+			return nil, p.errorf("expected a term after OR")
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) and() (Node, error) {
+	var nodes And
+	for !p.done() && p.src[p.pos] != ')' && !p.atOr() {
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		p.skipSpace()
+	}
+	switch len(nodes) {
+	case 0:
+		if p.done() {
+			return nil, p.errorf("expected a term")
+		}
+		return nil, p.errorf("expected a term before '%c'", p.src[p.pos])
+	case 1:
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.src[p.pos] == '-' || p.src[p.pos] == '(' {
+		if p.depth == MaxDepth {
+			return nil, p.errorf("the query nests more than %d levels deep", MaxDepth)
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+	}
+
+	if p.src[p.pos] == '-' {
+		p.pos++
+		if p.done() || unicode.IsSpace(p.src[p.pos]) || p.src[p.pos] == ')' {
+			return nil, p.errorf("expected a term after '-'")
+		}
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{node}, nil
+	}
+
+	if p.src[p.pos] == '(' {
+		open := p.pos
+		p.pos++
+		p.skipSpace()
+		if p.done() {
+			return nil, p.errorAt(open, "unclosed '('")
+		}
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() {
+			return nil, p.errorAt(open, "unclosed '('")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	return p.term()
+}
+
+// term reads field:value or a bare word or phrase.
+func (p *parser) term() (Node, error) {
+	start := p.pos
+	if p.src[p.pos] == '"' {
+		text, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return Cond{Field: "description", Op: "~", Text: text}, nil
+	}
+
+	name := p.pos
+	for !p.done() && (unicode.IsLetter(p.src[p.pos]) || p.src[p.pos] == '_') {
+		p.pos++
+	}
+	field := strings.ToLower(string(p.src[name:p.pos]))
+	op := p.operator()
+	if field == "" || op == "" {
+		p.pos = start
+		text := p.word()
+		return Cond{Field: "description", Op: "~", Text: text}, nil
+	}
+
+	spec, ok := fields[field]
+	if !ok {
+		return nil, p.errorAt(name, "unknown field '%s'", field)
+	}
+	if !strings.Contains(" "+spec.ops+" ", " "+op+" ") {
+		return nil, p.errorAt(p.pos-len(op), "operator '%s' cannot be used with %s", op, spec.name)
+	}
+
+	valuePos := p.pos
+	var value string
+	if !p.done() && p.src[p.pos] == '"' {
+		text, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		value = text
+	} else {
+		value = p.word()
+	}
+	if value == "" {
+		return nil, p.errorAt(valuePos, "expected a value after '%s%s'", field, op)
+	}
+
+	cond := Cond{Field: spec.name, Op: op}
+	negate := op == "!="
+	switch {
+	case negate:
+		cond.Op = "="
+	case op == ":" && spec.name == "description":
+		cond.Op = "~"
+	case op == ":":
+		cond.Op = "="
+	}
+
+	if err := p.value(&cond, value, valuePos); err != nil {
+		return nil, err
+	}
+	if negate {
+		return Not{cond}, nil
+	}
+	return cond, nil
+}
+
+// value parses the value of cond.
+func (p *parser) value(cond *Cond, value string, pos int) error {
+	switch cond.Field {
+	case "type":
+		value = strings.ToLower(value)
+		if value != "income" && value != "expense" && value != "transfer" {
+			return p.errorAt(pos, "type must be income, expense or transfer, got '%s'", value)
+		}
+		cond.Text = value
+	case "amount":
+		amount, err := models.ParseMoney(value)
+		if err != nil {
+			return p.errorAt(pos, "invalid amount '%s'", value)
+		}
+		cond.Amount = amount
+	case "date":
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return p.errorAt(pos, "invalid date '%s', use YYYY-MM-DD", value)
+		}
+		cond.Date = date
+	case "account":
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return p.errorAt(pos, "account must be a wallet id, got '%s'", value)
+		}
+		cond.ID = id
+	default:
+		cond.Text = value
+	}
+	return nil
+}
+
+func (p *parser) operator() string {
+	rest := string(p.src[p.pos:min(p.pos+2, len(p.src))])
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			p.pos += len([]rune(op))
+			return op
+		}
+	}
+	return ""
+}
+
+// word reads up to the next space or parenthesis.
+func (p *parser) word() string {
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(p.src[p.pos]) && p.src[p.pos] != '(' && p.src[p.pos] != ')' {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+// quoted reads a double-quoted string, in which \" and \\ are escapes.
+func (p *parser) quoted() (string, error) {
+	open := p.pos
+	p.pos++
+
+	var b strings.Builder
+	for !p.done() {
+		r := p.src[p.pos]
+		p.pos++
+		switch {
+		case r == '"':
+			if b.Len() == 0 {
+				return "", p.errorAt(open, "empty quoted string")
+			}
+			return b.String(), nil
+		case r == '\\' && !p.done() && (p.src[p.pos] == '"' || p.src[p.pos] == '\\'):
+			b.WriteRune(p.src[p.pos])
+			p.pos++
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return "", p.errorAt(open, "unterminated quoted string")
+}
@@ -0,0 +1,125 @@
+package querylang
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func desc(text string) Cond {
+	return Cond{Field: "description", Op: "~", Text: text}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Node
+	}{
+		{"", nil},
+		{"   ", nil},
+		{
+			`category:"Food & Dining" amount>10 date>=2026-01-01 -tag:reimbursable desc~coffee`,
+			And{
+				Cond{Field: "category", Op: "=", Text: "Food & Dining"},
+				Cond{Field: "amount", Op: ">", Amount: 1000},
+				Cond{Field: "date", Op: ">=", Date: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+				Not{Cond{Field: "tag", Op: "=", Text: "reimbursable"}},
+				desc("coffee"),
+			},
+		},
+		{"coffee", desc("coffee")},
+		{`"campus coffee"`, desc("campus coffee")},
+		{`desc:"say \"hi\""`, desc(`say "hi"`)},
+		{"type!=transfer", Not{Cond{Field: "type", Op: "=", Text: "transfer"}}},
+		{"cat~food account=3", And{Cond{Field: "category", Op: "~", Text: "food"}, Cond{Field: "account", Op: "=", ID: 3}}},
+		{"TYPE:Income", Cond{Field: "type", Op: "=", Text: "income"}},
+		// OR binds looser than the implicit AND
+		{"a b OR c", Or{And{desc("a"), desc("b")}, desc("c")}},
+		{"a OR b c", Or{desc("a"), And{desc("b"), desc("c")}}},
+		{"a OR b OR c", Or{desc("a"), desc("b"), desc("c")}},
+		{"a (b OR c)", And{desc("a"), Or{desc("b"), desc("c")}}},
+		{"(a OR b) c", And{Or{desc("a"), desc("b")}, desc("c")}},
+		{"a OR(b)", Or{desc("a"), desc("b")}},
+		{"-(a OR b)", Not{Or{desc("a"), desc("b")}}},
+		{"--a", Not{Not{desc("a")}}},
+		{"((a))", desc("a")},
+		// Only an upper case OR standing alone is the keyword
+		{"a or b", And{desc("a"), desc("or"), desc("b")}},
+		{"a ORANGE", And{desc("a"), desc("ORANGE")}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{`desc:"coffee`, 6, "unterminated quoted string"},
+		{`"coffee`, 1, "unterminated quoted string"},
+		{`desc:""`, 6, "empty quoted string"},
+		{"(a OR b", 1, "unclosed '('"},
+		{"amount>1 (x", 10, "unclosed '('"},
+		{"x (", 3, "unclosed '('"},
+		{"a)", 2, "unexpected ')'"},
+		{"colour:red", 1, "unknown field 'colour'"},
+		{"a foo:bar", 3, "unknown field 'foo'"},
+		{"type>income", 5, "operator '>' cannot be used with type"},
+		{"category<=food", 9, "operator '<=' cannot be used with category"},
+		{"account~3", 8, "operator '~' cannot be used with account"},
+		{"date>=2026-13-01", 7, "invalid date '2026-13-01', use YYYY-MM-DD"},
+		{"a date:yesterday", 8, "invalid date 'yesterday', use YYYY-MM-DD"},
+		{"amount>ten", 8, "invalid amount 'ten'"},
+		{"amount=1.234", 8, "invalid amount '1.234'"},
+		{"type:refund", 6, "type must be income, expense or transfer, got 'refund'"},
+		{"account:main", 9, "account must be a wallet id, got 'main'"},
+		{"tag:", 5, "expected a value after 'tag:'"},
+		{"a OR", 5, "expected a term after OR"},
+		{"(a OR )", 7, "expected a term after OR"},
+		{"- a", 2, "expected a term after '-'"},
+		{"()", 2, "expected a term before ')'"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.query)
+		var perr *Error
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse(%q) error = %v, want a *Error", test.query, err)
+			continue
+		}
+		if perr.Pos != test.pos || perr.Msg != test.msg {
+			t.Errorf("Parse(%q) error = %d %q, want %d %q", test.query, perr.Pos, perr.Msg, test.pos, test.msg)
+		}
+	}
+}
+
+func TestParseDepth(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "a" + strings.Repeat(")", depth)
+	}
+	if _, err := Parse(nested(MaxDepth)); err != nil {
+		t.Errorf("%d levels: %v", MaxDepth, err)
+	}
+	if _, err := Parse(strings.Repeat("-", MaxDepth) + "a"); err != nil {
+		t.Errorf("%d negations: %v", MaxDepth, err)
+	}
+
+	for _, query := range []string{nested(MaxDepth + 1), strings.Repeat("-", MaxDepth+1) + "a", nested(100000)} {
+		_, err := Parse(query)
+		var perr *Error
+		if !errors.As(err, &perr) || perr.Pos != MaxDepth+1 {
+			t.Errorf("Parse of %d characters: error = %v, want one at position %d", len(query), err, MaxDepth+1)
+		}
+	}
+}
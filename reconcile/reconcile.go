@@ -0,0 +1,257 @@
+// Package reconcile recomputes each user's balances from the transaction
+// history and reports, or repairs, accounts whose cached balances drifted.
+package reconcile
+
+import (
+	"database/sql"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"time"
+)
+
+// ReconciliationAccount is the equity account that absorbs repairs, so the
+// journal records every correction made by a reconcile run.
+const ReconciliationAccount = "equity:reconciliation"
+
+// Options selects what a run covers. The zero value is a dry run over all
+// users.
+type Options struct {
+	UserID int  // 0 means every user
+	Repair bool // false reports only
+}
+
+// WalletDiscrepancy is one wallet whose balance disagrees with its history.
+type WalletDiscrepancy struct {
+	AccountID       int          `json:"account_id"`
+	Balance         models.Money `json:"balance"`
+	ExpectedBalance models.Money `json:"expected_balance"`
+	Difference      models.Money `json:"difference"`
+}
+
+// Discrepancy describes one user whose cached balances disagree with the
+// history. Expected values are computed as:
+//
+//	wallet balance  = opening + SUM(income) - SUM(expense) - (deposits - withdrawals)
+//	                  over the transactions and transfers of that wallet
+//	savings_balance = opening + deposits - withdrawals over all wallets
+//
+// where opening is the money the journal books against equity:opening, such
+// as a wallet's initial balance.
+type Discrepancy struct {
+	UserID            int                 `json:"user_id"`
+	Wallets           []WalletDiscrepancy `json:"wallets"`
+	SavingsBalance    models.Money        `json:"savings_balance"`
+	ExpectedSavings   models.Money        `json:"expected_savings_balance"`
+	SavingsDifference models.Money        `json:"savings_difference"`
+	Repaired          bool                `json:"repaired"`
+}
+
+func (d Discrepancy) drifted() bool {
+	return len(d.Wallets) > 0 || d.SavingsDifference != 0
+}
+
+// Result summarizes a run.
+type Result struct {
+	DryRun        bool          `json:"dry_run"`
+	UsersChecked  int           `json:"users_checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Run checks the selected users. With Repair set, each drifted account is
+// corrected in its own database transaction while its row is locked, and
+// the journal is adjusted against equity:reconciliation so the cached
+// balances, the ledger and the history agree.
+func Run(db *sql.DB, opts Options) (Result, error) {
+	result := Result{DryRun: !opts.Repair, Discrepancies: []Discrepancy{}}
+
+	userIDs, err := accountUsers(db, opts.UserID)
+	if err != nil {
+		return result, err
+	}
+
+	for _, userID := range userIDs {
+		var d Discrepancy
+		var found bool
+		if opts.Repair {
+			d, found, err = repairUser(db, userID)
+		} else {
+			d, err = expected(db, userID)
+			found = d.drifted()
+		}
+		if err != nil {
+			return result, err
+		}
+
+		result.UsersChecked++
+		if found {
+			result.Discrepancies = append(result.Discrepancies, d)
+		}
+	}
+
+	return result, nil
+}
+
+func accountUsers(db *sql.DB, userID int) ([]int, error) {
+	query := `SELECT DISTINCT user_id FROM accounts WHERE $1 = 0 OR user_id = $1 ORDER BY user_id`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// expected reads the cached balances and recomputes them from history.
+// Only drifted wallets are listed in the result.
+func expected(q ledger.Querier, userID int) (Discrepancy, error) {
+	d := Discrepancy{UserID: userID, Wallets: []WalletDiscrepancy{}}
+
+	query := `SELECT a.id, a.balance,
+				` + openingBalance("$2 || ':' || a.id") + `
+				+ COALESCE((SELECT SUM(CASE WHEN t.type = 'income' THEN t.amount ELSE -t.amount END)
+						  FROM transactions t WHERE t.account_id = a.id), 0)
+				+ COALESCE((SELECT SUM(t.amount)
+						  FROM transactions t WHERE t.to_account_id = a.id AND t.type = 'transfer'), 0)
+				- COALESCE((SELECT SUM(CASE WHEN st.type = 'deposit' THEN st.amount ELSE -st.amount END)
+						  FROM savings_transactions st WHERE st.account_id = a.id), 0)
+			  FROM accounts a WHERE a.user_id = $1 ORDER BY a.id`
+	rows, err := q.Query(query, userID, ledger.Current)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var w WalletDiscrepancy
+		if err := rows.Scan(&w.AccountID, &w.Balance, &w.ExpectedBalance); err != nil {
+			return d, err
+		}
+		w.Difference = w.Balance - w.ExpectedBalance
+		if w.Difference != 0 {
+			d.Wallets = append(d.Wallets, w)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	err = q.QueryRow(`SELECT COALESCE(SUM(savings_balance), 0) FROM accounts WHERE user_id = $1`, userID).
+		Scan(&d.SavingsBalance)
+	if err != nil {
+		return d, err
+	}
+
+	err = q.QueryRow(`SELECT `+openingBalance("$2")+`
+					  + COALESCE((SELECT SUM(CASE WHEN type = 'deposit' THEN amount ELSE -amount END)
+								  FROM savings_transactions WHERE user_id = $1), 0)`, userID, ledger.Savings).Scan(&d.ExpectedSavings)
+	if err != nil {
+		return d, err
+	}
+
+	d.SavingsDifference = d.SavingsBalance - d.ExpectedSavings
+	return d, nil
+}
+
+// openingBalance sums what journal entries against equity:opening posted
+// to the ledger account whose code the SQL expression code yields, for the
+// user in $1. The history explains everything else in a balance.
+func openingBalance(code string) string {
+	return `COALESCE((SELECT SUM(p.amount)
+					  FROM postings p
+					  JOIN ledger_accounts la ON la.id = p.ledger_account_id
+					  WHERE la.user_id = $1 AND la.code = ` + code + `
+					  AND EXISTS (SELECT 1 FROM postings op
+								  JOIN ledger_accounts ol ON ol.id = op.ledger_account_id
+								  WHERE op.entry_id = p.entry_id AND ol.code = '` + ledger.OpeningBalance + `')), 0)`
+}
+
+func repairUser(db *sql.DB, userID int) (Discrepancy, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Discrepancy{}, false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM accounts WHERE user_id = $1 ORDER BY id FOR UPDATE`, userID); err != nil {
+		return Discrepancy{}, false, err
+	}
+
+	d, err := expected(tx, userID)
+	if err != nil {
+		return d, false, err
+	}
+	if !d.drifted() {
+		return d, false, nil
+	}
+
+	// The journal may or may not have followed the drift, depending on how
+	// the cached balance was changed, so the adjustment brings the ledger
+	// from wherever it stands to the expected balance
+	books, err := ledger.Check(tx, userID)
+	if err != nil {
+		return d, true, err
+	}
+	expectedBalances := map[int]models.Money{}
+	for _, w := range books.Wallets {
+		expectedBalances[w.AccountID] = w.Balance
+	}
+	for _, w := range d.Wallets {
+		_, err := tx.Exec(`UPDATE accounts SET balance = $1, updated_at = NOW() WHERE id = $2`, w.ExpectedBalance, w.AccountID)
+		if err != nil {
+			return d, true, err
+		}
+		expectedBalances[w.AccountID] = w.ExpectedBalance
+	}
+
+	adjustment := models.JournalEntry{
+		UserID:      userID,
+		Description: "Reconciliation adjustment",
+		Date:        time.Now(),
+	}
+	var total models.Money
+	for _, w := range books.Wallets {
+		if diff := expectedBalances[w.AccountID] - w.LedgerBalance; diff != 0 {
+			adjustment.Postings = append(adjustment.Postings,
+				models.Posting{Account: ledger.WalletAccount(w.AccountID), Amount: diff})
+			total -= diff
+		}
+	}
+
+	// The savings balance lives on the primary account
+	if d.SavingsDifference != 0 {
+		_, err := tx.Exec(`UPDATE accounts SET savings_balance = savings_balance - $1, updated_at = NOW()
+						   WHERE user_id = $2 AND is_primary`, d.SavingsDifference, userID)
+		if err != nil {
+			return d, true, err
+		}
+	}
+	if diff := d.ExpectedSavings - books.LedgerSavings; diff != 0 {
+		adjustment.Postings = append(adjustment.Postings, models.Posting{Account: ledger.Savings, Amount: diff})
+		total -= diff
+	}
+
+	if len(adjustment.Postings) > 0 {
+		adjustment.Postings = append(adjustment.Postings, models.Posting{Account: ReconciliationAccount, Amount: total})
+		if _, err := ledger.Post(tx, adjustment); err != nil {
+			return d, true, err
+		}
+	}
+	if err := ledger.Verify(tx, userID); err != nil {
+		return d, true, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return d, true, err
+	}
+
+	d.Repaired = true
+	return d, true, nil
+}
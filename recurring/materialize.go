@@ -0,0 +1,226 @@
+package recurring
+
+import (
+	"database/sql"
+	"errors"
+	"student-money-manager/ledger"
+	"student-money-manager/models"
+	"time"
+)
+
+// ErrAccountClosed is reported for a rule whose wallet was closed; its
+// occurrences are left unmaterialized until the rule is moved to an open
+// wallet.
+var ErrAccountClosed = errors.New("the wallet of this rule is closed")
+
+// RuleColumns lists the columns read by ScanRule.
+const RuleColumns = `id, user_id, account_id, type, amount, category, description, frequency, rrule,
+	start_date, end_date, last_run_date, is_active, created_at, updated_at`
+
+// ScanRule reads a row selected with RuleColumns.
+func ScanRule(row interface{ Scan(...interface{}) error }, r *models.RecurringRule) error {
+	return row.Scan(&r.ID, &r.UserID, &r.AccountID, &r.Type, &r.Amount, &r.Category, &r.Description,
+		&r.Frequency, &r.RRule, &r.StartDate, &r.EndDate, &r.LastRunDate, &r.IsActive, &r.CreatedAt, &r.UpdatedAt)
+}
+
+// Upcoming lists the next occurrences of a rule that have not been
+// materialized yet, starting no earlier than from.
+func Upcoming(rule models.RecurringRule, from time.Time, limit int) ([]time.Time, error) {
+	schedule, err := ForFrequency(rule.Frequency, rule.RRule)
+	if err != nil {
+		return nil, err
+	}
+	if rule.LastRunDate != nil && !Date(*rule.LastRunDate).Before(Date(from)) {
+		from = rule.LastRunDate.AddDate(0, 0, 1)
+	}
+	// Far enough ahead for any supported schedule to produce limit dates
+	to := Date(from).AddDate(limit+1, 0, 0)
+	return schedule.Occurrences(rule.StartDate, rule.EndDate, from, to, limit), nil
+}
+
+// RuleError records a rule that could not be materialized.
+type RuleError struct {
+	RuleID int    `json:"rule_id"`
+	UserID int    `json:"user_id"`
+	Error  string `json:"error"`
+}
+
+// Result summarizes a materializer run.
+type Result struct {
+	RulesChecked int                  `json:"rules_checked"`
+	Created      []models.Transaction `json:"created"`
+	Errors       []RuleError          `json:"errors"`
+}
+
+// Due creates the transactions of every occurrence up to asOf of the active
+// rules of one user, or of all users when userID is 0. Each rule runs in its
+// own database transaction. Running it again creates nothing new: the last
+// materialized date is stored on the rule and a unique index on
+// (recurring_rule_id, occurrence_date) rejects any occurrence created twice.
+// A rule with no occurrence left after asOf is deactivated, so finished
+// rules are not expanded again on every run.
+func Due(db *sql.DB, userID int, asOf time.Time) (Result, error) {
+	result := Result{Created: []models.Transaction{}, Errors: []RuleError{}}
+	asOf = Date(asOf)
+
+	query := `SELECT id, user_id FROM recurring_rules
+			  WHERE is_active AND ($1 = 0 OR user_id = $1) AND start_date <= $2
+			  AND (last_run_date IS NULL OR last_run_date < $2)
+			  ORDER BY user_id, id`
+	rows, err := db.Query(query, userID, asOf)
+	if err != nil {
+		return result, err
+	}
+
+	type candidate struct{ ruleID, userID int }
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.ruleID, &c.userID); err != nil {
+			rows.Close()
+			return result, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	for _, c := range candidates {
+		result.RulesChecked++
+		created, err := materialize(db, c.ruleID, c.userID, asOf)
+		if err != nil {
+			result.Errors = append(result.Errors, RuleError{RuleID: c.ruleID, UserID: c.userID, Error: err.Error()})
+			continue
+		}
+		result.Created = append(result.Created, created...)
+	}
+	return result, nil
+}
+
+func materialize(db *sql.DB, ruleID, userID int, asOf time.Time) ([]models.Transaction, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Same lock order as the handlers: every wallet of the user, then the row
+	closed := map[int]bool{}
+	rows, err := tx.Query(`SELECT id, closed_at IS NOT NULL FROM accounts WHERE user_id = $1 ORDER BY id FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var isClosed bool
+		if err := rows.Scan(&id, &isClosed); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		closed[id] = isClosed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var rule models.RecurringRule
+	query := `SELECT ` + RuleColumns + ` FROM recurring_rules WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	if err := ScanRule(tx.QueryRow(query, ruleID, userID), &rule); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !rule.IsActive {
+		return nil, nil
+	}
+
+	schedule, err := ForFrequency(rule.Frequency, rule.RRule)
+	if err != nil {
+		return nil, err
+	}
+	from := rule.StartDate
+	if rule.LastRunDate != nil {
+		from = rule.LastRunDate.AddDate(0, 0, 1)
+	}
+	dates := schedule.Occurrences(rule.StartDate, rule.EndDate, from, asOf, 0)
+	finished := schedule.Finished(rule.StartDate, rule.EndDate, asOf)
+	if len(dates) == 0 {
+		if !finished {
+			return nil, nil
+		}
+		if _, err := tx.Exec(`UPDATE recurring_rules SET is_active = false, updated_at = NOW() WHERE id = $1`, rule.ID); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	}
+	if closed[rule.AccountID] {
+		return nil, ErrAccountClosed
+	}
+
+	var created []models.Transaction
+	var delta models.Money
+	// Expenses draw from the envelope of their category, as they do when
+	// entered by hand
+	insert := `INSERT INTO transactions (user_id, account_id, amount, type, category_id, category, description, date,
+			   recurring_rule_id, occurrence_date, envelope_id, created_at, updated_at)
+			   VALUES ($1, $2, $3, $4, (SELECT id FROM categories WHERE user_id = $1 AND type = $4 AND name = $5), $5, $6, $7, $8, $9,
+			   CASE WHEN $4 = 'expense' THEN (SELECT id FROM envelopes WHERE user_id = $1 AND category = $5) END,
+			   NOW(), NOW())
+			   ON CONFLICT (recurring_rule_id, occurrence_date) DO NOTHING
+			   RETURNING id, category_id, envelope_id, created_at, updated_at`
+	for _, date := range dates {
+		t := models.Transaction{
+			UserID:          userID,
+			AccountID:       rule.AccountID,
+			Amount:          rule.Amount,
+			Type:            rule.Type,
+			Category:        rule.Category,
+			Description:     rule.Description,
+			Date:            date,
+			RecurringRuleID: &rule.ID,
+		}
+		err := tx.QueryRow(insert, userID, t.AccountID, t.Amount, t.Type, t.Category, t.Description, date, rule.ID, date).
+			Scan(&t.ID, &t.CategoryID, &t.EnvelopeID, &t.CreatedAt, &t.UpdatedAt)
+		if err == sql.ErrNoRows {
+			continue // already materialized
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := ledger.Post(tx, ledger.ForTransaction(t)); err != nil {
+			return nil, err
+		}
+		if t.Type == "income" {
+			delta += t.Amount
+		} else {
+			delta -= t.Amount
+		}
+		created = append(created, t)
+	}
+
+	if delta != 0 {
+		_, err := tx.Exec(`UPDATE accounts SET balance = balance + $1, updated_at = NOW() WHERE id = $2`, delta, rule.AccountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE recurring_rules SET last_run_date = $1, is_active = $2, updated_at = NOW() WHERE id = $3`,
+		dates[len(dates)-1], !finished, rule.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ledger.Verify(tx, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
@@ -0,0 +1,281 @@
+// Package recurring expands recurring transaction rules into dated
+// occurrences and materializes the due ones as transactions.
+package recurring
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies accepted on a rule. FrequencyCustom takes its schedule from an
+// RRULE string.
+const (
+	FrequencyDaily    = "daily"
+	FrequencyWeekly   = "weekly"
+	FrequencyBiweekly = "biweekly"
+	FrequencyMonthly  = "monthly"
+	FrequencyCustom   = "custom"
+)
+
+// Schedule is the supported subset of an RFC 5545 RRULE: FREQ (DAILY,
+// WEEKLY, MONTHLY or YEARLY), INTERVAL, BYDAY for weekly rules, BYMONTHDAY
+// for monthly rules, COUNT and UNTIL. Occurrences are calendar dates.
+type Schedule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      *time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ForFrequency returns the schedule of a rule's frequency. rrule is only
+// read for FrequencyCustom.
+func ForFrequency(frequency, rrule string) (Schedule, error) {
+	switch frequency {
+	case FrequencyDaily:
+		return Schedule{Freq: "DAILY", Interval: 1}, nil
+	case FrequencyWeekly:
+		return Schedule{Freq: "WEEKLY", Interval: 1}, nil
+	case FrequencyBiweekly:
+		return Schedule{Freq: "WEEKLY", Interval: 2}, nil
+	case FrequencyMonthly:
+		return Schedule{Freq: "MONTHLY", Interval: 1}, nil
+	case FrequencyCustom:
+		return Parse(rrule)
+	}
+	return Schedule{}, fmt.Errorf("unknown frequency %q", frequency)
+}
+
+// Parse reads an RRULE such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH". A
+// leading "RRULE:" is allowed.
+func Parse(rrule string) (Schedule, error) {
+	s := Schedule{Interval: 1}
+	rrule = strings.TrimPrefix(strings.TrimSpace(rrule), "RRULE:")
+	if rrule == "" {
+		return s, fmt.Errorf("rrule is empty")
+	}
+
+	for _, part := range strings.Split(rrule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return s, fmt.Errorf("invalid rrule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			s.Freq = strings.ToUpper(value)
+			switch s.Freq {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+			default:
+				return s, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return s, fmt.Errorf("INTERVAL must be a positive integer")
+			}
+			s.Interval = n
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return s, fmt.Errorf("unsupported BYDAY value %q", day)
+				}
+				s.ByDay = append(s.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return s, fmt.Errorf("invalid BYMONTHDAY value %q", day)
+				}
+				s.ByMonthDay = append(s.ByMonthDay, n)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return s, fmt.Errorf("COUNT must be a positive integer")
+			}
+			s.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return s, err
+			}
+			s.Until = &until
+		case "WKST":
+			// Weeks always start on Monday
+		default:
+			return s, fmt.Errorf("unsupported rrule part %q", key)
+		}
+	}
+
+	if s.Freq == "" {
+		return s, fmt.Errorf("rrule needs a FREQ")
+	}
+	if len(s.ByDay) > 0 && s.Freq != "WEEKLY" {
+		return s, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if len(s.ByMonthDay) > 0 && s.Freq != "MONTHLY" {
+		return s, fmt.Errorf("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	if s.Count > 0 && s.Until != nil {
+		return s, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	return s, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102", "20060102T150405Z", "20060102T150405", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return Date(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+// Date truncates t to midnight UTC of its calendar day.
+func Date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Occurrences returns the occurrences of a schedule starting on start that
+// fall within [from, to], at most limit of them when limit > 0. end, when
+// set, is the last date the rule may produce. COUNT is counted from start, so
+// occurrences before from still use it up.
+func (s Schedule) Occurrences(start time.Time, end *time.Time, from, to time.Time, limit int) []time.Time {
+	start, from, to = Date(start), Date(from), Date(to)
+	if end != nil && Date(*end).Before(to) {
+		to = Date(*end)
+	}
+	if s.Until != nil && s.Until.Before(to) {
+		to = *s.Until
+	}
+
+	var dates []time.Time
+	produced := 0
+	for period := 0; ; period++ {
+		candidates := s.period(start, period)
+		if len(candidates) == 0 {
+			// Only possible when the whole period has no valid day, e.g.
+			// BYMONTHDAY=31 in a short month; keep going.
+			if s.periodStart(start, period).After(to) {
+				return dates
+			}
+			continue
+		}
+		for _, date := range candidates {
+			if date.Before(start) {
+				continue
+			}
+			if date.After(to) {
+				return dates
+			}
+			produced++
+			if s.Count > 0 && produced > s.Count {
+				return dates
+			}
+			if !date.Before(from) {
+				dates = append(dates, date)
+				if limit > 0 && len(dates) == limit {
+					return dates
+				}
+			}
+		}
+	}
+}
+
+// Finished reports whether a schedule starting on start has no occurrence
+// after asOf, because end, UNTIL or COUNT has been reached.
+func (s Schedule) Finished(start time.Time, end *time.Time, asOf time.Time) bool {
+	asOf = Date(asOf)
+	if end != nil && !Date(*end).After(asOf) {
+		return true
+	}
+	if s.Until != nil && !s.Until.After(asOf) {
+		return true
+	}
+	return s.Count > 0 && len(s.Occurrences(start, end, start, asOf, 0)) >= s.Count
+}
+
+// periodStart is the first day of the given period counted from start.
+func (s Schedule) periodStart(start time.Time, period int) time.Time {
+	n := period * s.Interval
+	switch s.Freq {
+	case "DAILY":
+		return start.AddDate(0, 0, n)
+	case "WEEKLY":
+		monday := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, 7*n)
+	case "MONTHLY":
+		return time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(start.Year()+n, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// period lists the candidate dates of one period in ascending order.
+func (s Schedule) period(start time.Time, period int) []time.Time {
+	first := s.periodStart(start, period)
+	switch s.Freq {
+	case "DAILY":
+		return []time.Time{first}
+
+	case "WEEKLY":
+		days := s.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		var dates []time.Time
+		for offset := 0; offset < 7; offset++ {
+			date := first.AddDate(0, 0, offset)
+			for _, day := range days {
+				if date.Weekday() == day {
+					dates = append(dates, date)
+					break
+				}
+			}
+		}
+		return dates
+
+	case "MONTHLY":
+		last := daysIn(first.Year(), first.Month())
+		if len(s.ByMonthDay) == 0 {
+			// The day of start, moved to the last day of shorter months so a
+			// rule starting on the 31st still runs every month.
+			day := start.Day()
+			if day > last {
+				day = last
+			}
+			return []time.Time{first.AddDate(0, 0, day-1)}
+		}
+		var dates []time.Time
+		for day := 1; day <= last; day++ {
+			for _, want := range s.ByMonthDay {
+				if want == day || last+want+1 == day {
+					dates = append(dates, first.AddDate(0, 0, day-1))
+					break
+				}
+			}
+		}
+		return dates
+
+	default:
+		day := start.Day()
+		if last := daysIn(first.Year(), start.Month()); day > last {
+			day = last
+		}
+		return []time.Time{time.Date(first.Year(), start.Month(), day, 0, 0, 0, 0, time.UTC)}
+	}
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,165 @@
+package recurring
+
+import (
+	"testing"
+	"time"
+)
+
+func date(value string) time.Time {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func dates(values ...string) []time.Time {
+	var out []time.Time
+	for _, value := range values {
+		out = append(out, date(value))
+	}
+	return out
+}
+
+func TestOccurrences(t *testing.T) {
+	end := date("2026-03-15")
+	tests := []struct {
+		name     string
+		rrule    string
+		start    string
+		end      *time.Time
+		from, to string
+		want     []time.Time
+	}{
+		{
+			name: "BYMONTHDAY=31 skips February", rrule: "FREQ=MONTHLY;BYMONTHDAY=31",
+			start: "2026-01-31", from: "2026-01-01", to: "2026-05-31",
+			want: dates("2026-01-31", "2026-03-31", "2026-05-31"),
+		},
+		{
+			name: "BYMONTHDAY=-1 is the last day", rrule: "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: "2026-01-01", from: "2026-01-01", to: "2026-04-30",
+			want: dates("2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30"),
+		},
+		{
+			name: "monthly on the 31st falls back to the last day", rrule: "FREQ=MONTHLY",
+			start: "2026-01-31", from: "2026-01-01", to: "2026-03-31",
+			want: dates("2026-01-31", "2026-02-28", "2026-03-31"),
+		},
+		{
+			name: "COUNT after a materialized history", rrule: "FREQ=WEEKLY;COUNT=4",
+			start: "2026-01-05", from: "2026-01-13", to: "2026-12-31",
+			want: dates("2026-01-19", "2026-01-26"),
+		},
+		{
+			name: "COUNT used up", rrule: "FREQ=WEEKLY;COUNT=4",
+			start: "2026-01-05", from: "2026-01-27", to: "2026-12-31",
+		},
+		{
+			name: "UNTIL is inclusive", rrule: "FREQ=DAILY;UNTIL=20260110",
+			start: "2026-01-08", from: "2026-01-01", to: "2026-01-31",
+			want: dates("2026-01-08", "2026-01-09", "2026-01-10"),
+		},
+		{
+			name: "to on the UNTIL date", rrule: "FREQ=DAILY;UNTIL=20260110T235959Z",
+			start: "2026-01-08", from: "2026-01-10", to: "2026-01-10",
+			want: dates("2026-01-10"),
+		},
+		{
+			name: "from after UNTIL", rrule: "FREQ=DAILY;UNTIL=2026-01-10",
+			start: "2026-01-08", from: "2026-01-11", to: "2026-01-31",
+		},
+		{
+			name: "end date is inclusive", rrule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU",
+			start: "2026-02-01", end: &end, from: "2026-01-01", to: "2026-12-31",
+			want: dates("2026-02-01", "2026-02-09", "2026-02-15", "2026-02-23", "2026-03-01", "2026-03-09", "2026-03-15"),
+		},
+	}
+	for _, test := range tests {
+		s, err := Parse(test.rrule)
+		if err != nil {
+			t.Errorf("%s: Parse(%q): %v", test.name, test.rrule, err)
+			continue
+		}
+		got := s.Occurrences(date(test.start), test.end, date(test.from), date(test.to), 0)
+		if !equalDates(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOccurrencesLimit(t *testing.T) {
+	s, _ := ForFrequency(FrequencyDaily, "")
+	got := s.Occurrences(date("2026-01-01"), nil, date("2026-01-01"), date("2026-12-31"), 2)
+	if want := dates("2026-01-01", "2026-01-02"); !equalDates(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, rrule := range []string{
+		"",
+		"RRULE:",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=x",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;COUNT=3;UNTIL=20260110",
+		"FREQ=DAILY;BYSETPOS=1",
+		"FREQ=DAILY;COUNT",
+	} {
+		if _, err := Parse(rrule); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", rrule)
+		}
+	}
+
+	if _, err := ForFrequency("yearly", ""); err == nil {
+		t.Error("ForFrequency(yearly) succeeded, want an error")
+	}
+}
+
+func equalDates(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFinished(t *testing.T) {
+	end := date("2026-01-10")
+	tests := []struct {
+		rrule string
+		end   *time.Time
+		asOf  string
+		want  bool
+	}{
+		{"FREQ=DAILY", nil, "2030-01-01", false},
+		{"FREQ=DAILY", &end, "2026-01-09", false},
+		{"FREQ=DAILY", &end, "2026-01-10", true},
+		{"FREQ=DAILY;UNTIL=20260110", nil, "2026-01-09", false},
+		{"FREQ=DAILY;UNTIL=20260110", nil, "2026-01-10", true},
+		{"FREQ=WEEKLY;COUNT=2", nil, "2026-01-11", false},
+		{"FREQ=WEEKLY;COUNT=2", nil, "2026-01-12", true},
+	}
+	for _, test := range tests {
+		s, err := Parse(test.rrule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Finished(date("2026-01-05"), test.end, date(test.asOf)); got != test.want {
+			t.Errorf("%s ending %v: Finished(%s) = %v, want %v", test.rrule, test.end, test.asOf, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package scheduler runs periodic jobs inside the server process. Several
+// instances may run side by side: a Postgres advisory lock makes sure each
+// job runs on one instance at a time, and the time of its last run is kept in
+// the scheduler_jobs table so a restarted instance picks up where the others
+// left off.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Job is one periodic task. Run receives the current time and must be safe
+// to repeat: after downtime it runs once and is expected to catch up on
+// everything it missed.
+type Job struct {
+	Name  string
+	Every time.Duration
+	Run   func(db *sql.DB, now time.Time) error
+}
+
+// Scheduler checks every Tick which jobs are due.
+type Scheduler struct {
+	db   *sql.DB
+	tick time.Duration
+	jobs []Job
+}
+
+func New(db *sql.DB, tick time.Duration, jobs ...Job) *Scheduler {
+	return &Scheduler{db: db, tick: tick, jobs: jobs}
+}
+
+// Start runs due jobs right away and then on every tick until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.tick)
+		defer ticker.Stop()
+
+		for {
+			s.RunDue(ctx, time.Now().UTC())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunDue runs every job whose last run is at least Every ago.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) {
+	for _, job := range s.jobs {
+		if err := s.runJob(ctx, job, now); err != nil {
+			log.Printf("scheduler: job %s: %v", job.Name, err)
+		}
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, job Job, now time.Time) error {
+	// Advisory locks belong to a session, so take and release it on one
+	// connection from the pool.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked bool
+	key := "scheduler:" + job.Name
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, key).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil // another instance is running it
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, key)
+
+	// Checked under the lock so two instances cannot both find the job due
+	var lastRun sql.NullTime
+	err = conn.QueryRowContext(ctx, `SELECT last_run_at FROM scheduler_jobs WHERE name = $1`, job.Name).Scan(&lastRun)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if lastRun.Valid && now.Sub(lastRun.Time) < job.Every {
+		return nil
+	}
+
+	runErr := job.Run(s.db, now)
+
+	var lastError sql.NullString
+	if runErr != nil {
+		lastError = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	_, err = conn.ExecContext(ctx, `INSERT INTO scheduler_jobs (name, last_run_at, last_error)
+								   VALUES ($1, $2, $3)
+								   ON CONFLICT (name) DO UPDATE SET last_run_at = $2, last_error = $3`,
+		job.Name, now, lastError)
+	if err != nil {
+		return err
+	}
+	return runErr
+}